@@ -0,0 +1,180 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	_ "embed"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 版本号（来自仓库根目录的 .version）
+//
+//go:embed .version
+var versionFile string
+
+var version = strings.TrimSpace(versionFile)
+
+// 导出器名称（xtrace_agent_push_* 的 exporter 标签）
+const (
+	exporterVictoriaMetrics = "victoriametrics"
+	exporterOTLP            = "otlp"
+	exporterInfluxDB        = "influxdb"
+	exporterIPFIX           = "ipfix"
+)
+
+// 程序自身运行状态 metrics（xtrace_agent_*，不随每次推送重置）
+var (
+	agentHostIP string // 主机 IP，启动时确定
+
+	agentBuildInfo             *prometheus.GaugeVec
+	agentMapEntries            *prometheus.GaugeVec
+	agentMapCapacity           *prometheus.GaugeVec
+	agentIterationSeconds      *prometheus.GaugeVec
+	agentFlowsProcessed        *prometheus.GaugeVec
+	agentUnparsedPackets       *prometheus.CounterVec
+	agentUnparsedBytes         *prometheus.CounterVec
+	agentCollectSignalsDropped *prometheus.CounterVec
+	agentPushDuration          *prometheus.GaugeVec
+	agentPushTotal             *prometheus.CounterVec
+	agentPushPayloadBytes      *prometheus.CounterVec
+)
+
+// 在 registry 中注册 xtrace_agent_* metrics
+func registerAgentMetrics(registry prometheus.Registerer) {
+	ifaceLabels := []string{"interface", "host_ip", "collect_agg"}
+	pushLabels := []string{"exporter", "host_ip", "collect_agg"}
+
+	agentBuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xtrace_agent_build_info",
+		Help: "Build information of the xtrace-catch agent (always 1)",
+	}, []string{"version", "goversion", "host_ip", "collect_agg"})
+	agentMapEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xtrace_agent_map_entries",
+		Help: "Number of entries currently in the flows BPF map",
+	}, ifaceLabels)
+	agentMapCapacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xtrace_agent_map_capacity",
+		Help: "Maximum number of entries of the flows BPF map",
+	}, ifaceLabels)
+	agentIterationSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xtrace_agent_map_iteration_seconds",
+		Help: "Time spent iterating the flows BPF map in the last collection cycle",
+	}, ifaceLabels)
+	agentFlowsProcessed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xtrace_agent_flows_processed",
+		Help: "Number of flows processed in the last collection cycle (after filtering)",
+	}, ifaceLabels)
+	agentUnparsedPackets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xtrace_agent_unparsed_packets_total",
+		Help: "Packets the XDP program could not parse as IPv4 (handle_other bucket)",
+	}, ifaceLabels)
+	agentUnparsedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xtrace_agent_unparsed_bytes_total",
+		Help: "Bytes of packets the XDP program could not parse as IPv4 (handle_other bucket)",
+	}, ifaceLabels)
+	agentCollectSignalsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xtrace_agent_collect_signals_dropped_total",
+		Help: "Collection ticks skipped because the interface had not finished the previous one",
+	}, ifaceLabels)
+	agentPushDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xtrace_agent_push_duration_seconds",
+		Help: "Duration of the last push to the exporter",
+	}, pushLabels)
+	agentPushTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xtrace_agent_push_total",
+		Help: "Number of pushes to the exporter by result (success/failure)",
+	}, append([]string{"result"}, pushLabels...))
+	agentPushPayloadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xtrace_agent_push_payload_bytes_total",
+		Help: "Payload bytes sent to the exporter",
+	}, pushLabels)
+
+	registry.MustRegister(agentBuildInfo, agentMapEntries, agentMapCapacity, agentIterationSeconds,
+		agentFlowsProcessed, agentUnparsedPackets, agentUnparsedBytes, agentCollectSignalsDropped,
+		agentPushDuration, agentPushTotal, agentPushPayloadBytes)
+}
+
+// 设置 build info（启动时调用，算网标签热加载时由 setCollectAgg 改为新标签）
+func setAgentBuildInfo() {
+	if agentBuildInfo == nil {
+		return
+	}
+	collectAggMu.RLock()
+	defer collectAggMu.RUnlock()
+	agentBuildInfo.Reset()
+	agentBuildInfo.WithLabelValues(version, runtime.Version(), agentHostIP, collectAgg).Set(1)
+}
+
+// 记录一个接口本周期的采集情况
+func observeCollect(iface string, entries, capacity, processed int, iteration time.Duration, unparsedPackets, unparsedBytes uint64) {
+	if agentMapEntries == nil {
+		return
+	}
+	collectAggMu.RLock()
+	defer collectAggMu.RUnlock()
+	labels := []string{iface, agentHostIP, collectAgg}
+	agentMapEntries.WithLabelValues(labels...).Set(float64(entries))
+	agentMapCapacity.WithLabelValues(labels...).Set(float64(capacity))
+	agentIterationSeconds.WithLabelValues(labels...).Set(iteration.Seconds())
+	agentFlowsProcessed.WithLabelValues(labels...).Set(float64(processed))
+	agentUnparsedPackets.WithLabelValues(labels...).Add(float64(unparsedPackets))
+	agentUnparsedBytes.WithLabelValues(labels...).Add(float64(unparsedBytes))
+}
+
+// 记录一次被跳过的采集请求（接口仍在处理上一周期）
+func observeCollectSignalDropped(iface string) {
+	if agentCollectSignalsDropped == nil {
+		return
+	}
+	collectAggMu.RLock()
+	defer collectAggMu.RUnlock()
+	agentCollectSignalsDropped.WithLabelValues(iface, agentHostIP, collectAgg).Inc()
+}
+
+// 接口停止监控时移除其 gauge 序列
+func forgetInterfaceAgentMetrics(iface string) {
+	if agentMapEntries == nil {
+		return
+	}
+	labels := prometheus.Labels{"interface": iface}
+	agentMapEntries.DeletePartialMatch(labels)
+	agentMapCapacity.DeletePartialMatch(labels)
+	agentIterationSeconds.DeletePartialMatch(labels)
+	agentFlowsProcessed.DeletePartialMatch(labels)
+}
+
+// 执行一次推送并记录耗时和结果
+func observePush(exporter string, push func() error) error {
+	start := time.Now()
+	err := push()
+	if err == nil {
+		recordPushSuccess(time.Now())
+	}
+	if agentPushDuration == nil {
+		return err
+	}
+	collectAggMu.RLock()
+	defer collectAggMu.RUnlock()
+	agentPushDuration.WithLabelValues(exporter, agentHostIP, collectAgg).Set(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	agentPushTotal.WithLabelValues(result, exporter, agentHostIP, collectAgg).Inc()
+	return err
+}
+
+// 记录发送给导出器的负载字节数
+func addPushPayload(exporter string, n int) {
+	if agentPushPayloadBytes == nil || n <= 0 {
+		return
+	}
+	collectAggMu.RLock()
+	defer collectAggMu.RUnlock()
+	agentPushPayloadBytes.WithLabelValues(exporter, agentHostIP, collectAgg).Add(float64(n))
+}
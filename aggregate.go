@@ -0,0 +1,291 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 聚合维度字段
+const (
+	aggFieldSrcIP = iota
+	aggFieldDstIP
+	aggFieldSrcSubnet
+	aggFieldDstSubnet
+	aggFieldSrcPort
+	aggFieldDstPort
+	aggFieldProtocol
+	aggFieldTrafficType
+)
+
+// 单个聚合维度
+type aggDim struct {
+	label  string // 导出时的标签名
+	field  int
+	prefix int // 子网前缀长度（仅 src_subnet/dst_subnet）
+}
+
+// 一个聚合层级：按若干维度汇总流量，导出为独立的指标族
+type aggLevel struct {
+	name string // 指标族名称片段：xtrace_network_agg_<name>_*
+	dims []aggDim
+
+	bytesRate *prometheus.GaugeVec
+	bitsRate  *prometheus.GaugeVec
+}
+
+// 已配置的聚合层级（--aggregate）
+var (
+	aggLevels []*aggLevel
+
+	// 是否导出五元组级别的流指标（关闭后只导出 NIC 和聚合层级）
+	flowMetricsEnabled = true
+)
+
+var aggLevelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// 解析聚合层级定义
+// 格式: [name=]dim,dim,...  维度可选 src_ip, dst_ip, src_subnet/N, dst_subnet/N,
+// src_port, dst_port, protocol, traffic_type
+func parseAggLevel(spec string) (*aggLevel, error) {
+	spec = strings.TrimSpace(spec)
+	spec = strings.TrimSuffix(strings.TrimPrefix(spec, "{"), "}")
+
+	name := ""
+	if i := strings.Index(spec, "="); i >= 0 {
+		name = strings.TrimSpace(spec[:i])
+		spec = spec[i+1:]
+	}
+
+	level := &aggLevel{}
+	seen := make(map[string]bool)
+	var nameParts []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		dim := aggDim{label: part}
+		nameParts = append(nameParts, part)
+		switch {
+		case part == "src_ip":
+			dim.field = aggFieldSrcIP
+		case part == "dst_ip":
+			dim.field = aggFieldDstIP
+		case part == "src_port":
+			dim.field = aggFieldSrcPort
+		case part == "dst_port":
+			dim.field = aggFieldDstPort
+		case part == "protocol":
+			dim.field = aggFieldProtocol
+		case part == "traffic_type":
+			dim.field = aggFieldTrafficType
+		case strings.HasPrefix(part, "src_subnet/") || strings.HasPrefix(part, "dst_subnet/"):
+			prefix, err := strconv.Atoi(part[strings.Index(part, "/")+1:])
+			if err != nil || prefix < 0 || prefix > 32 {
+				return nil, fmt.Errorf("无效的子网前缀: %s", part)
+			}
+			dim.prefix = prefix
+			dim.field = aggFieldSrcSubnet
+			dim.label = "src_subnet"
+			if strings.HasPrefix(part, "dst_") {
+				dim.field = aggFieldDstSubnet
+				dim.label = "dst_subnet"
+			}
+			nameParts[len(nameParts)-1] = dim.label + strconv.Itoa(prefix)
+		default:
+			return nil, fmt.Errorf("不支持的聚合维度: %s", part)
+		}
+
+		if seen[dim.label] {
+			return nil, fmt.Errorf("聚合维度重复: %s", dim.label)
+		}
+		seen[dim.label] = true
+		level.dims = append(level.dims, dim)
+	}
+
+	if len(level.dims) == 0 {
+		return nil, fmt.Errorf("聚合层级至少需要一个维度: %q", spec)
+	}
+	if name == "" {
+		name = strings.Join(nameParts, "_")
+	}
+	if !aggLevelNameRe.MatchString(name) {
+		return nil, fmt.Errorf("无效的聚合层级名称: %s", name)
+	}
+	level.name = name
+	return level, nil
+}
+
+// 解析多个聚合层级，检查名称唯一
+func parseAggLevels(specs []string) ([]*aggLevel, error) {
+	var levels []*aggLevel
+	names := make(map[string]bool)
+	for _, spec := range specs {
+		level, err := parseAggLevel(spec)
+		if err != nil {
+			return nil, err
+		}
+		if names[level.name] {
+			return nil, fmt.Errorf("聚合层级名称重复: %s", level.name)
+		}
+		names[level.name] = true
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// 维度标签名（不含 interface/host_ip/collect_agg）
+func (l *aggLevel) labelNames() []string {
+	names := make([]string, len(l.dims))
+	for i, d := range l.dims {
+		names[i] = d.label
+	}
+	return names
+}
+
+// 计算流样本在该层级上的维度取值
+func (l *aggLevel) labelValues(s *FlowSample) []string {
+	values := make([]string, len(l.dims))
+	for i, d := range l.dims {
+		switch d.field {
+		case aggFieldSrcIP:
+			values[i] = ipToStr(s.Key.SrcIP)
+		case aggFieldDstIP:
+			values[i] = ipToStr(s.Key.DstIP)
+		case aggFieldSrcSubnet:
+			values[i] = subnetToStr(s.Key.SrcIP, d.prefix)
+		case aggFieldDstSubnet:
+			values[i] = subnetToStr(s.Key.DstIP, d.prefix)
+		case aggFieldSrcPort:
+			values[i] = strconv.Itoa(int(s.SrcPort))
+		case aggFieldDstPort:
+			values[i] = strconv.Itoa(int(s.DstPort))
+		case aggFieldProtocol:
+			values[i] = strconv.Itoa(int(s.Key.Proto))
+		case aggFieldTrafficType:
+			values[i] = s.TrafficType
+		}
+	}
+	return values
+}
+
+// 将 IP（网络字节序）按前缀长度转换为子网字符串，例如 10.0.1.0/24
+func subnetToStr(ip uint32, prefix int) string {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, ip)
+	masked := net.IP(b).Mask(net.CIDRMask(prefix, 32))
+	return masked.String() + "/" + strconv.Itoa(prefix)
+}
+
+// 在 registry 中注册各聚合层级的指标族
+func registerAggregationMetrics(registry prometheus.Registerer) {
+	for _, l := range aggLevels {
+		labels := append(l.labelNames(), "interface", "host_ip", "collect_agg")
+		l.bytesRate = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "xtrace_network_agg_" + l.name + "_bytes_rate",
+				Help: "Network traffic rate in bytes per second aggregated by " + strings.Join(l.labelNames(), ", "),
+			},
+			labels,
+		)
+		l.bitsRate = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "xtrace_network_agg_" + l.name + "_bits_rate",
+				Help: "Network traffic rate in bits per second aggregated by " + strings.Join(l.labelNames(), ", "),
+			},
+			labels,
+		)
+		registry.MustRegister(l.bytesRate, l.bitsRate)
+	}
+}
+
+// 推送后重置聚合层级 Gauge
+func resetAggregationMetrics() {
+	for _, l := range aggLevels {
+		if l.bytesRate != nil {
+			l.bytesRate.Reset()
+			l.bitsRate.Reset()
+		}
+	}
+}
+
+// AggSample 一个聚合层级中某组维度取值在一个采集周期内的汇总
+type AggSample struct {
+	Level        *aggLevel
+	Interface    string
+	Values       []string // 与 Level.dims 一一对应
+	DeltaPackets uint64
+	DeltaBytes   uint64
+	BytesPerSec  float64
+	BitsPerSec   float64
+	Interval     float64
+	Timestamp    time.Time
+}
+
+// aggregateFlows 按各聚合层级汇总同一批流样本（按接口分别聚合）
+func aggregateFlows(levels []*aggLevel, flows []FlowSample) []AggSample {
+	if len(levels) == 0 {
+		return nil
+	}
+
+	var result []AggSample
+	for _, l := range levels {
+		index := make(map[string]int)
+		start := len(result)
+		for i := range flows {
+			s := &flows[i]
+			// 本周期无增量的流不产生聚合序列（与 stdout 输出一致）
+			if s.DeltaPackets == 0 {
+				continue
+			}
+			values := l.labelValues(s)
+			key := s.Interface + "\x00" + strings.Join(values, "\x00")
+			idx, ok := index[key]
+			if !ok {
+				idx = len(result)
+				index[key] = idx
+				result = append(result, AggSample{
+					Level:     l,
+					Interface: s.Interface,
+					Values:    values,
+					Interval:  s.Interval,
+					Timestamp: s.Timestamp,
+				})
+			}
+			a := &result[idx]
+			a.DeltaPackets += s.DeltaPackets
+			a.DeltaBytes += s.DeltaBytes
+			a.BytesPerSec += s.BytesPerSec
+			a.BitsPerSec += s.BitsPerSec
+		}
+
+		// 同一层级内按接口和维度取值排序，输出稳定
+		level := result[start:]
+		sort.SliceStable(level, func(i, j int) bool {
+			if level[i].Interface != level[j].Interface {
+				return level[i].Interface < level[j].Interface
+			}
+			return strings.Join(level[i].Values, "\x00") < strings.Join(level[j].Values, "\x00")
+		})
+	}
+	return result
+}
+
+// UpdateMetrics 更新聚合层级速率 metrics
+func (a *AggSample) UpdateMetrics(hostIP string) {
+	labels := append(append([]string{}, a.Values...), a.Interface, hostIP, currentCollectAgg())
+	a.Level.bytesRate.WithLabelValues(labels...).Set(a.BytesPerSec)
+	a.Level.bitsRate.WithLabelValues(labels...).Set(a.BitsPerSec)
+}
@@ -0,0 +1,142 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAggLevel(t *testing.T) {
+	tests := []struct {
+		spec    string
+		name    string
+		labels  []string
+		prefix  []int
+		wantErr bool
+	}{
+		{spec: "src_ip,dst_ip", name: "src_ip_dst_ip", labels: []string{"src_ip", "dst_ip"}, prefix: []int{0, 0}},
+		{spec: "rack=src_subnet/24, dst_subnet/16", name: "rack", labels: []string{"src_subnet", "dst_subnet"}, prefix: []int{24, 16}},
+		{spec: "src_subnet/24,traffic_type", name: "src_subnet24_traffic_type", labels: []string{"src_subnet", "traffic_type"}, prefix: []int{24, 0}},
+		// 外层的 {…} 会被去掉
+		{spec: " {by_port=dst_port,protocol} ", name: "by_port", labels: []string{"dst_port", "protocol"}, prefix: []int{0, 0}},
+		{spec: "{src_port}", name: "src_port", labels: []string{"src_port"}, prefix: []int{0}},
+		{spec: "src_subnet/0", name: "src_subnet0", labels: []string{"src_subnet"}, prefix: []int{0}},
+		{spec: "dst_subnet/32", name: "dst_subnet32", labels: []string{"dst_subnet"}, prefix: []int{32}},
+		{spec: "src_subnet/33", wantErr: true},
+		{spec: "src_subnet/-1", wantErr: true},
+		{spec: "src_subnet/x", wantErr: true},
+		{spec: "src_ip,src_ip", wantErr: true},
+		{spec: "src_subnet/24,src_subnet/16", wantErr: true},
+		{spec: "vlan", wantErr: true},
+		{spec: "name=", wantErr: true},
+		{spec: ",", wantErr: true},
+		{spec: "bad-name=src_ip", wantErr: true},
+		{spec: "1st=src_ip", wantErr: true},
+	}
+	for _, tt := range tests {
+		level, err := parseAggLevel(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseAggLevel(%q) = %+v, want error", tt.spec, level)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAggLevel(%q): %v", tt.spec, err)
+			continue
+		}
+		if level.name != tt.name {
+			t.Errorf("parseAggLevel(%q) name = %q, want %q", tt.spec, level.name, tt.name)
+		}
+		if !reflect.DeepEqual(level.labelNames(), tt.labels) {
+			t.Errorf("parseAggLevel(%q) labels = %v, want %v", tt.spec, level.labelNames(), tt.labels)
+		}
+		for i, d := range level.dims {
+			if d.prefix != tt.prefix[i] {
+				t.Errorf("parseAggLevel(%q) dim %d prefix = %d, want %d", tt.spec, i, d.prefix, tt.prefix[i])
+			}
+		}
+	}
+}
+
+func TestParseAggLevelsDuplicateNames(t *testing.T) {
+	if _, err := parseAggLevels([]string{"src_ip", "x=dst_ip", "src_ip,dst_ip"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := parseAggLevels([]string{"src_ip", "src_ip=dst_ip"}); err == nil {
+		t.Errorf("duplicate level names were accepted")
+	}
+}
+
+// 测试用 IP（网络字节序）
+func aggTestIP(a, b, c, d byte) uint32 {
+	return uint32(a) | uint32(b)<<8 | uint32(c)<<16 | uint32(d)<<24
+}
+
+func TestAggregateFlows(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	flow := func(iface string, src, dst uint32, dstPort uint16, trafficType string, packets, bytes uint64) FlowSample {
+		return FlowSample{
+			Interface:    iface,
+			Key:          FlowKey{SrcIP: src, DstIP: dst, Proto: 0xFE},
+			DstPort:      dstPort,
+			TrafficType:  trafficType,
+			DeltaPackets: packets,
+			DeltaBytes:   bytes,
+			BytesPerSec:  float64(bytes) / 5,
+			BitsPerSec:   float64(bytes) * 8 / 5,
+			Interval:     5,
+			Timestamp:    ts,
+		}
+	}
+	flows := []FlowSample{
+		flow("ib1", aggTestIP(10, 0, 1, 5), aggTestIP(10, 0, 2, 1), 4791, "RoCE_v2", 4, 400),
+		flow("ib0", aggTestIP(10, 0, 1, 1), aggTestIP(10, 0, 2, 1), 4791, "RoCE_v2", 10, 1000),
+		flow("ib0", aggTestIP(10, 0, 1, 2), aggTestIP(10, 0, 2, 2), 4791, "RoCE_v2", 20, 3000),
+		flow("ib0", aggTestIP(10, 0, 9, 1), aggTestIP(10, 0, 2, 1), 443, "TCP", 1, 100),
+		// 本周期无增量的流不产生聚合序列
+		flow("ib0", aggTestIP(10, 0, 7, 1), aggTestIP(10, 0, 2, 1), 22, "TCP", 0, 0),
+	}
+
+	bySubnet, _ := parseAggLevel("src_subnet/24,traffic_type")
+	byPort, _ := parseAggLevel("dst_port")
+	got := aggregateFlows([]*aggLevel{bySubnet, byPort}, flows)
+
+	type row struct {
+		level, iface   string
+		values         []string
+		packets, bytes uint64
+		bytesRate      float64
+	}
+	want := []row{
+		{"src_subnet24_traffic_type", "ib0", []string{"10.0.1.0/24", "RoCE_v2"}, 30, 4000, 800},
+		{"src_subnet24_traffic_type", "ib0", []string{"10.0.9.0/24", "TCP"}, 1, 100, 20},
+		{"src_subnet24_traffic_type", "ib1", []string{"10.0.1.0/24", "RoCE_v2"}, 4, 400, 80},
+		{"dst_port", "ib0", []string{"443"}, 1, 100, 20},
+		{"dst_port", "ib0", []string{"4791"}, 30, 4000, 800},
+		{"dst_port", "ib1", []string{"4791"}, 4, 400, 80},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		a := got[i]
+		if a.Level.name != w.level || a.Interface != w.iface || !reflect.DeepEqual(a.Values, w.values) {
+			t.Errorf("sample %d = %s/%s %v, want %s/%s %v", i, a.Level.name, a.Interface, a.Values, w.level, w.iface, w.values)
+			continue
+		}
+		if a.DeltaPackets != w.packets || a.DeltaBytes != w.bytes || a.BytesPerSec != w.bytesRate || a.BitsPerSec != w.bytesRate*8 {
+			t.Errorf("sample %d sums = %d packets %d bytes %v B/s %v b/s", i, a.DeltaPackets, a.DeltaBytes, a.BytesPerSec, a.BitsPerSec)
+		}
+		if a.Interval != 5 || !a.Timestamp.Equal(ts) {
+			t.Errorf("sample %d interval = %v timestamp = %v", i, a.Interval, a.Timestamp)
+		}
+	}
+
+	if got := aggregateFlows(nil, flows); got != nil {
+		t.Errorf("no levels: got %+v", got)
+	}
+}
@@ -0,0 +1,257 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vishvananda/netlink"
+)
+
+// 重新挂载的退避时间范围
+const (
+	reattachMinBackoff = time.Second
+	reattachMaxBackoff = time.Minute
+)
+
+// 接口加载 / 挂载 XDP 失败时的处理策略（--on-attach-error）
+// 挂载成功后丢失挂载的情况始终按退避重新挂载，不受此设置影响
+const (
+	attachErrorFail  = "fail"  // 退出进程（非 0 退出码），由 systemd / Kubernetes 重启
+	attachErrorSkip  = "skip"  // 跳过该接口，直到接口被删除后重新出现（默认）
+	attachErrorRetry = "retry" // 按退避持续重试，直到成功
+)
+
+var onAttachError = attachErrorSkip
+
+// 校验 --on-attach-error
+func validAttachErrorPolicy(policy string) bool {
+	switch policy {
+	case attachErrorFail, attachErrorSkip, attachErrorRetry:
+		return true
+	}
+	return false
+}
+
+// 接口加载 / 挂载失败后的处理方式
+type attachAction int
+
+const (
+	attachActionSkip  attachAction = iota // 停止监控该接口，直到接口被删除后重新出现
+	attachActionExit                      // 通知主流程退出进程
+	attachActionRetry                     // 按退避重试
+)
+
+// 按 --on-attach-error 决定挂载失败后的处理方式（未知策略按默认的 skip 处理）
+func attachErrorAction(policy string) attachAction {
+	switch policy {
+	case attachErrorFail:
+		return attachActionExit
+	case attachErrorRetry:
+		return attachActionRetry
+	}
+	return attachActionSkip
+}
+
+// 下一次重试前的退避时间：每次翻倍，限制在 [reattachMinBackoff, reattachMaxBackoff]
+func nextAttachBackoff(backoff time.Duration) time.Duration {
+	return min(max(backoff*2, reattachMinBackoff), reattachMaxBackoff)
+}
+
+// 接口挂载状态 metrics（不随每次推送重置）
+var (
+	interfaceAttached      *prometheus.GaugeVec   // XDP 程序是否挂载在接口上（1/0）
+	interfaceReattachTotal *prometheus.CounterVec // 重新挂载成功次数
+)
+
+// 在 registry 中注册接口挂载状态 metrics
+func registerAttachMetrics(registry prometheus.Registerer) {
+	interfaceAttached = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xtrace_interface_attached",
+			Help: "Whether the XDP program is currently attached to the interface (1 = attached, 0 = detached)",
+		},
+		[]string{"interface", "host_ip", "collect_agg"},
+	)
+	interfaceReattachTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "xtrace_interface_reattach_total",
+			Help: "Number of times the XDP program was reattached after losing its attachment",
+		},
+		[]string{"interface", "host_ip", "collect_agg"},
+	)
+	registry.MustRegister(interfaceAttached, interfaceReattachTotal)
+}
+
+// xdpAttachment 一个接口上的 XDP 挂载，检测挂载丢失并按退避重新挂载。
+// 程序和 flows map 由调用方持有，重新挂载期间保持不变，累计计数和 lastStats 因此得以延续。
+type xdpAttachment struct {
+	iface   string
+	hostIP  string
+	prog    *ebpf.Program
+	progID  ebpf.ProgramID
+	ifindex int
+	link    link.Link
+
+	attached    bool
+	backoff     time.Duration
+	nextAttempt time.Time
+}
+
+// 首次挂载 XDP 程序
+func attachXDP(iface string, ifindex int, prog *ebpf.Program, hostIP string) (*xdpAttachment, error) {
+	a := &xdpAttachment{
+		iface:   iface,
+		hostIP:  hostIP,
+		prog:    prog,
+		ifindex: ifindex,
+		backoff: reattachMinBackoff,
+	}
+	if info, err := prog.Info(); err == nil {
+		a.progID, _ = info.ID()
+	}
+
+	// 启用固定时优先沿用上一次运行留下的 link（XDP 不中断）
+	if l := adoptPinnedLink(iface, ifindex, prog); l != nil {
+		a.link = l
+		a.attached = true
+		a.setAttached(true)
+		return a, nil
+	}
+	if err := a.attach(); err != nil {
+		if !pinEnabled {
+			dir := filepath.Join(pinPath, iface)
+			if _, statErr := os.Stat(filepath.Join(dir, pinnedLinkName)); statErr == nil {
+				err = fmt.Errorf("%w（接口上仍有上次固定的 XDP link，可使用 --pin 沿用，或删除 %s）", err, dir)
+			}
+		}
+		return nil, err
+	}
+	a.setAttached(true)
+	return a, nil
+}
+
+func (a *xdpAttachment) attach() error {
+	l, err := link.AttachXDP(link.XDPOptions{
+		Program:   a.prog,
+		Interface: a.ifindex,
+	})
+	if err != nil {
+		return err
+	}
+	a.link = l
+	a.attached = true
+	pinLink(a.iface, l)
+	return nil
+}
+
+// 查询内核中接口当前挂载的 XDP 程序是否仍是本程序
+func (a *xdpAttachment) stillAttached() bool {
+	l, err := netlink.LinkByIndex(a.ifindex)
+	if err != nil {
+		return false
+	}
+	attrs := l.Attrs()
+	if attrs.Name != a.iface || attrs.Xdp == nil || !attrs.Xdp.Attached {
+		return false
+	}
+	// 无法获取程序 ID 时只检查是否有程序挂载
+	return a.progID == 0 || ebpf.ProgramID(attrs.Xdp.ProgId) == a.progID
+}
+
+// 每个采集周期调用一次：检测挂载是否丢失，丢失后按退避重新挂载
+func (a *xdpAttachment) check(now time.Time) {
+	if a.attached {
+		if a.stillAttached() {
+			a.setAttached(true)
+			return
+		}
+		log.Printf("[%s] 检测到 XDP 程序已脱离接口（驱动重载、固件复位或被外部卸载），准备重新挂载", a.iface)
+		a.detach()
+		a.setAttached(false)
+		a.backoff = reattachMinBackoff
+		a.nextAttempt = now
+	}
+
+	if now.Before(a.nextAttempt) {
+		return
+	}
+
+	// 驱动重载后接口可能以新的 ifindex 重新出现，按名称重新解析
+	if err := a.resolveIndex(); err == nil {
+		err = a.attach()
+		if err == nil {
+			log.Printf("[%s] XDP 程序已重新挂载 (索引: %d)", a.iface, a.ifindex)
+			a.setAttached(true)
+			if interfaceReattachTotal != nil {
+				collectAggMu.RLock()
+				interfaceReattachTotal.WithLabelValues(a.iface, a.hostIP, collectAgg).Inc()
+				collectAggMu.RUnlock()
+			}
+			return
+		}
+		log.Printf("[%s] 重新挂载 XDP 失败: %v，%v 后重试", a.iface, err, a.backoff)
+	} else {
+		log.Printf("[%s] %v，%v 后重试", a.iface, err, a.backoff)
+	}
+
+	a.nextAttempt = now.Add(a.backoff)
+	a.backoff = nextAttachBackoff(a.backoff)
+}
+
+func (a *xdpAttachment) resolveIndex() error {
+	ifi, err := net.InterfaceByName(a.iface)
+	if err != nil {
+		return fmt.Errorf("接口不存在: %w", err)
+	}
+	a.ifindex = ifi.Index
+	return nil
+}
+
+// 关闭已失效的 link（同时取消固定）
+func (a *xdpAttachment) detach() {
+	if a.link != nil {
+		unpinLink(a.iface, a.link)
+		a.link.Close()
+		a.link = nil
+	}
+	a.attached = false
+}
+
+// 更新挂载状态（/readyz 和 gauge）
+func (a *xdpAttachment) setAttached(attached bool) {
+	setInterfaceAttached(a.iface, attached)
+	if interfaceAttached == nil {
+		return
+	}
+	v := 0.0
+	if attached {
+		v = 1
+	}
+	collectAggMu.RLock()
+	defer collectAggMu.RUnlock()
+	interfaceAttached.WithLabelValues(a.iface, a.hostIP, collectAgg).Set(v)
+}
+
+// 关闭 link 并移除该接口的挂载状态序列
+// 已固定的 link 在进程退出后继续挂载，由下一次启动沿用；未固定时 XDP 随之卸载
+func (a *xdpAttachment) Close() {
+	if a.link != nil {
+		a.link.Close()
+		a.link = nil
+	}
+	a.attached = false
+	forgetInterfaceHealth(a.iface)
+	if interfaceAttached != nil {
+		interfaceAttached.DeletePartialMatch(prometheus.Labels{"interface": a.iface})
+	}
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAttachErrorAction(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   attachAction
+	}{
+		{attachErrorFail, attachActionExit},
+		{attachErrorSkip, attachActionSkip},
+		{attachErrorRetry, attachActionRetry},
+		{"", attachActionSkip},
+		{"unknown", attachActionSkip},
+	}
+	for _, tt := range tests {
+		if got := attachErrorAction(tt.policy); got != tt.want {
+			t.Errorf("attachErrorAction(%q) = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestNextAttachBackoff(t *testing.T) {
+	tests := []struct {
+		backoff time.Duration
+		want    time.Duration
+	}{
+		{0, reattachMinBackoff},
+		{reattachMinBackoff, 2 * time.Second},
+		{8 * time.Second, 16 * time.Second},
+		{32 * time.Second, reattachMaxBackoff},
+		{reattachMaxBackoff, reattachMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := nextAttachBackoff(tt.backoff); got != tt.want {
+			t.Errorf("nextAttachBackoff(%v) = %v, want %v", tt.backoff, got, tt.want)
+		}
+	}
+
+	// 从最小值开始持续翻倍，最终停在上限
+	backoff, steps := reattachMinBackoff, 0
+	for backoff < reattachMaxBackoff {
+		backoff = nextAttachBackoff(backoff)
+		steps++
+	}
+	if backoff != reattachMaxBackoff || steps != 6 {
+		t.Errorf("reached %v after %d steps, want %v after 6", backoff, steps, reattachMaxBackoff)
+	}
+}
+
+// fail 策略把第一个错误交给主流程退出，skip 策略只记录日志
+func TestHandleAttachError(t *testing.T) {
+	oldPolicy := onAttachError
+	t.Cleanup(func() { onAttachError = oldPolicy })
+
+	tests := []struct {
+		policy   string
+		wantFail bool
+	}{
+		{attachErrorFail, true},
+		{attachErrorSkip, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			onAttachError = tt.policy
+			m := newIfaceManager([]string{"ib*"}, &sync.WaitGroup{})
+			m.handleAttachError("ib0", errors.New("附加 XDP 程序失败"))
+			// 已有错误时不阻塞
+			m.handleAttachError("ib1", errors.New("附加 XDP 程序失败"))
+
+			select {
+			case err := <-m.failed:
+				if !tt.wantFail {
+					t.Fatalf("unexpected failure: %v", err)
+				}
+				if err.Error() != "[ib0] 附加 XDP 程序失败" {
+					t.Errorf("failure = %q", err)
+				}
+			default:
+				if tt.wantFail {
+					t.Fatalf("no failure reported")
+				}
+			}
+		})
+	}
+}
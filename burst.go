@@ -0,0 +1,236 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 微突发直方图（与 xdp_monitor.c 中的 BURST_BUCKETS / BURST_MIN_BYTES 一致）：
+// 第 i 个桶统计字节数 <= burstMinBytes << i 的时间片，最后一个桶不设上限
+const (
+	burstBuckets  = 16
+	burstMinBytes = 1024
+)
+
+// 时间片长度的取值范围（--burst-slot，微秒）
+const (
+	minBurstSlotUs = 10
+	maxBurstSlotUs = 1000000
+)
+
+// 微突发统计的时间片长度（--burst-slot），0 表示关闭
+var burstSlot time.Duration
+
+// BurstConfig 与 xdp_monitor.c 中的 struct burst_config 一致
+type BurstConfig struct {
+	SlotNs uint64
+	Gen    uint64
+}
+
+// BurstState 与 xdp_monitor.c 中的 struct burst_state 一致
+type BurstState struct {
+	Slot      uint64
+	SlotBytes uint64
+	PeakGen   [2]uint64
+	PeakBytes [2]uint64
+	Buckets   [burstBuckets]uint64
+	SumBytes  uint64
+}
+
+// 把一个已结束的时间片计入直方图和采集周期 gen 的峰值（与 record_burst_slot 相同）
+func (st *BurstState) recordSlot(bytes, gen uint64) {
+	bucket := 0
+	for i := 0; i < burstBuckets-1; i++ {
+		if bytes > uint64(burstMinBytes)<<i {
+			bucket = i + 1
+		}
+	}
+	st.Buckets[bucket]++
+	st.SumBytes += bytes
+
+	idx := gen & 1
+	if st.PeakGen[idx] != gen {
+		st.PeakGen[idx] = gen
+		st.PeakBytes[idx] = 0
+	}
+	st.PeakBytes[idx] = max(st.PeakBytes[idx], bytes)
+}
+
+// burstSample 一个接口在一个采集周期的微突发统计
+type burstSample struct {
+	Slot      time.Duration
+	PeakBytes uint64               // 本周期内已结束的时间片中的最大字节数
+	Buckets   [burstBuckets]uint64 // 各桶的时间片个数（程序加载以来的累计值，不是累加的）
+	SumBytes  uint64               // 已结束的时间片的字节数之和（累计）
+}
+
+// 读取采集周期 gen 的统计（调用方已把配置中的周期编号推进到 gen+1）
+func newBurstSample(st *BurstState, gen uint64, slot time.Duration) burstSample {
+	s := burstSample{Slot: slot, Buckets: st.Buckets, SumBytes: st.SumBytes}
+	if idx := gen & 1; st.PeakGen[idx] == gen {
+		s.PeakBytes = st.PeakBytes[idx]
+	}
+	return s
+}
+
+// PeakRate 本周期单个时间片的最高速率（bytes/s）
+func (s *burstSample) PeakRate() float64 {
+	return float64(s.PeakBytes) / s.Slot.Seconds()
+}
+
+// BurstSource 微突发统计来源：每次调用 ReadBurst 返回上一次调用以来的峰值和累计直方图
+type BurstSource interface {
+	ReadBurst() (burstSample, error)
+}
+
+// XDP 程序的 burst / burst_config map
+type xdpBurstSource struct {
+	state  *ebpf.Map
+	config *ebpf.Map
+	slot   time.Duration
+	gen    uint64
+}
+
+// 写入时间片长度，开启 XDP 程序中的微突发统计
+func newXDPBurstSource(state, config *ebpf.Map, slot time.Duration) (*xdpBurstSource, error) {
+	s := &xdpBurstSource{state: state, config: config, slot: slot, gen: 1}
+	if err := s.config.Put(uint32(0), BurstConfig{SlotNs: uint64(slot), Gen: s.gen}); err != nil {
+		return nil, fmt.Errorf("写入微突发统计配置失败: %w", err)
+	}
+	return s, nil
+}
+
+func (s *xdpBurstSource) ReadBurst() (burstSample, error) {
+	// 先推进周期编号，XDP 程序之后结算的时间片计入下一个周期的峰值
+	gen := s.gen
+	if err := s.config.Put(uint32(0), BurstConfig{SlotNs: uint64(s.slot), Gen: gen + 1}); err != nil {
+		return burstSample{}, fmt.Errorf("更新微突发统计配置失败: %w", err)
+	}
+	s.gen = gen + 1
+
+	var st BurstState
+	if err := s.state.Lookup(uint32(0), &st); err != nil {
+		return burstSample{}, fmt.Errorf("读取微突发统计失败: %w", err)
+	}
+	return newBurstSample(&st, gen, s.slot), nil
+}
+
+// burstCounter XDP 微突发统计的 Go 实现（回放抓包文件时使用，时间戳为数据包时间）
+type burstCounter struct {
+	state BurstState
+	slot  time.Duration
+	gen   uint64
+}
+
+func newBurstCounter(slot time.Duration) *burstCounter {
+	return &burstCounter{slot: slot, gen: 1}
+}
+
+// 按 account_burst 的方式把一个数据包计入时间片（ts 为纳秒时间戳）
+func (c *burstCounter) record(length int, ts uint64) {
+	st := &c.state
+	slot := ts / uint64(c.slot)
+	if st.Slot != slot {
+		prev := st.SlotBytes
+		st.Slot = slot
+		st.SlotBytes = 0
+		if prev > 0 {
+			st.recordSlot(prev, c.gen)
+		}
+	}
+	st.SlotBytes += uint64(length)
+}
+
+func (c *burstCounter) ReadBurst() (burstSample, error) {
+	gen := c.gen
+	c.gen++
+	return newBurstSample(&c.state, gen, c.slot), nil
+}
+
+// 微突发 metrics（--burst-slot 启用时注册）
+var (
+	interfacePeakRate *prometheus.GaugeVec // 本周期单个时间片的最高速率
+	burstHistograms   *burstCollector      // 时间片速率的分布（累计直方图）
+)
+
+// 导出时间片速率直方图：样本来自内核的累计计数，不经过 prometheus.Histogram 的 Observe
+type burstCollector struct {
+	desc *prometheus.Desc
+
+	mu      sync.Mutex
+	samples map[[3]string]burstSample // interface, host_ip, collect_agg
+}
+
+func (c *burstCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *burstCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for labels, s := range c.samples {
+		slotSeconds := s.Slot.Seconds()
+		var count uint64
+		buckets := make(map[float64]uint64, burstBuckets-1)
+		for i := 0; i < burstBuckets; i++ {
+			count += s.Buckets[i]
+			if i < burstBuckets-1 {
+				buckets[float64(uint64(burstMinBytes)<<i)/slotSeconds] = count
+			}
+		}
+		ch <- prometheus.MustNewConstHistogram(c.desc, count, float64(s.SumBytes)/slotSeconds, buckets, labels[:]...)
+	}
+}
+
+func (c *burstCollector) set(iface, hostIP string, s burstSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples[[3]string{iface, hostIP, currentCollectAgg()}] = s
+}
+
+func (c *burstCollector) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = make(map[[3]string]burstSample)
+}
+
+// 在 registry 中注册微突发 metrics
+func registerBurstMetrics(registry prometheus.Registerer) {
+	interfacePeakRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xtrace_interface_peak_rate_bytes",
+			Help: "Highest rate of a single burst time slot during the collection interval in bytes per second",
+		},
+		[]string{"interface", "host_ip", "collect_agg"},
+	)
+	burstHistograms = &burstCollector{
+		desc: prometheus.NewDesc(
+			"xtrace_interface_slot_rate_bytes",
+			"Distribution of per-time-slot rates in bytes per second since the XDP program was loaded (slots without traffic are not counted)",
+			[]string{"interface", "host_ip", "collect_agg"}, nil,
+		),
+		samples: make(map[[3]string]burstSample),
+	}
+	registry.MustRegister(interfacePeakRate, burstHistograms)
+}
+
+// 推送后重置微突发 metrics（下一周期只导出仍在采集的接口）
+func resetBurstMetrics() {
+	if interfacePeakRate != nil {
+		interfacePeakRate.Reset()
+		burstHistograms.reset()
+	}
+}
+
+// UpdateMetrics 更新接口的微突发 metrics
+func (s *burstSample) UpdateMetrics(iface, hostIP string) {
+	interfacePeakRate.WithLabelValues(iface, hostIP, currentCollectAgg()).Set(s.PeakRate())
+	burstHistograms.set(iface, hostIP, *s)
+}
@@ -0,0 +1,123 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBurstCounter(t *testing.T) {
+	ms := uint64(time.Millisecond)
+	c := newBurstCounter(time.Millisecond)
+
+	// 周期 1：时间片 0 共 1000 字节，时间片 1 共 3000 字节，时间片 2 尚未结束
+	c.record(400, 0)
+	c.record(600, ms/2)
+	c.record(3000, ms)
+	c.record(100, 5*ms) // 结算时间片 1，时间片 2-4 没有流量，不计入直方图
+	b, _ := c.ReadBurst()
+	if b.PeakBytes != 3000 {
+		t.Errorf("interval 1 peak = %d, want 3000", b.PeakBytes)
+	}
+	if b.Buckets[0] != 1 || b.Buckets[2] != 1 || b.SumBytes != 4000 {
+		t.Errorf("interval 1 buckets = %v sum = %d", b.Buckets, b.SumBytes)
+	}
+	if rate := b.PeakRate(); rate != 3e6 {
+		t.Errorf("peak rate = %v, want 3e6", rate)
+	}
+
+	// 周期 2：上一个周期遗留的时间片在本周期结算，峰值只统计本周期结算的时间片
+	c.record(200, 6*ms)
+	c.record(50<<20, 7*ms)
+	c.record(1, 8*ms)
+	b, _ = c.ReadBurst()
+	if b.PeakBytes != 50<<20 {
+		t.Errorf("interval 2 peak = %d, want %d", b.PeakBytes, 50<<20)
+	}
+	if b.Buckets[0] != 3 || b.Buckets[burstBuckets-1] != 1 || b.SumBytes != 4000+100+200+50<<20 {
+		t.Errorf("interval 2 buckets = %v sum = %d", b.Buckets, b.SumBytes)
+	}
+
+	// 周期 3：没有结算任何时间片，峰值为 0，直方图保持累计值
+	b, _ = c.ReadBurst()
+	if b.PeakBytes != 0 || b.Buckets[0] != 3 {
+		t.Errorf("interval 3 peak = %d buckets = %v", b.PeakBytes, b.Buckets)
+	}
+}
+
+func TestBurstBucketBounds(t *testing.T) {
+	tests := []struct {
+		bytes  uint64
+		bucket int
+	}{
+		{1, 0},
+		{burstMinBytes, 0},
+		{burstMinBytes + 1, 1},
+		{burstMinBytes << 3, 3},
+		{burstMinBytes<<(burstBuckets-2) + 1, burstBuckets - 1},
+		{1 << 40, burstBuckets - 1},
+	}
+	for _, tt := range tests {
+		var st BurstState
+		st.recordSlot(tt.bytes, 1)
+		if st.Buckets[tt.bucket] != 1 {
+			t.Errorf("%d bytes: buckets = %v, want bucket %d", tt.bytes, st.Buckets, tt.bucket)
+		}
+	}
+}
+
+func TestBurstMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registerBurstMetrics(registry)
+	t.Cleanup(func() {
+		interfacePeakRate = nil
+		burstHistograms = nil
+	})
+
+	s := burstSample{Slot: time.Millisecond, PeakBytes: 5000, SumBytes: 7000}
+	s.Buckets[0], s.Buckets[3] = 2, 1
+	s.UpdateMetrics("ib0", "192.0.2.1")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	found := 0
+	for _, mf := range families {
+		switch mf.GetName() {
+		case "xtrace_interface_peak_rate_bytes":
+			found++
+			if v := mf.GetMetric()[0].GetGauge().GetValue(); v != 5e6 {
+				t.Errorf("peak rate = %v, want 5e6", v)
+			}
+		case "xtrace_interface_slot_rate_bytes":
+			found++
+			h := mf.GetMetric()[0].GetHistogram()
+			if h.GetSampleCount() != 3 || h.GetSampleSum() != 7e6 {
+				t.Errorf("count = %d sum = %v, want 3 / 7e6", h.GetSampleCount(), h.GetSampleSum())
+			}
+			if len(h.GetBucket()) != burstBuckets-1 {
+				t.Fatalf("got %d buckets, want %d", len(h.GetBucket()), burstBuckets-1)
+			}
+			// 上界为 1024 字节 / 1ms，计数是累计的
+			for i, want := range map[int]uint64{0: 2, 2: 2, 3: 3, burstBuckets - 2: 3} {
+				b := h.GetBucket()[i]
+				if b.GetCumulativeCount() != want || b.GetUpperBound() != float64(uint64(burstMinBytes)<<i)*1000 {
+					t.Errorf("bucket %d = le %v count %d, want count %d", i, b.GetUpperBound(), b.GetCumulativeCount(), want)
+				}
+			}
+		}
+	}
+	if found != 2 {
+		t.Errorf("found %d burst metric families, want 2", found)
+	}
+
+	resetBurstMetrics()
+	if families, _ = registry.Gather(); len(families) != 0 {
+		t.Errorf("%d metric families left after reset", len(families))
+	}
+}
@@ -0,0 +1,119 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "time"
+
+// 一次采集使用的运行时设置和时间信息
+type collectOptions struct {
+	Filter      string    // 流量类型过滤（--filter）
+	ExcludeDNS  bool      // 排除常见 DNS 服务器的流量
+	WindowStart uint64    // 上一次采集开始时的时钟（纳秒，与 FlowStats 的时间戳同源）
+	Interval    float64   // 距上一次采集的实际间隔（秒），用于计算速率
+	Epoch       time.Time // 样本时间戳（对齐后的采集时刻）
+	ClockOffset int64     // FlowStats 的时间戳加上该值为 Unix 纳秒（XDP 为单调时钟，回放时为 0）
+	NICRates    bool      // 是否按 IP 对累加 NIC 速率（启用导出器时）
+
+	Elephant        elephantRule     // 大象流判定条件
+	LinkBytesPerSec float64          // 接口带宽（bytes/s），未知时为 0
+	Elephants       *elephantTracker // 各流连续超过阈值的周期数，nil 表示不检测大象流
+}
+
+// collectFlows 由流的累计值和上一周期的累计值计算本周期的接口快照，不读写全局状态
+// （除 opts.Elephants 中各流的连续计数外）
+//
+// 返回的 next 为下一周期使用的上一周期累计值：只包含本次出现且未被过滤的流，
+// 已从 map 中删除的流随之清理。MapCapacity 和 Iteration 由调用方填写。
+func collectFlows(iface string, flows, last map[FlowKey]FlowStats, opts collectOptions) (snap ifaceSnapshot, next map[FlowKey]FlowStats) {
+	snap = ifaceSnapshot{
+		Interface:  iface,
+		Epoch:      opts.Epoch,
+		NICs:       newNICRates(),
+		MapEntries: len(flows),
+	}
+	next = make(map[FlowKey]FlowStats, len(last))
+
+	for k, v := range flows {
+		// 过滤无效流量：跳过 src_ip 和 dst_ip 都为 0 的数据（只计入无法解析的数据包统计）
+		if k.SrcIP == 0 && k.DstIP == 0 {
+			prev, exists := last[k]
+			deltaPackets, deltaBytes, _ := v.CalculateDelta(prev, exists, opts.WindowStart)
+			next[k] = v
+			snap.UnparsedPackets += deltaPackets
+			snap.UnparsedBytes += deltaBytes
+			continue
+		}
+
+		// 检查是否应该显示该流量
+		if !shouldDisplayTraffic(k.Proto, k.SrcPort, k.DstPort, opts.Filter) {
+			continue
+		}
+
+		// 排除DNS流量（如果启用）
+		if opts.ExcludeDNS && isDNSTraffic(k.DstIP) {
+			continue
+		}
+
+		// 计算增量流量
+		prev, exists := last[k]
+		deltaPackets, deltaBytes, reset := v.CalculateDelta(prev, exists, opts.WindowStart)
+		next[k] = v
+		if reset {
+			snap.Resets++
+		}
+
+		// 端口号转换和速率计算
+		srcPort, dstPort := k.ConvertPorts()
+		bytesPerSec, bitsPerSec := CalculateRates(deltaBytes, opts.Interval)
+		trafficTypeStr := k.GetTrafficType()
+
+		// 大象流：连续多个周期超过速率阈值或接口带宽占比
+		var linkShare float64
+		if opts.LinkBytesPerSec > 0 {
+			linkShare = bytesPerSec / opts.LinkBytesPerSec
+		}
+		var elephantTicks int
+		if opts.Elephants != nil && opts.Elephant.enabled() {
+			elephantTicks = opts.Elephants.observe(k, opts.Elephant.exceeded(bytesPerSec, opts.LinkBytesPerSec))
+		}
+
+		snap.Flows = append(snap.Flows, FlowSample{
+			Interface:     iface,
+			Key:           k,
+			Stats:         v,
+			SrcPort:       srcPort,
+			DstPort:       dstPort,
+			TrafficType:   trafficTypeStr,
+			DeltaPackets:  deltaPackets,
+			DeltaBytes:    deltaBytes,
+			BytesPerSec:   bytesPerSec,
+			BitsPerSec:    bitsPerSec,
+			LinkShare:     linkShare,
+			ElephantTicks: elephantTicks,
+			Elephant:      elephantTicks > 0 && elephantTicks >= opts.Elephant.Ticks,
+			NewElephant:   elephantTicks > 0 && elephantTicks == opts.Elephant.Ticks,
+			FirstSeen:     statsTime(v.FirstSeen, opts.ClockOffset),
+			LastSeen:      statsTime(v.LastUpdate, opts.ClockOffset),
+			Interval:      opts.Interval,
+			Timestamp:     opts.Epoch,
+		})
+
+		// 添加 NIC 速率（按 IP 对聚合，不包含端口）
+		if opts.NICRates {
+			snap.NICs.Add(k.SrcIP, k.DstIP, k.Proto, bytesPerSec, bitsPerSec, trafficTypeStr)
+		}
+	}
+	if opts.Elephants != nil {
+		opts.Elephants.commit()
+	}
+	return snap, next
+}
+
+// 将 FlowStats 中的时间戳转换为挂钟时间，0 表示没有时间信息
+func statsTime(ts uint64, offset int64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ts)+offset)
+}
@@ -0,0 +1,333 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+// 测试用流：10.0.0.1 -> 10.0.0.2 的 RoCE v2、TCP，发往 8.8.8.8 的 DNS 查询，以及无法解析的 ARP 帧
+var (
+	testRoCEKey = FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: 0x1234, DstPort: roceV2Port, Proto: 0xFE}
+	testTCPKey  = FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: 0x5000, DstPort: 0x5000, Proto: 6}
+	testDNSKey  = FlowKey{SrcIP: testSrcIP, DstIP: 0x08080808, SrcPort: 0x3039, DstPort: 0x3500, Proto: 17}
+	testBadKey  = FlowKey{PktLenLow: 60, FirstU16: 0x0608}
+)
+
+func TestCollectFlows(t *testing.T) {
+	const windowStart = 1000
+
+	type want struct {
+		packets, bytes uint64
+	}
+	tests := []struct {
+		name  string
+		flows map[FlowKey]FlowStats
+		last  map[FlowKey]FlowStats
+		opts  collectOptions
+
+		want            map[FlowKey]want // 输出的流及其增量
+		wantNext        []FlowKey        // 下一周期保留的累计值
+		wantResets      int
+		wantUnparsedPkt uint64
+		wantUnparsedB   uint64
+		wantNICs        int
+	}{
+		{
+			name:     "new flow created in window counts fully",
+			flows:    map[FlowKey]FlowStats{testRoCEKey: {Packets: 10, Bytes: 40960, FirstSeen: 1500, LastUpdate: 1900}},
+			opts:     collectOptions{Interval: 1, NICRates: true},
+			want:     map[FlowKey]want{testRoCEKey: {10, 40960}},
+			wantNext: []FlowKey{testRoCEKey},
+			wantNICs: 1,
+		},
+		{
+			name:     "known flow reports delta",
+			flows:    map[FlowKey]FlowStats{testRoCEKey: {Packets: 15, Bytes: 61440, FirstSeen: 500, LastUpdate: 1900}},
+			last:     map[FlowKey]FlowStats{testRoCEKey: {Packets: 10, Bytes: 40960, FirstSeen: 500, LastUpdate: 900}},
+			opts:     collectOptions{Interval: 2},
+			want:     map[FlowKey]want{testRoCEKey: {5, 20480}},
+			wantNext: []FlowKey{testRoCEKey},
+		},
+		{
+			name:     "flow first seen by user space is estimated over its lifetime",
+			flows:    map[FlowKey]FlowStats{testTCPKey: {Packets: 100, Bytes: 100000, FirstSeen: 1, LastUpdate: 1999}},
+			opts:     collectOptions{Interval: 1},
+			want:     map[FlowKey]want{testTCPKey: {50, 50000}},
+			wantNext: []FlowKey{testTCPKey},
+		},
+		{
+			name:       "recreated entry is a counter reset",
+			flows:      map[FlowKey]FlowStats{testTCPKey: {Packets: 3, Bytes: 300, FirstSeen: 1200, LastUpdate: 1300}},
+			last:       map[FlowKey]FlowStats{testTCPKey: {Packets: 90, Bytes: 9000, FirstSeen: 100, LastUpdate: 900}},
+			opts:       collectOptions{Interval: 1},
+			want:       map[FlowKey]want{testTCPKey: {3, 300}},
+			wantNext:   []FlowKey{testTCPKey},
+			wantResets: 1,
+		},
+		{
+			name: "filter drops other traffic types and does not track them",
+			flows: map[FlowKey]FlowStats{
+				testRoCEKey: {Packets: 1, Bytes: 100, FirstSeen: 1500, LastUpdate: 1500},
+				testTCPKey:  {Packets: 1, Bytes: 100, FirstSeen: 1500, LastUpdate: 1500},
+			},
+			opts:     collectOptions{Filter: "roce", Interval: 1},
+			want:     map[FlowKey]want{testRoCEKey: {1, 100}},
+			wantNext: []FlowKey{testRoCEKey},
+		},
+		{
+			name: "exclude DNS",
+			flows: map[FlowKey]FlowStats{
+				testDNSKey: {Packets: 1, Bytes: 80, FirstSeen: 1500, LastUpdate: 1500},
+				testTCPKey: {Packets: 1, Bytes: 100, FirstSeen: 1500, LastUpdate: 1500},
+			},
+			opts:     collectOptions{ExcludeDNS: true, Interval: 1},
+			want:     map[FlowKey]want{testTCPKey: {1, 100}},
+			wantNext: []FlowKey{testTCPKey},
+		},
+		{
+			name:            "unparsed packets are counted but not exported",
+			flows:           map[FlowKey]FlowStats{testBadKey: {Packets: 7, Bytes: 420, FirstSeen: 100, LastUpdate: 1800}},
+			last:            map[FlowKey]FlowStats{testBadKey: {Packets: 4, Bytes: 240, FirstSeen: 100, LastUpdate: 900}},
+			opts:            collectOptions{Interval: 1},
+			want:            map[FlowKey]want{},
+			wantNext:        []FlowKey{testBadKey},
+			wantUnparsedPkt: 3,
+			wantUnparsedB:   180,
+		},
+		{
+			name:     "flows deleted from the map are forgotten",
+			flows:    map[FlowKey]FlowStats{},
+			last:     map[FlowKey]FlowStats{testTCPKey: {Packets: 1, Bytes: 100, FirstSeen: 100, LastUpdate: 100}},
+			opts:     collectOptions{Interval: 1},
+			want:     map[FlowKey]want{},
+			wantNext: nil,
+		},
+		{
+			name: "NIC rates aggregate ports of the same IP pair",
+			flows: map[FlowKey]FlowStats{
+				testTCPKey: {Packets: 1, Bytes: 100, FirstSeen: 1500, LastUpdate: 1500},
+				{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: 0x5100, DstPort: 0x5000, Proto: 6}: {Packets: 1, Bytes: 100, FirstSeen: 1500, LastUpdate: 1500},
+			},
+			opts: collectOptions{Interval: 1, NICRates: true},
+			want: map[FlowKey]want{
+				testTCPKey: {1, 100},
+				{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: 0x5100, DstPort: 0x5000, Proto: 6}: {1, 100},
+			},
+			wantNext: []FlowKey{testTCPKey, {SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: 0x5100, DstPort: 0x5000, Proto: 6}},
+			wantNICs: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			epoch := time.Unix(1700000000, 0)
+			tt.opts.WindowStart = windowStart
+			tt.opts.Epoch = epoch
+			last := tt.last
+			if last == nil {
+				last = map[FlowKey]FlowStats{}
+			}
+
+			snap, next := collectFlows("ib0", tt.flows, last, tt.opts)
+
+			if snap.Interface != "ib0" || !snap.Epoch.Equal(epoch) {
+				t.Errorf("snapshot = %s@%v, want ib0@%v", snap.Interface, snap.Epoch, epoch)
+			}
+			if snap.MapEntries != len(tt.flows) {
+				t.Errorf("MapEntries = %d, want %d", snap.MapEntries, len(tt.flows))
+			}
+			if len(snap.Flows) != len(tt.want) {
+				t.Fatalf("got %d flows, want %d: %+v", len(snap.Flows), len(tt.want), snap.Flows)
+			}
+			for _, f := range snap.Flows {
+				w, ok := tt.want[f.Key]
+				if !ok {
+					t.Errorf("unexpected flow %+v", f.Key)
+					continue
+				}
+				if f.DeltaPackets != w.packets || f.DeltaBytes != w.bytes {
+					t.Errorf("%+v: delta = %d packets / %d bytes, want %d / %d", f.Key, f.DeltaPackets, f.DeltaBytes, w.packets, w.bytes)
+				}
+				if wantRate := float64(w.bytes) / tt.opts.Interval; math.Abs(f.BytesPerSec-wantRate) > 1e-9 || f.BitsPerSec != f.BytesPerSec*8 {
+					t.Errorf("%+v: rate = %v B/s %v b/s, want %v B/s", f.Key, f.BytesPerSec, f.BitsPerSec, wantRate)
+				}
+				if f.Interface != "ib0" || !f.Timestamp.Equal(epoch) || f.TrafficType != f.Key.GetTrafficType() {
+					t.Errorf("%+v: sample metadata = %s %v %s", f.Key, f.Interface, f.Timestamp, f.TrafficType)
+				}
+			}
+
+			if len(next) != len(tt.wantNext) {
+				t.Errorf("next has %d flows, want %d", len(next), len(tt.wantNext))
+			}
+			for _, k := range tt.wantNext {
+				if next[k] != tt.flows[k] {
+					t.Errorf("next[%+v] = %+v, want %+v", k, next[k], tt.flows[k])
+				}
+			}
+			if snap.Resets != tt.wantResets {
+				t.Errorf("Resets = %d, want %d", snap.Resets, tt.wantResets)
+			}
+			if snap.UnparsedPackets != tt.wantUnparsedPkt || snap.UnparsedBytes != tt.wantUnparsedB {
+				t.Errorf("unparsed = %d packets / %d bytes, want %d / %d",
+					snap.UnparsedPackets, snap.UnparsedBytes, tt.wantUnparsedPkt, tt.wantUnparsedB)
+			}
+			if len(snap.NICs) != tt.wantNICs {
+				t.Errorf("got %d NIC entries, want %d", len(snap.NICs), tt.wantNICs)
+			}
+		})
+	}
+}
+
+// 合成流量经过多个采集周期：每个周期的增量等于生成器的每周期流量
+func TestCollectFlowsSyntheticSource(t *testing.T) {
+	src := newSyntheticSource([]syntheticFlow{
+		{Key: testRoCEKey, Packets: 100, Bytes: 409600},
+		{Key: testTCPKey, Packets: 10, Bytes: 15000},
+		{Key: testBadKey, Packets: 1, Bytes: 60},
+	})
+	var clock uint64 = 1000
+	src.now = func() uint64 { return clock }
+
+	last := map[FlowKey]FlowStats{}
+	windowStart := uint64(0)
+	for tick := 0; tick < 5; tick++ {
+		clock += 1000
+		flows, err := src.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var snap ifaceSnapshot
+		snap, last = collectFlows("ib0", flows, last, collectOptions{
+			Filter:      "all",
+			WindowStart: windowStart,
+			Interval:    0.5,
+			NICRates:    true,
+		})
+		windowStart = clock
+
+		sort.Slice(snap.Flows, func(i, j int) bool { return snap.Flows[i].DeltaBytes > snap.Flows[j].DeltaBytes })
+		if len(snap.Flows) != 2 {
+			t.Fatalf("tick %d: got %d flows, want 2", tick, len(snap.Flows))
+		}
+		if got := snap.Flows[0]; got.Key != testRoCEKey || got.DeltaPackets != 100 || got.DeltaBytes != 409600 || got.BytesPerSec != 819200 {
+			t.Errorf("tick %d: RoCE sample = %+v", tick, got)
+		}
+		if got := snap.Flows[1]; got.Key != testTCPKey || got.DeltaPackets != 10 || got.DeltaBytes != 15000 {
+			t.Errorf("tick %d: TCP sample = %+v", tick, got)
+		}
+		if snap.UnparsedPackets != 1 || snap.UnparsedBytes != 60 {
+			t.Errorf("tick %d: unparsed = %d / %d, want 1 / 60", tick, snap.UnparsedPackets, snap.UnparsedBytes)
+		}
+		if snap.Resets != 0 {
+			t.Errorf("tick %d: %d resets", tick, snap.Resets)
+		}
+	}
+}
+
+// 大象流：连续 Ticks 个周期超过速率阈值或接口带宽占比，中间低于阈值时重新计数
+func TestCollectFlowsElephants(t *testing.T) {
+	// 每个周期 1 秒，RoCE 流各周期的字节数（即 bytes/s）
+	rates := []uint64{2000, 2000, 500, 2000, 2000, 2000, 2000}
+
+	tests := []struct {
+		name      string
+		rule      elephantRule
+		link      float64 // 接口带宽 bytes/s
+		wantTicks []int
+	}{
+		{
+			name:      "rate threshold",
+			rule:      elephantRule{BytesPerSec: 1000, Ticks: 3},
+			wantTicks: []int{1, 2, 0, 1, 2, 3, 4},
+		},
+		{
+			name:      "link share",
+			rule:      elephantRule{LinkShare: 0.5, Ticks: 3},
+			link:      3000,
+			wantTicks: []int{1, 2, 0, 1, 2, 3, 4},
+		},
+		{
+			name:      "link share with unknown link speed",
+			rule:      elephantRule{LinkShare: 0.5, Ticks: 3},
+			wantTicks: []int{0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:      "disabled",
+			rule:      elephantRule{Ticks: 3},
+			link:      3000,
+			wantTicks: []int{0, 0, 0, 0, 0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newElephantTracker()
+			last := map[FlowKey]FlowStats{}
+			var cum FlowStats
+			for tick, rate := range rates {
+				cum.Packets += rate / 100
+				cum.Bytes += rate
+				cum.FirstSeen, cum.LastUpdate = 1, uint64(tick+1)*1000
+				flows := map[FlowKey]FlowStats{
+					testRoCEKey: cum,
+					testTCPKey:  {Packets: uint64(tick + 1), Bytes: uint64(tick+1) * 100, FirstSeen: 1, LastUpdate: uint64(tick+1) * 1000},
+				}
+
+				var snap ifaceSnapshot
+				snap, last = collectFlows("ib0", flows, last, collectOptions{
+					Filter:          "all",
+					WindowStart:     uint64(tick) * 1000,
+					Interval:        1,
+					Elephant:        tt.rule,
+					LinkBytesPerSec: tt.link,
+					Elephants:       tracker,
+				})
+
+				for _, s := range snap.Flows {
+					want := 0
+					if s.Key == testRoCEKey {
+						want = tt.wantTicks[tick]
+					}
+					if s.ElephantTicks != want {
+						t.Errorf("tick %d %s: ElephantTicks = %d, want %d", tick, s.TrafficType, s.ElephantTicks, want)
+					}
+					if s.Elephant != (want >= 3) || s.NewElephant != (want == 3) {
+						t.Errorf("tick %d %s: Elephant = %v, NewElephant = %v", tick, s.TrafficType, s.Elephant, s.NewElephant)
+					}
+					if wantShare := float64(s.DeltaBytes) / tt.link; tt.link > 0 && math.Abs(s.LinkShare-wantShare) > 1e-9 {
+						t.Errorf("tick %d %s: LinkShare = %v, want %v", tick, s.TrafficType, s.LinkShare, wantShare)
+					}
+				}
+			}
+
+			// 流从 map 中消失后重新计数
+			snap, _ := collectFlows("ib0", map[FlowKey]FlowStats{}, last, collectOptions{Elephant: tt.rule, Elephants: tracker})
+			if len(snap.Flows) != 0 || len(tracker.streaks) != 0 {
+				t.Errorf("streaks not cleared: %v", tracker.streaks)
+			}
+		})
+	}
+}
+
+func TestElephantTrackerRollback(t *testing.T) {
+	tracker := newElephantTracker()
+	tracker.observe(testRoCEKey, true)
+	tracker.commit()
+	tracker.observe(testRoCEKey, true)
+	tracker.commit()
+
+	// 第二个周期的快照没有被导出：撤销后重新计算，连续计数不会重复累加
+	tracker.rollback()
+	if n := tracker.observe(testRoCEKey, true); n != 2 {
+		t.Errorf("streak after rollback = %d, want 2", n)
+	}
+	tracker.commit()
+	if n := tracker.observe(testRoCEKey, true); n != 3 {
+		t.Errorf("streak = %d, want 3", n)
+	}
+}
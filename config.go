@@ -0,0 +1,576 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 配置文件结构（YAML / TOML）
+// 优先级：命令行参数 > 环境变量 > 配置文件 > 默认值
+type Config struct {
+	Interfaces    []string         `yaml:"interfaces" toml:"interfaces"`
+	OnAttachError string           `yaml:"on_attach_error" toml:"on_attach_error"`
+	Filter        string           `yaml:"filter" toml:"filter"`
+	ExcludeDNS    bool             `yaml:"exclude_dns" toml:"exclude_dns"`
+	IntervalMs    int              `yaml:"interval_ms" toml:"interval_ms"`
+	Output        string           `yaml:"output" toml:"output"`
+	TUI           bool             `yaml:"tui" toml:"tui"`
+	TopFlows      int              `yaml:"top_flows" toml:"top_flows"`
+	FlowMetrics   bool             `yaml:"flow_metrics" toml:"flow_metrics"`
+	Aggregate     []string         `yaml:"aggregate" toml:"aggregate"`
+	Conversations string           `yaml:"conversations" toml:"conversations"`
+	FlowEvents    FlowEventsConfig `yaml:"flow_events" toml:"flow_events"`
+	Elephant      ElephantConfig   `yaml:"elephant" toml:"elephant"`
+	BurstSlotUs   int              `yaml:"burst_slot_us" toml:"burst_slot_us"`
+	Pin           bool             `yaml:"pin" toml:"pin"`
+	PinPath       string           `yaml:"pin_path" toml:"pin_path"`
+	Labels        LabelsConfig     `yaml:"labels" toml:"labels"`
+	Health        HealthConfig     `yaml:"health" toml:"health"`
+	Exporters     ExportersConfig  `yaml:"exporters" toml:"exporters"`
+}
+
+// HealthConfig 健康检查 HTTP 服务
+type HealthConfig struct {
+	Listen string `yaml:"listen" toml:"listen"` // 监听地址，为空时关闭
+	Pprof  bool   `yaml:"pprof" toml:"pprof"`   // 启用 /debug/pprof
+}
+
+// FlowEventsConfig 流生命周期事件
+type FlowEventsConfig struct {
+	Target        string `yaml:"target" toml:"target"`                   // stdout、文件路径或 http(s):// webhook，为空时关闭
+	IdleTimeoutMs int    `yaml:"idle_timeout_ms" toml:"idle_timeout_ms"` // 超过该时间没有新数据包时流结束
+}
+
+// ElephantConfig 大象流检测（速率阈值和带宽占比都为 0 时关闭）
+type ElephantConfig struct {
+	RateMbps         int     `yaml:"rate_mbps" toml:"rate_mbps"`                   // 速率阈值（Mbit/s）
+	LinkSharePercent float64 `yaml:"link_share_percent" toml:"link_share_percent"` // 占接口带宽的百分比
+	Ticks            int     `yaml:"ticks" toml:"ticks"`                           // 连续超过阈值的采集周期数
+	LinkSpeedMbps    int     `yaml:"link_speed_mbps" toml:"link_speed_mbps"`       // 接口带宽，0 表示从 sysfs 读取
+}
+
+// LabelsConfig 附加到所有导出数据上的标签
+type LabelsConfig struct {
+	CollectAgg string            `yaml:"collect_agg" toml:"collect_agg"` // 算网标签
+	Static     map[string]string `yaml:"static" toml:"static"`           // 额外的静态标签，例如 region、cluster
+}
+
+// ExportersConfig 各导出器配置
+type ExportersConfig struct {
+	VictoriaMetrics VictoriaMetricsConfig `yaml:"victoriametrics" toml:"victoriametrics"`
+	OTLP            OTLPConfig            `yaml:"otlp" toml:"otlp"`
+	InfluxDB        InfluxDBConfig        `yaml:"influxdb" toml:"influxdb"`
+	IPFIX           IPFIXConfig           `yaml:"ipfix" toml:"ipfix"`
+}
+
+type VictoriaMetricsConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	URL     string `yaml:"url" toml:"url"`
+}
+
+type OTLPConfig struct {
+	Enabled  bool   `yaml:"enabled" toml:"enabled"`
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	Protocol string `yaml:"protocol" toml:"protocol"`
+}
+
+type InfluxDBConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	URL     string `yaml:"url" toml:"url"`
+	Token   string `yaml:"token" toml:"token"`
+	Org     string `yaml:"org" toml:"org"`
+	Bucket  string `yaml:"bucket" toml:"bucket"`
+}
+
+type IPFIXConfig struct {
+	Enabled           bool   `yaml:"enabled" toml:"enabled"`
+	Collector         string `yaml:"collector" toml:"collector"`
+	Version           string `yaml:"version" toml:"version"`
+	ObservationDomain uint32 `yaml:"observation_domain" toml:"observation_domain"`
+	EnterpriseID      uint32 `yaml:"enterprise_id" toml:"enterprise_id"`
+}
+
+// 配置相关的全局状态
+var (
+	configPath         string        // --config 指定的配置文件路径
+	activeConfig       *Config       // 当前生效的配置
+	applyFlagOverrides func(*Config) // 将命令行显式指定的参数覆盖到配置上（热加载时重复使用）
+	settingsMu         sync.RWMutex  // 保护可热加载的运行时设置（过滤、间隔、输出格式等）
+	trafficFilter      string        // 流量过滤类型
+	excludeDNSTraffic  bool          // 是否排除 DNS 流量
+	collectIntervalMs  int           // 采集间隔（毫秒）
+	staticLabels       map[string]string
+)
+
+// 默认配置
+func defaultConfig() *Config {
+	return &Config{
+		Interfaces:    []string{"eth0"},
+		OnAttachError: attachErrorSkip,
+		Filter:        "all",
+		IntervalMs:    5000,
+		Output:        outputText,
+		FlowMetrics:   true,
+		PinPath:       defaultPinPath,
+		Labels:        LabelsConfig{CollectAgg: "default"},
+		Health:        HealthConfig{Listen: defaultHealthListen},
+		FlowEvents:    FlowEventsConfig{IdleTimeoutMs: defaultFlowIdleTimeoutMs},
+		Elephant:      ElephantConfig{Ticks: defaultElephantTicks},
+	}
+}
+
+// 读取配置文件（按扩展名区分 YAML / TOML），未知字段视为错误
+func loadConfigFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("解析 YAML 配置失败: %w", err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("解析 TOML 配置失败: %w", err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return fmt.Errorf("解析 TOML 配置失败: 未知字段 %s", strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s（可选: .yaml, .yml, .toml）", path)
+	}
+	return nil
+}
+
+// 环境变量是否设置为启用
+func envEnabled(name string) (enabled bool, set bool) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return false, false
+	}
+	return v == "true" || v == "1", true
+}
+
+// 将环境变量覆盖到配置上（仅覆盖已设置的变量）
+func applyEnvOverrides(cfg *Config) {
+	setStr := func(dst *string, name string) {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	setBool := func(dst *bool, name string) {
+		if v, ok := envEnabled(name); ok {
+			*dst = v
+		}
+	}
+	setInt := func(dst *int, name string) {
+		if v := os.Getenv(name); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				*dst = n
+			} else {
+				log.Printf("警告: 忽略无效的环境变量 %s=%s", name, v)
+			}
+		}
+	}
+	setFloat := func(dst *float64, name string) {
+		if v := os.Getenv(name); v != "" {
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				*dst = n
+			} else {
+				log.Printf("警告: 忽略无效的环境变量 %s=%s", name, v)
+			}
+		}
+	}
+	setUint32 := func(dst *uint32, name string) {
+		if v := os.Getenv(name); v != "" {
+			if n, err := strconv.ParseUint(v, 10, 32); err == nil {
+				*dst = uint32(n)
+			} else {
+				log.Printf("警告: 忽略无效的环境变量 %s=%s", name, v)
+			}
+		}
+	}
+
+	if v := os.Getenv("NETWORK_INTERFACE"); v != "" {
+		cfg.Interfaces = parseInterfaceList(v)
+	}
+	setStr(&cfg.OnAttachError, "ON_ATTACH_ERROR")
+	setStr(&cfg.Labels.CollectAgg, "COLLECT_AGG")
+	if v, ok := os.LookupEnv("HEALTH_LISTEN"); ok {
+		cfg.Health.Listen = v // 允许设置为空以关闭
+	}
+	setBool(&cfg.Health.Pprof, "PPROF_ENABLED")
+	setStr(&cfg.FlowEvents.Target, "FLOW_EVENTS")
+	setInt(&cfg.FlowEvents.IdleTimeoutMs, "FLOW_IDLE_TIMEOUT_MS")
+	setInt(&cfg.Elephant.RateMbps, "ELEPHANT_RATE_MBPS")
+	setFloat(&cfg.Elephant.LinkSharePercent, "ELEPHANT_LINK_SHARE")
+	setInt(&cfg.Elephant.Ticks, "ELEPHANT_TICKS")
+	setInt(&cfg.Elephant.LinkSpeedMbps, "LINK_SPEED_MBPS")
+	setInt(&cfg.BurstSlotUs, "BURST_SLOT_US")
+
+	vm := &cfg.Exporters.VictoriaMetrics
+	setBool(&vm.Enabled, "VICTORIAMETRICS_ENABLED")
+	setStr(&vm.URL, "VICTORIAMETRICS_REMOTE_WRITE")
+
+	otlp := &cfg.Exporters.OTLP
+	setBool(&otlp.Enabled, "OTLP_ENABLED")
+	setStr(&otlp.Endpoint, "OTLP_ENDPOINT")
+	setStr(&otlp.Protocol, "OTLP_PROTOCOL")
+
+	influx := &cfg.Exporters.InfluxDB
+	setBool(&influx.Enabled, "INFLUXDB_ENABLED")
+	setStr(&influx.URL, "INFLUXDB_URL")
+	setStr(&influx.Token, "INFLUXDB_TOKEN")
+	setStr(&influx.Org, "INFLUXDB_ORG")
+	setStr(&influx.Bucket, "INFLUXDB_BUCKET")
+
+	ipfix := &cfg.Exporters.IPFIX
+	setBool(&ipfix.Enabled, "IPFIX_ENABLED")
+	setStr(&ipfix.Collector, "IPFIX_COLLECTOR")
+	setStr(&ipfix.Version, "IPFIX_VERSION")
+	setUint32(&ipfix.ObservationDomain, "IPFIX_OBSERVATION_DOMAIN")
+	setUint32(&ipfix.EnterpriseID, "IPFIX_ENTERPRISE_ID")
+}
+
+// 按优先级组装完整配置：默认值 -> 配置文件 -> 环境变量 -> 命令行参数
+func buildConfig() (*Config, error) {
+	cfg := defaultConfig()
+	if configPath != "" {
+		if err := loadConfigFile(cfg, configPath); err != nil {
+			return nil, err
+		}
+	}
+	applyEnvOverrides(cfg)
+	if applyFlagOverrides != nil {
+		applyFlagOverrides(cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// 导出数据已经使用的标签名，静态标签不能与之重复
+var reservedLabelNames = map[string]bool{
+	"src_ip": true, "dst_ip": true, "src_port": true, "dst_port": true,
+	"src_subnet": true, "dst_subnet": true, "protocol": true, "traffic_type": true,
+	"interface": true, "host_ip": true, "collect_agg": true,
+	"ip_a": true, "ip_b": true, "port_a": true, "port_b": true, "direction": true,
+}
+
+// 配置校验
+func (c *Config) validate() error {
+	if len(c.Interfaces) == 0 {
+		return fmt.Errorf("interfaces: 未指定有效的网络接口")
+	}
+	for _, iface := range c.Interfaces {
+		if strings.TrimSpace(iface) == "" || strings.Contains(iface, ",") {
+			return fmt.Errorf("interfaces: 无效的接口名 %q", iface)
+		}
+		if err := validateInterfacePattern(iface); err != nil {
+			return fmt.Errorf("interfaces: %w", err)
+		}
+	}
+
+	if !validAttachErrorPolicy(c.OnAttachError) {
+		return fmt.Errorf("on_attach_error: 不支持的策略 %s（可选: fail, skip, retry）", c.OnAttachError)
+	}
+
+	switch c.Filter {
+	case "", "all", "roce", "roce_v1", "roce_v2", "tcp", "udp", "ib":
+	default:
+		return fmt.Errorf("filter: 不支持的流量类型 %s（可选: roce, roce_v1, roce_v2, tcp, udp, ib, all）", c.Filter)
+	}
+
+	if c.IntervalMs < 100 {
+		return fmt.Errorf("interval_ms: 间隔时间必须大于等于100毫秒")
+	}
+	if c.IntervalMs > 3600000 {
+		return fmt.Errorf("interval_ms: 间隔时间不能超过3600000毫秒（1小时）")
+	}
+
+	if !validOutputFormat(c.Output) {
+		return fmt.Errorf("output: 不支持的输出格式 %s（可选: text, json, csv）", c.Output)
+	}
+	if c.TopFlows < 0 {
+		return fmt.Errorf("top_flows: 不能为负数")
+	}
+	if _, err := parseAggLevels(c.Aggregate); err != nil {
+		return fmt.Errorf("aggregate: %w", err)
+	}
+	if !validConversationMode(c.Conversations) {
+		return fmt.Errorf("conversations: 不支持的合并粒度 %s（可选: ip, port，为空时不合并）", c.Conversations)
+	}
+	if c.FlowEvents.Target != "" {
+		if c.FlowEvents.IdleTimeoutMs < c.IntervalMs {
+			return fmt.Errorf("flow_events.idle_timeout_ms: 不能小于采集间隔 %dms", c.IntervalMs)
+		}
+		if c.FlowEvents.Target == flowEventsStdout && c.TUI {
+			return fmt.Errorf("flow_events.target: 终端界面模式下不能输出到 stdout")
+		}
+	}
+	if c.Elephant.RateMbps < 0 {
+		return fmt.Errorf("elephant.rate_mbps: 不能为负数")
+	}
+	if c.Elephant.LinkSharePercent < 0 || c.Elephant.LinkSharePercent > 100 {
+		return fmt.Errorf("elephant.link_share_percent: 必须在 0-100 之间")
+	}
+	if c.Elephant.Ticks < 1 {
+		return fmt.Errorf("elephant.ticks: 必须大于等于1")
+	}
+	if c.Elephant.LinkSpeedMbps < 0 {
+		return fmt.Errorf("elephant.link_speed_mbps: 不能为负数")
+	}
+	if c.BurstSlotUs != 0 {
+		if c.BurstSlotUs < minBurstSlotUs || c.BurstSlotUs > maxBurstSlotUs {
+			return fmt.Errorf("burst_slot_us: 必须在 %d-%d 微秒之间（0 表示关闭）", minBurstSlotUs, maxBurstSlotUs)
+		}
+		if c.BurstSlotUs >= c.IntervalMs*1000 {
+			return fmt.Errorf("burst_slot_us: 必须小于采集间隔 %dms", c.IntervalMs)
+		}
+	}
+	if c.Pin && !filepath.IsAbs(c.PinPath) {
+		return fmt.Errorf("pin_path: 必须是 bpffs 下的绝对路径: %s", c.PinPath)
+	}
+
+	if c.Labels.CollectAgg == "" {
+		return fmt.Errorf("labels.collect_agg: 不能为空")
+	}
+	for name := range c.Labels.Static {
+		if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("labels.static: 无效的标签名 %s", name)
+		}
+		if reservedLabelNames[name] {
+			return fmt.Errorf("labels.static: 标签名 %s 与内置标签冲突", name)
+		}
+	}
+
+	if c.Health.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Health.Listen); err != nil {
+			return fmt.Errorf("health.listen: 无效的监听地址 %s: %w", c.Health.Listen, err)
+		}
+	} else if c.Health.Pprof {
+		return fmt.Errorf("health.pprof: 需要同时设置 health.listen")
+	}
+
+	switch strings.ToLower(c.Exporters.OTLP.Protocol) {
+	case "", "http", "grpc":
+	default:
+		return fmt.Errorf("exporters.otlp.protocol: 不支持的协议 %s（可选: http, grpc）", c.Exporters.OTLP.Protocol)
+	}
+	switch strings.ToLower(c.Exporters.IPFIX.Version) {
+	case "", "ipfix", "10", "netflow9", "netflow", "v9", "9":
+	default:
+		return fmt.Errorf("exporters.ipfix.version: 不支持的版本 %s（可选: ipfix, netflow9）", c.Exporters.IPFIX.Version)
+	}
+	return nil
+}
+
+// 应用启动配置：设置运行时参数并初始化各导出器
+func applyStartupConfig(cfg *Config) {
+	applyRuntimeSettings(cfg)
+
+	tuiEnabled = cfg.TUI
+	onAttachError = cfg.OnAttachError
+	pinEnabled = cfg.Pin
+	pinPath = cfg.PinPath
+	aggLevels, _ = parseAggLevels(cfg.Aggregate) // 已在 validate 中校验
+	conversationMode = cfg.Conversations
+	burstSlot = time.Duration(cfg.BurstSlotUs) * time.Microsecond
+	if cfg.FlowEvents.Target != "" {
+		idleTimeout := time.Duration(cfg.FlowEvents.IdleTimeoutMs) * time.Millisecond
+		if err := initFlowEvents(cfg.FlowEvents.Target, idleTimeout); err != nil {
+			log.Fatalf("初始化流事件输出失败: %v", err)
+		}
+	}
+	staticLabels = cfg.Labels.Static
+
+	if !flowMetricsEnabled && len(aggLevels) == 0 {
+		log.Printf("警告: 已关闭流级别指标且未配置聚合层级，仅导出 NIC 指标")
+	}
+
+	exp := cfg.Exporters
+	metricsEnabled = exp.VictoriaMetrics.Enabled
+	if metricsEnabled {
+		url := exp.VictoriaMetrics.URL
+		if url == "" {
+			url = "http://localhost:8428/api/v1/import/prometheus" // 默认 VictoriaMetrics URL
+		}
+		initVictoriaMetrics(url)
+	}
+	if exp.OTLP.Enabled {
+		if err := initOTLPExporter(exp.OTLP.Endpoint, exp.OTLP.Protocol); err != nil {
+			log.Fatalf("初始化 OTLP 导出器失败: %v", err)
+		}
+	}
+	if exp.InfluxDB.Enabled {
+		if err := initInfluxExporter(exp.InfluxDB.URL, exp.InfluxDB.Token, exp.InfluxDB.Org, exp.InfluxDB.Bucket); err != nil {
+			log.Fatalf("初始化 InfluxDB 导出器失败: %v", err)
+		}
+	}
+	if exp.IPFIX.Enabled {
+		domainID, enterpriseID := "", ""
+		if exp.IPFIX.ObservationDomain != 0 {
+			domainID = strconv.FormatUint(uint64(exp.IPFIX.ObservationDomain), 10)
+		}
+		if exp.IPFIX.EnterpriseID != 0 {
+			enterpriseID = strconv.FormatUint(uint64(exp.IPFIX.EnterpriseID), 10)
+		}
+		if err := initIPFIXExporter(exp.IPFIX.Collector, exp.IPFIX.Version, domainID, enterpriseID); err != nil {
+			log.Fatalf("初始化 IPFIX 导出器失败: %v", err)
+		}
+	}
+
+	// 程序自身运行状态 metrics（推送到 VictoriaMetrics，并由健康检查服务的 /metrics 提供）
+	if pushEnabled() || cfg.Health.Listen != "" {
+		initAgentMetrics()
+	}
+
+	// 健康检查服务（/healthz、/readyz、/metrics、/debug/pprof）
+	if cfg.Health.Listen != "" {
+		if err := initHealthServer(cfg.Health.Listen, cfg.Health.Pprof, cfg.Interfaces); err != nil {
+			log.Fatalf("启动健康检查服务失败: %v", err)
+		}
+	}
+
+	activeConfig = cfg
+}
+
+// 设置可热加载的运行时参数（调用方需持有 settingsMu 写锁，启动时除外）
+func applyRuntimeSettings(cfg *Config) {
+	trafficFilter = cfg.Filter
+	excludeDNSTraffic = cfg.ExcludeDNS
+	collectIntervalMs = cfg.IntervalMs
+	outputFormat = cfg.Output
+	topFlows = cfg.TopFlows
+	flowMetricsEnabled = cfg.FlowMetrics
+	setCollectAgg(cfg.Labels.CollectAgg)
+	elephantSettings = newElephantRule(cfg.Elephant)
+}
+
+// 收到 SIGHUP 时重新加载配置
+// 过滤条件、采集间隔、输出格式、Top-N、流级别指标开关、大象流阈值和算网标签立即生效；
+// 接口列表、挂载失败策略、TUI、聚合层级、会话合并、流事件、固定设置、静态标签和导出器配置需要重启（XDP 程序不会被卸载）
+func reloadConfig() {
+	if configPath == "" {
+		log.Printf("收到 SIGHUP，但未指定配置文件（--config），忽略")
+		return
+	}
+
+	cfg, err := buildConfig()
+	if err != nil {
+		log.Printf("重新加载配置失败，继续使用当前配置: %v", err)
+		return
+	}
+
+	old := activeConfig
+	var changed, needRestart []string
+	diff := func(name string, a, b interface{}, hot bool) {
+		if reflect.DeepEqual(a, b) {
+			return
+		}
+		if hot {
+			changed = append(changed, name)
+		} else {
+			needRestart = append(needRestart, name)
+		}
+	}
+	diff("filter", old.Filter, cfg.Filter, true)
+	diff("exclude_dns", old.ExcludeDNS, cfg.ExcludeDNS, true)
+	diff("interval_ms", old.IntervalMs, cfg.IntervalMs, true)
+	diff("output", old.Output, cfg.Output, true)
+	diff("top_flows", old.TopFlows, cfg.TopFlows, true)
+	diff("flow_metrics", old.FlowMetrics, cfg.FlowMetrics, true)
+	diff("elephant", old.Elephant, cfg.Elephant, true)
+	diff("labels.collect_agg", old.Labels.CollectAgg, cfg.Labels.CollectAgg, true)
+	diff("interfaces", old.Interfaces, cfg.Interfaces, false)
+	diff("on_attach_error", old.OnAttachError, cfg.OnAttachError, false)
+	diff("tui", old.TUI, cfg.TUI, false)
+	diff("aggregate", old.Aggregate, cfg.Aggregate, false)
+	diff("conversations", old.Conversations, cfg.Conversations, false)
+	diff("flow_events", old.FlowEvents, cfg.FlowEvents, false)
+	diff("burst_slot_us", old.BurstSlotUs, cfg.BurstSlotUs, false)
+	diff("pin", old.Pin, cfg.Pin, false)
+	diff("pin_path", old.PinPath, cfg.PinPath, false)
+	diff("labels.static", old.Labels.Static, cfg.Labels.Static, false)
+	diff("health", old.Health, cfg.Health, false)
+	diff("exporters.victoriametrics", old.Exporters.VictoriaMetrics, cfg.Exporters.VictoriaMetrics, false)
+	diff("exporters.otlp", old.Exporters.OTLP, cfg.Exporters.OTLP, false)
+	diff("exporters.influxdb", old.Exporters.InfluxDB, cfg.Exporters.InfluxDB, false)
+	diff("exporters.ipfix", old.Exporters.IPFIX, cfg.Exporters.IPFIX, false)
+
+	if len(changed) == 0 && len(needRestart) == 0 {
+		log.Printf("配置已重新加载，无变化")
+		return
+	}
+
+	// 只更新可热加载的部分，需要重启的设置保持原值（再次 SIGHUP 时仍会提示）
+	next := *old
+	next.Filter = cfg.Filter
+	next.ExcludeDNS = cfg.ExcludeDNS
+	next.IntervalMs = cfg.IntervalMs
+	next.Output = cfg.Output
+	next.TopFlows = cfg.TopFlows
+	next.FlowMetrics = cfg.FlowMetrics
+	next.Elephant = cfg.Elephant
+	next.Labels.CollectAgg = cfg.Labels.CollectAgg
+
+	settingsMu.Lock()
+	applyRuntimeSettings(&next)
+	settingsMu.Unlock()
+	activeConfig = &next
+
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		log.Printf("配置已重新加载，已生效: %s", strings.Join(changed, ", "))
+	}
+	if len(needRestart) > 0 {
+		sort.Strings(needRestart)
+		log.Printf("以下配置已修改但需要重启才能生效: %s", strings.Join(needRestart, ", "))
+	}
+}
+
+// 按标签名排序的静态标签（key, value 交替），保证各导出器输出稳定
+func sortedStaticLabels() []string {
+	names := make([]string, 0, len(staticLabels))
+	for name := range staticLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	kv := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		kv = append(kv, name, staticLabels[name])
+	}
+	return kv
+}
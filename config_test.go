@@ -0,0 +1,326 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 内容相同的 YAML / TOML 配置
+const testConfigYAML = `
+interfaces: [ib0, "ens*f*np*"]
+on_attach_error: retry
+filter: roce
+interval_ms: 2000
+top_flows: 10
+aggregate:
+  - rack=src_subnet/24
+labels:
+  collect_agg: file-agg
+  static:
+    region: bj
+health:
+  listen: ""
+exporters:
+  otlp:
+    enabled: true
+    protocol: grpc
+    endpoint: otel:4317
+  ipfix:
+    collector: localhost:4739
+    version: netflow9
+    observation_domain: 7
+`
+
+const testConfigTOML = `
+interfaces = ["ib0", "ens*f*np*"]
+on_attach_error = "retry"
+filter = "roce"
+interval_ms = 2000
+top_flows = 10
+aggregate = ["rack=src_subnet/24"]
+
+[labels]
+collect_agg = "file-agg"
+static = { region = "bj" }
+
+[health]
+listen = ""
+
+[exporters.otlp]
+enabled = true
+protocol = "grpc"
+endpoint = "otel:4317"
+
+[exporters.ipfix]
+collector = "localhost:4739"
+version = "netflow9"
+observation_domain = 7
+`
+
+func writeTestConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 测试结束后恢复配置相关的全局状态和运行时设置
+func restoreConfigState(t *testing.T) {
+	oldPath, oldActive, oldFlags := configPath, activeConfig, applyFlagOverrides
+	oldFilter, oldDNS, oldInterval := trafficFilter, excludeDNSTraffic, collectIntervalMs
+	oldOutput, oldTop, oldFlowMetrics := outputFormat, topFlows, flowMetricsEnabled
+	oldElephant, oldAgg := elephantSettings, currentCollectAgg()
+	t.Cleanup(func() {
+		configPath, activeConfig, applyFlagOverrides = oldPath, oldActive, oldFlags
+		trafficFilter, excludeDNSTraffic, collectIntervalMs = oldFilter, oldDNS, oldInterval
+		outputFormat, topFlows, flowMetricsEnabled = oldOutput, oldTop, oldFlowMetrics
+		elephantSettings = oldElephant
+		setCollectAgg(oldAgg)
+	})
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	want := defaultConfig()
+	want.Interfaces = []string{"ib0", "ens*f*np*"}
+	want.OnAttachError = attachErrorRetry
+	want.Filter = "roce"
+	want.IntervalMs = 2000
+	want.TopFlows = 10
+	want.Aggregate = []string{"rack=src_subnet/24"}
+	want.Labels = LabelsConfig{CollectAgg: "file-agg", Static: map[string]string{"region": "bj"}}
+	want.Health.Listen = ""
+	want.Exporters.OTLP = OTLPConfig{Enabled: true, Protocol: "grpc", Endpoint: "otel:4317"}
+	want.Exporters.IPFIX = IPFIXConfig{Collector: "localhost:4739", Version: "netflow9", ObservationDomain: 7}
+
+	for name, content := range map[string]string{
+		"config.yaml": testConfigYAML,
+		"config.yml":  testConfigYAML,
+		"config.toml": testConfigTOML,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			if err := loadConfigFile(cfg, writeTestConfig(t, name, content)); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("got %+v\nwant %+v", cfg, want)
+			}
+			if err := cfg.validate(); err != nil {
+				t.Errorf("validate: %v", err)
+			}
+		})
+	}
+
+	// 空文件保留默认值
+	cfg := defaultConfig()
+	if err := loadConfigFile(cfg, writeTestConfig(t, "empty.yaml", "")); err != nil || !reflect.DeepEqual(cfg, defaultConfig()) {
+		t.Errorf("empty file: err = %v cfg = %+v", err, cfg)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name, content, wantErr string
+	}{
+		{"unknown.yaml", "filter: roce\nintervl_ms: 1000\n", "intervl_ms"},
+		{"unknown.toml", "filter = \"roce\"\n[exporters.otlp]\nenabld = true\n", "exporters.otlp.enabld"},
+		{"type.yaml", "interval_ms: fast\n", "解析 YAML 配置失败"},
+		{"syntax.toml", "filter = roce\n", "解析 TOML 配置失败"},
+		{"config.json", "{}", "不支持的配置文件格式"},
+	}
+	for _, tt := range tests {
+		err := loadConfigFile(defaultConfig(), writeTestConfig(t, tt.name, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := loadConfigFile(defaultConfig(), filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("missing file: no error")
+	}
+}
+
+func TestBuildConfigPrecedence(t *testing.T) {
+	restoreConfigState(t)
+	configPath = writeTestConfig(t, "config.yaml", testConfigYAML)
+
+	// 配置文件 > 默认值；环境变量 > 配置文件；命令行参数 > 环境变量
+	t.Setenv("COLLECT_AGG", "env-agg")
+	t.Setenv("NETWORK_INTERFACE", "eth1,eth2")
+	t.Setenv("OTLP_ENDPOINT", "env-otel:4317")
+	t.Setenv("HEALTH_LISTEN", "127.0.0.1:19435")
+	applyFlagOverrides = func(cfg *Config) {
+		cfg.Interfaces = []string{"ib9"}
+		cfg.Filter = "tcp"
+	}
+
+	cfg, err := buildConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		field     string
+		got, want interface{}
+	}{
+		{"interfaces (flag > env > file)", cfg.Interfaces, []string{"ib9"}},
+		{"filter (flag > file)", cfg.Filter, "tcp"},
+		{"labels.collect_agg (env > file)", cfg.Labels.CollectAgg, "env-agg"},
+		{"exporters.otlp.endpoint (env > file)", cfg.Exporters.OTLP.Endpoint, "env-otel:4317"},
+		{"health.listen (env > file)", cfg.Health.Listen, "127.0.0.1:19435"},
+		{"interval_ms (file > default)", cfg.IntervalMs, 2000},
+		{"exporters.otlp.protocol (file > default)", cfg.Exporters.OTLP.Protocol, "grpc"},
+		{"output (default)", cfg.Output, outputText},
+		{"elephant.ticks (default)", cfg.Elephant.Ticks, defaultElephantTicks},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+		}
+	}
+
+	// 环境变量可以把 health.listen 设置为空
+	t.Setenv("HEALTH_LISTEN", "")
+	if cfg, err := buildConfig(); err != nil || cfg.Health.Listen != "" {
+		t.Errorf("HEALTH_LISTEN=\"\": err = %v listen = %q", err, cfg.Health.Listen)
+	}
+
+	// 合并后的配置仍然要校验
+	t.Setenv("OTLP_PROTOCOL", "thrift")
+	if _, err := buildConfig(); err == nil || !strings.Contains(err.Error(), "exporters.otlp.protocol") {
+		t.Errorf("invalid env override: err = %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string // 为空表示校验通过
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"no interfaces", func(c *Config) { c.Interfaces = nil }, "interfaces"},
+		{"interface with comma", func(c *Config) { c.Interfaces = []string{"ib0,ib1"} }, "interfaces"},
+		{"bad glob", func(c *Config) { c.Interfaces = []string{"ib["} }, "interfaces"},
+		{"attach policy", func(c *Config) { c.OnAttachError = "ignore" }, "on_attach_error"},
+		{"filter", func(c *Config) { c.Filter = "icmp" }, "filter"},
+		{"interval too short", func(c *Config) { c.IntervalMs = 99 }, "interval_ms"},
+		{"interval too long", func(c *Config) { c.IntervalMs = 3600001 }, "interval_ms"},
+		{"output", func(c *Config) { c.Output = "xml" }, "output"},
+		{"top flows", func(c *Config) { c.TopFlows = -1 }, "top_flows"},
+		{"aggregate", func(c *Config) { c.Aggregate = []string{"vlan"} }, "aggregate"},
+		{"conversations", func(c *Config) { c.Conversations = "mac" }, "conversations"},
+		{"flow events idle timeout", func(c *Config) {
+			c.FlowEvents = FlowEventsConfig{Target: flowEventsStdout, IdleTimeoutMs: 1000}
+		}, "flow_events.idle_timeout_ms"},
+		{"flow events stdout with tui", func(c *Config) {
+			c.FlowEvents.Target = flowEventsStdout
+			c.TUI = true
+		}, "flow_events.target"},
+		{"elephant share", func(c *Config) { c.Elephant.LinkSharePercent = 101 }, "elephant.link_share_percent"},
+		{"elephant ticks", func(c *Config) { c.Elephant.Ticks = 0 }, "elephant.ticks"},
+		{"burst slot range", func(c *Config) { c.BurstSlotUs = 1 }, "burst_slot_us"},
+		{"burst slot above interval", func(c *Config) {
+			c.IntervalMs = 100
+			c.BurstSlotUs = 100000
+		}, "burst_slot_us"},
+		{"relative pin path", func(c *Config) {
+			c.Pin = true
+			c.PinPath = "bpf/xtrace"
+		}, "pin_path"},
+		{"empty collect_agg", func(c *Config) { c.Labels.CollectAgg = "" }, "labels.collect_agg"},
+		{"static label name", func(c *Config) { c.Labels.Static = map[string]string{"1zone": "a"} }, "labels.static"},
+		{"reserved static label", func(c *Config) { c.Labels.Static = map[string]string{"host_ip": "a"} }, "labels.static"},
+		{"health listen", func(c *Config) { c.Health.Listen = "9435" }, "health.listen"},
+		{"pprof without listener", func(c *Config) {
+			c.Health = HealthConfig{Pprof: true}
+		}, "health.pprof"},
+		{"otlp protocol", func(c *Config) { c.Exporters.OTLP.Protocol = "thrift" }, "exporters.otlp.protocol"},
+		{"ipfix version", func(c *Config) { c.Exporters.IPFIX.Version = "v5" }, "exporters.ipfix.version"},
+	}
+	for _, tt := range tests {
+		c := defaultConfig()
+		tt.modify(c)
+		err := c.validate()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+			t.Errorf("%s: err = %v, want prefix %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// SIGHUP 热加载：可热加载的设置立即生效，其余设置保持原值并提示需要重启
+func TestReloadConfig(t *testing.T) {
+	restoreConfigState(t)
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	configPath = writeTestConfig(t, "config.yaml", testConfigYAML)
+	applyFlagOverrides = nil
+	cfg, err := buildConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyRuntimeSettings(cfg)
+	activeConfig = cfg
+
+	updated := strings.NewReplacer(
+		"filter: roce", "filter: tcp",
+		"interval_ms: 2000", "interval_ms: 1000",
+		"top_flows: 10", "top_flows: 3\nflow_metrics: false\nelephant:\n  rate_mbps: 100",
+		"collect_agg: file-agg", "collect_agg: new-agg",
+		"interfaces: [ib0, \"ens*f*np*\"]", "interfaces: [ib1]",
+		"region: bj", "region: sh",
+		"endpoint: otel:4317", "endpoint: otel2:4317",
+	).Replace(testConfigYAML)
+	if err := os.WriteFile(configPath, []byte(updated), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig()
+
+	// 立即生效
+	if trafficFilter != "tcp" || collectIntervalMs != 1000 || topFlows != 3 || flowMetricsEnabled ||
+		currentCollectAgg() != "new-agg" || elephantSettings.BytesPerSec != 100e6/8 {
+		t.Errorf("runtime settings = filter %s interval %d top %d flow_metrics %v collect_agg %s elephant %+v",
+			trafficFilter, collectIntervalMs, topFlows, flowMetricsEnabled, currentCollectAgg(), elephantSettings)
+	}
+	next := activeConfig
+	if next.Filter != "tcp" || next.IntervalMs != 1000 || next.Labels.CollectAgg != "new-agg" || next.Elephant.RateMbps != 100 {
+		t.Errorf("active config hot fields = %+v", next)
+	}
+	// 需要重启的设置保持原值
+	if !reflect.DeepEqual(next.Interfaces, cfg.Interfaces) || next.Labels.Static["region"] != "bj" ||
+		next.Exporters.OTLP.Endpoint != "otel:4317" {
+		t.Errorf("restart-only fields changed: interfaces %v static %v otlp %+v",
+			next.Interfaces, next.Labels.Static, next.Exporters.OTLP)
+	}
+	for _, want := range []string{
+		"已生效: elephant, filter, flow_metrics, interval_ms, labels.collect_agg, top_flows",
+		"需要重启才能生效: exporters.otlp, interfaces, labels.static",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log does not contain %q:\n%s", want, logs.String())
+		}
+	}
+
+	// 无效的配置不生效
+	logs.Reset()
+	if err := os.WriteFile(configPath, []byte("interval_ms: 10\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig()
+	if activeConfig != next || collectIntervalMs != 1000 || !strings.Contains(logs.String(), "继续使用当前配置") {
+		t.Errorf("invalid reload applied: interval %d log %s", collectIntervalMs, logs.String())
+	}
+}
@@ -0,0 +1,226 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"math/bits"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 会话合并粒度（--conversations），为空时不合并
+const (
+	conversationsIP   = "ip"   // 按 IP 对和协议合并（RoCE v2 的 UDP 源端口按 QP 选取，两个方向的端口通常不对称）
+	conversationsPort = "port" // 按五元组合并，两个方向的地址和端口互换后视为同一会话
+)
+
+var conversationMode string
+
+// 校验 --conversations
+func validConversationMode(mode string) bool {
+	switch mode {
+	case "", conversationsIP, conversationsPort:
+		return true
+	}
+	return false
+}
+
+// 会话 metrics（--conversations 启用时注册）
+var (
+	conversationBytesRate *prometheus.GaugeVec // 按方向的 bytes/s 速率
+	conversationBitsRate  *prometheus.GaugeVec // 按方向的 bits/s 速率
+	conversationAsymmetry *prometheus.GaugeVec // 两个方向的字节数不对称程度
+)
+
+// 会话的方向标签
+const (
+	directionAToB = "a_to_b"
+	directionBToA = "b_to_a"
+)
+
+// 会话维度标签名（不含 direction/interface/host_ip/collect_agg）
+func conversationLabelNames() []string {
+	if conversationMode == conversationsPort {
+		return []string{"ip_a", "ip_b", "port_a", "port_b", "protocol", "traffic_type"}
+	}
+	return []string{"ip_a", "ip_b", "protocol", "traffic_type"}
+}
+
+// 在 registry 中注册会话 metrics
+func registerConversationMetrics(registry prometheus.Registerer) {
+	labels := append(conversationLabelNames(), "interface", "host_ip", "collect_agg")
+	directional := append([]string{"direction"}, labels...)
+
+	conversationBytesRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xtrace_conversation_bytes_rate",
+			Help: "Bidirectional conversation rate in bytes per second, per direction (endpoint a is the lower address)",
+		},
+		directional,
+	)
+	conversationBitsRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xtrace_conversation_bits_rate",
+			Help: "Bidirectional conversation rate in bits per second, per direction (endpoint a is the lower address)",
+		},
+		directional,
+	)
+	conversationAsymmetry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xtrace_conversation_asymmetry_ratio",
+			Help: "Byte asymmetry of the conversation: |a_to_b - b_to_a| / (a_to_b + b_to_a), 0 = balanced, 1 = one-way",
+		},
+		labels,
+	)
+	registry.MustRegister(conversationBytesRate, conversationBitsRate, conversationAsymmetry)
+}
+
+// 推送后重置会话 Gauge
+func resetConversationMetrics() {
+	if conversationBytesRate != nil {
+		conversationBytesRate.Reset()
+		conversationBitsRate.Reset()
+		conversationAsymmetry.Reset()
+	}
+}
+
+// ConversationKey 合并两个方向后的会话（A 为地址较小的一端，地址相同时按端口）
+type ConversationKey struct {
+	IPA   uint32 // 网络字节序
+	IPB   uint32
+	PortA uint16 // 主机字节序，ip 模式下为 0
+	PortB uint16
+	Proto uint8
+}
+
+// ConversationSample 一个会话在一个采集周期内两个方向的流量
+type ConversationSample struct {
+	Interface       string
+	Key             ConversationKey
+	TrafficType     string
+	PacketsAToB     uint64
+	PacketsBToA     uint64
+	BytesAToB       uint64
+	BytesBToA       uint64
+	BytesPerSecAToB float64
+	BytesPerSecBToA float64
+	Interval        float64
+	Timestamp       time.Time
+}
+
+// Asymmetry 两个方向字节数的不对称程度：0 表示完全对称，1 表示只有单向流量
+func (c *ConversationSample) Asymmetry() float64 {
+	total := c.BytesAToB + c.BytesBToA
+	if total == 0 {
+		return 0
+	}
+	diff := c.BytesAToB - c.BytesBToA
+	if c.BytesBToA > c.BytesAToB {
+		diff = c.BytesBToA - c.BytesAToB
+	}
+	return float64(diff) / float64(total)
+}
+
+// 按数值比较 IPv4 地址（FlowKey 中为网络字节序的原始内存布局）
+func ipLess(a, b uint32) bool {
+	return bits.ReverseBytes32(a) < bits.ReverseBytes32(b)
+}
+
+// 将流样本规范化为会话 key，aToB 表示流的方向为 A -> B
+func conversationKey(mode string, s *FlowSample) (key ConversationKey, aToB bool) {
+	srcIP, dstIP := s.Key.SrcIP, s.Key.DstIP
+	var srcPort, dstPort uint16
+	if mode == conversationsPort {
+		srcPort, dstPort = s.SrcPort, s.DstPort
+	}
+
+	aToB = ipLess(srcIP, dstIP) || (srcIP == dstIP && srcPort <= dstPort)
+	if aToB {
+		return ConversationKey{IPA: srcIP, IPB: dstIP, PortA: srcPort, PortB: dstPort, Proto: s.Key.Proto}, true
+	}
+	return ConversationKey{IPA: dstIP, IPB: srcIP, PortA: dstPort, PortB: srcPort, Proto: s.Key.Proto}, false
+}
+
+// mergeConversations 把同一接口上两个方向的流样本合并为会话（按接口和地址排序）
+func mergeConversations(mode string, flows []FlowSample) []ConversationSample {
+	if mode == "" {
+		return nil
+	}
+
+	type ifaceKey struct {
+		iface string
+		key   ConversationKey
+	}
+	index := make(map[ifaceKey]int)
+	var result []ConversationSample
+	for i := range flows {
+		s := &flows[i]
+		if s.Remainder {
+			continue
+		}
+		key, aToB := conversationKey(mode, s)
+		idx, ok := index[ifaceKey{s.Interface, key}]
+		if !ok {
+			idx = len(result)
+			index[ifaceKey{s.Interface, key}] = idx
+			result = append(result, ConversationSample{
+				Interface:   s.Interface,
+				Key:         key,
+				TrafficType: s.TrafficType,
+				Interval:    s.Interval,
+				Timestamp:   s.Timestamp,
+			})
+		}
+		c := &result[idx]
+		if aToB {
+			c.PacketsAToB += s.DeltaPackets
+			c.BytesAToB += s.DeltaBytes
+			c.BytesPerSecAToB += s.BytesPerSec
+		} else {
+			c.PacketsBToA += s.DeltaPackets
+			c.BytesBToA += s.DeltaBytes
+			c.BytesPerSecBToA += s.BytesPerSec
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		switch {
+		case a.Interface != b.Interface:
+			return a.Interface < b.Interface
+		case a.Key.IPA != b.Key.IPA:
+			return ipLess(a.Key.IPA, b.Key.IPA)
+		case a.Key.IPB != b.Key.IPB:
+			return ipLess(a.Key.IPB, b.Key.IPB)
+		case a.Key.PortA != b.Key.PortA:
+			return a.Key.PortA < b.Key.PortA
+		case a.Key.PortB != b.Key.PortB:
+			return a.Key.PortB < b.Key.PortB
+		}
+		return a.Key.Proto < b.Key.Proto
+	})
+	return result
+}
+
+// 会话维度标签的取值，与 conversationLabelNames 对应
+func (c *ConversationSample) labelValues() []string {
+	values := []string{ipToStr(c.Key.IPA), ipToStr(c.Key.IPB)}
+	if conversationMode == conversationsPort {
+		values = append(values, strconv.Itoa(int(c.Key.PortA)), strconv.Itoa(int(c.Key.PortB)))
+	}
+	return append(values, strconv.Itoa(int(c.Key.Proto)), c.TrafficType)
+}
+
+// UpdateMetrics 更新会话 metrics
+func (c *ConversationSample) UpdateMetrics(hostIP string) {
+	labels := append(c.labelValues(), c.Interface, hostIP, currentCollectAgg())
+	conversationBytesRate.WithLabelValues(append([]string{directionAToB}, labels...)...).Set(c.BytesPerSecAToB)
+	conversationBytesRate.WithLabelValues(append([]string{directionBToA}, labels...)...).Set(c.BytesPerSecBToA)
+	conversationBitsRate.WithLabelValues(append([]string{directionAToB}, labels...)...).Set(c.BytesPerSecAToB * 8)
+	conversationBitsRate.WithLabelValues(append([]string{directionBToA}, labels...)...).Set(c.BytesPerSecBToA * 8)
+	conversationAsymmetry.WithLabelValues(labels...).Set(c.Asymmetry())
+}
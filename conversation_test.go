@@ -0,0 +1,129 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// 构造一个方向的流样本（端口为主机字节序）
+func testConversationFlow(iface string, src, dst uint32, srcPort, dstPort uint16, proto uint8, bytes uint64) FlowSample {
+	key := FlowKey{SrcIP: src, DstIP: dst, Proto: proto}
+	return FlowSample{
+		Interface:    iface,
+		Key:          key,
+		SrcPort:      srcPort,
+		DstPort:      dstPort,
+		TrafficType:  key.GetTrafficType(),
+		DeltaPackets: bytes / 100,
+		DeltaBytes:   bytes,
+		BytesPerSec:  float64(bytes),
+		Interval:     1,
+	}
+}
+
+func TestMergeConversations(t *testing.T) {
+	// RoCE v2：两个方向的 UDP 源端口不同，目的端口都是 4791
+	roceAB := testConversationFlow("ib0", testSrcIP, testDstIP, 50001, 4791, 0xFE, 3000)
+	roceBA := testConversationFlow("ib0", testDstIP, testSrcIP, 61002, 4791, 0xFE, 1000)
+	// TCP：反方向的端口互换
+	tcpAB := testConversationFlow("ib0", testSrcIP, testDstIP, 40000, 80, 6, 500)
+	tcpBA := testConversationFlow("ib0", testDstIP, testSrcIP, 80, 40000, 6, 1500)
+	otherIface := testConversationFlow("ib1", testDstIP, testSrcIP, 61002, 4791, 0xFE, 700)
+	remainder := FlowSample{Interface: "ib0", Key: FlowKey{Proto: 6}, DeltaBytes: 99, Remainder: true}
+
+	type want struct {
+		iface              string
+		key                ConversationKey
+		bytesAToB, bytesBA uint64
+	}
+	tests := []struct {
+		name  string
+		mode  string
+		flows []FlowSample
+		want  []want
+	}{
+		{
+			name:  "disabled",
+			mode:  "",
+			flows: []FlowSample{roceAB, roceBA},
+		},
+		{
+			name:  "ip mode merges both RoCE directions",
+			mode:  conversationsIP,
+			flows: []FlowSample{roceBA, roceAB, tcpAB, tcpBA, otherIface, remainder},
+			want: []want{
+				{"ib0", ConversationKey{IPA: testSrcIP, IPB: testDstIP, Proto: 6}, 500, 1500},
+				{"ib0", ConversationKey{IPA: testSrcIP, IPB: testDstIP, Proto: 0xFE}, 3000, 1000},
+				{"ib1", ConversationKey{IPA: testSrcIP, IPB: testDstIP, Proto: 0xFE}, 0, 700},
+			},
+		},
+		{
+			name:  "port mode keeps RoCE source ports apart",
+			mode:  conversationsPort,
+			flows: []FlowSample{roceAB, roceBA, tcpBA, tcpAB},
+			want: []want{
+				{"ib0", ConversationKey{IPA: testSrcIP, IPB: testDstIP, PortA: 4791, PortB: 61002, Proto: 0xFE}, 0, 1000},
+				{"ib0", ConversationKey{IPA: testSrcIP, IPB: testDstIP, PortA: 40000, PortB: 80, Proto: 6}, 500, 1500},
+				{"ib0", ConversationKey{IPA: testSrcIP, IPB: testDstIP, PortA: 50001, PortB: 4791, Proto: 0xFE}, 3000, 0},
+			},
+		},
+		{
+			name: "same address orders by port",
+			mode: conversationsPort,
+			flows: []FlowSample{
+				testConversationFlow("lo", testSrcIP, testSrcIP, 9000, 1000, 17, 200),
+				testConversationFlow("lo", testSrcIP, testSrcIP, 1000, 9000, 17, 100),
+			},
+			want: []want{
+				{"lo", ConversationKey{IPA: testSrcIP, IPB: testSrcIP, PortA: 1000, PortB: 9000, Proto: 17}, 100, 200},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeConversations(tt.mode, tt.flows)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d conversations, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				c := got[i]
+				if c.Interface != w.iface || c.Key != w.key {
+					t.Errorf("conversation %d = %s %+v, want %s %+v", i, c.Interface, c.Key, w.iface, w.key)
+				}
+				if c.BytesAToB != w.bytesAToB || c.BytesBToA != w.bytesBA {
+					t.Errorf("conversation %d bytes = %d / %d, want %d / %d", i, c.BytesAToB, c.BytesBToA, w.bytesAToB, w.bytesBA)
+				}
+				if c.PacketsAToB != w.bytesAToB/100 || c.PacketsBToA != w.bytesBA/100 {
+					t.Errorf("conversation %d packets = %d / %d", i, c.PacketsAToB, c.PacketsBToA)
+				}
+				if c.BytesPerSecAToB != float64(w.bytesAToB) || c.BytesPerSecBToA != float64(w.bytesBA) {
+					t.Errorf("conversation %d rates = %v / %v", i, c.BytesPerSecAToB, c.BytesPerSecBToA)
+				}
+			}
+		})
+	}
+}
+
+func TestConversationAsymmetry(t *testing.T) {
+	tests := []struct {
+		aToB, bToA uint64
+		want       float64
+	}{
+		{0, 0, 0},
+		{1000, 1000, 0},
+		{3000, 1000, 0.5},
+		{1000, 3000, 0.5},
+		{500, 0, 1},
+		{0, 500, 1},
+	}
+	for _, tt := range tests {
+		c := ConversationSample{BytesAToB: tt.aToB, BytesBToA: tt.bToA}
+		if got := c.Asymmetry(); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Asymmetry(%d, %d) = %v, want %v", tt.aToB, tt.bToA, got, tt.want)
+		}
+	}
+}
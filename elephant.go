@@ -0,0 +1,153 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 默认连续满足条件的采集周期数
+const defaultElephantTicks = 3
+
+// elephantRule 大象流判定条件（可热加载，--elephant-*）
+// 速率阈值和带宽占比任一满足即视为本周期超过阈值，连续 Ticks 个周期后判定为大象流
+type elephantRule struct {
+	BytesPerSec   float64 // 速率阈值，0 表示不按速率判定
+	LinkShare     float64 // 占接口带宽的比例（0-1），0 表示不按占比判定
+	Ticks         int     // 连续超过阈值的采集周期数
+	LinkSpeedMbps int     // 接口带宽（Mbit/s），0 表示从 sysfs 读取
+}
+
+// 当前生效的大象流判定条件（受 settingsMu 保护）
+var elephantSettings elephantRule
+
+func newElephantRule(cfg ElephantConfig) elephantRule {
+	return elephantRule{
+		BytesPerSec:   float64(cfg.RateMbps) * 1e6 / 8,
+		LinkShare:     cfg.LinkSharePercent / 100,
+		Ticks:         cfg.Ticks,
+		LinkSpeedMbps: cfg.LinkSpeedMbps,
+	}
+}
+
+func (r elephantRule) enabled() bool {
+	return r.BytesPerSec > 0 || r.LinkShare > 0
+}
+
+// 本周期的速率是否超过阈值（接口带宽未知时不按占比判定）
+func (r elephantRule) exceeded(bytesPerSec, linkBytesPerSec float64) bool {
+	if r.BytesPerSec > 0 && bytesPerSec >= r.BytesPerSec {
+		return true
+	}
+	return r.LinkShare > 0 && linkBytesPerSec > 0 && bytesPerSec >= r.LinkShare*linkBytesPerSec
+}
+
+// 接口带宽（bytes/s）：优先使用配置的 link_speed_mbps，否则读取 /sys/class/net/<iface>/speed，未知时返回 0
+func linkBytesPerSec(iface string, overrideMbps int) float64 {
+	mbps := overrideMbps
+	if mbps <= 0 {
+		data, err := os.ReadFile("/sys/class/net/" + iface + "/speed")
+		if err != nil {
+			return 0 // 虚拟接口或链路未就绪时读取失败
+		}
+		if mbps, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil || mbps <= 0 {
+			return 0 // 速率未知时为 -1
+		}
+	}
+	return float64(mbps) * 1e6 / 8
+}
+
+// elephantTracker 记录每个流连续超过阈值的采集周期数（每个接口一个，只在该接口的监控 goroutine 中使用）
+type elephantTracker struct {
+	streaks map[FlowKey]int
+	next    map[FlowKey]int
+	prev    map[FlowKey]int // 上一次 commit 之前的计数，用于 rollback
+}
+
+func newElephantTracker() *elephantTracker {
+	return &elephantTracker{streaks: make(map[FlowKey]int)}
+}
+
+// observe 记录一个流本周期是否超过阈值，返回连续超过阈值的周期数（未超过时为 0）
+func (t *elephantTracker) observe(k FlowKey, exceeded bool) int {
+	if t.next == nil {
+		t.next = make(map[FlowKey]int)
+	}
+	if !exceeded {
+		return 0
+	}
+	n := t.streaks[k] + 1
+	t.next[k] = n
+	return n
+}
+
+// commit 结束本周期：本周期没有超过阈值（或已不存在、被过滤）的流重新计数
+func (t *elephantTracker) commit() {
+	if t.next == nil {
+		t.next = make(map[FlowKey]int)
+	}
+	t.prev = t.streaks
+	t.streaks, t.next = t.next, nil
+}
+
+// rollback 撤销上一次 commit（该周期的快照没有被导出，下一周期重新计算）
+func (t *elephantTracker) rollback() {
+	if t.prev != nil {
+		t.streaks, t.prev = t.prev, nil
+	}
+}
+
+// 大象流 metrics（启用 VictoriaMetrics 时注册）
+var elephantFlowGauge *prometheus.GaugeVec
+
+// 在 registry 中注册大象流 metrics
+func registerElephantMetrics(registry prometheus.Registerer) {
+	elephantFlowGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xtrace_elephant_flow",
+			Help: "1 for flows that exceeded the elephant flow rate or link share threshold for the configured number of consecutive intervals",
+		},
+		[]string{"src_ip", "dst_ip", "src_port", "dst_port", "protocol", "traffic_type", "interface", "host_ip", "collect_agg"},
+	)
+	registry.MustRegister(elephantFlowGauge)
+}
+
+// 推送后重置大象流 Gauge
+func resetElephantMetrics() {
+	if elephantFlowGauge != nil {
+		elephantFlowGauge.Reset()
+	}
+}
+
+// UpdateElephantMetric 将大象流标记为 1（标签与流级别指标相同）
+func (s *FlowSample) UpdateElephantMetric(hostIP string) {
+	srcIP, dstIP, srcPort, dstPort := s.EndpointLabels()
+	elephantFlowGauge.WithLabelValues(srcIP, dstIP, srcPort, dstPort,
+		strconv.Itoa(int(s.Key.Proto)), s.TrafficType, s.Interface, hostIP, currentCollectAgg()).Set(1)
+}
+
+// 记录本周期新判定的大象流
+func logElephants(snap epochSnapshot) {
+	for _, s := range snap.Interfaces {
+		for i := range s.Flows {
+			f := &s.Flows[i]
+			if !f.NewElephant {
+				continue
+			}
+			share := ""
+			if f.LinkShare > 0 {
+				share = fmt.Sprintf("，占接口带宽 %.1f%%", f.LinkShare*100)
+			}
+			log.Printf("[%s] 检测到大象流: %s:%d -> %s:%d proto=%d%s 速率 %s%s，已连续 %d 个周期超过阈值",
+				f.Interface, ipToStr(f.Key.SrcIP), f.SrcPort, ipToStr(f.Key.DstIP), f.DstPort,
+				f.Key.Proto, formatTrafficType(f.TrafficType), formatBitRate(f.BitsPerSec), share, f.ElephantTicks)
+		}
+	}
+}
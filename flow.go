@@ -4,9 +4,12 @@
 package main
 
 import (
+	"cmp"
 	"encoding/binary"
 	"net"
 	"strconv"
+
+	"golang.org/x/sys/unix"
 )
 
 // RoCE v2 使用的 UDP 端口（网络字节序：4791 = 0xb712）
@@ -28,6 +31,20 @@ type FlowStats struct {
 	Packets    uint64
 	Bytes      uint64
 	LastUpdate uint64 // 最后更新时间（纳秒）
+	FirstSeen  uint64 // 条目创建时间（纳秒）
+}
+
+// 按字段顺序比较两个 FlowKey（用于排序时打破平局，保证顺序确定）
+func compareFlowKey(a, b FlowKey) int {
+	return cmp.Or(
+		cmp.Compare(a.SrcIP, b.SrcIP),
+		cmp.Compare(a.DstIP, b.DstIP),
+		cmp.Compare(a.SrcPort, b.SrcPort),
+		cmp.Compare(a.DstPort, b.DstPort),
+		cmp.Compare(a.Proto, b.Proto),
+		cmp.Compare(a.PktLenLow, b.PktLenLow),
+		cmp.Compare(a.FirstU16, b.FirstU16),
+	)
 }
 
 // 将 IP 地址从 uint32 转换为字符串
@@ -67,29 +84,42 @@ func (k *FlowKey) GetTrafficType() string {
 	}
 }
 
-// CalculateDelta 计算流量增量（处理计数器回绕）
-func (current FlowStats) CalculateDelta(last FlowStats, exists bool) (deltaPackets, deltaBytes uint64) {
-	if exists {
-		// 计算增量（处理可能的计数器回绕）
-		if current.Packets >= last.Packets {
-			deltaPackets = current.Packets - last.Packets
-		} else {
-			// 计数器回绕，使用当前值
-			deltaPackets = current.Packets
-		}
-		if current.Bytes >= last.Bytes {
-			deltaBytes = current.Bytes - last.Bytes
-		} else {
-			// 计数器回绕，使用当前值
-			deltaBytes = current.Bytes
-		}
-	} else {
-		// 第一次看到这个流，使用当前值
-		deltaPackets = current.Packets
-		deltaBytes = current.Bytes
+// CalculateDelta 计算本周期的流量增量
+// windowStart 为上一次采集开始时的单调时钟（纳秒，与 bpf_ktime_get_ns 同源）。
+// 用户态首次看到的流分两种情况：条目在本周期内创建时，全部计数都属于本周期；
+// 条目早于本周期创建（沿用固定的 map、过滤条件热加载等）时，按条目生命周期匀速估算本周期的份额，
+// 避免把整个生命周期的累计值当作一次增量。
+// reset 表示检测到计数器重置（条目被删除后重建，或计数回退）。
+func (current FlowStats) CalculateDelta(last FlowStats, exists bool, windowStart uint64) (deltaPackets, deltaBytes uint64, reset bool) {
+	if exists && current.FirstSeen == last.FirstSeen &&
+		current.Packets >= last.Packets && current.Bytes >= last.Bytes {
+		return current.Packets - last.Packets, current.Bytes - last.Bytes, false
+	}
+	reset = exists
+
+	// 条目在本周期内创建（新流，或被删除后重建）
+	if current.FirstSeen != 0 && current.FirstSeen >= windowStart {
+		return current.Packets, current.Bytes, reset
+	}
+
+	// 本周期内没有更新，或缺少时间信息无法估算：不计入
+	if current.FirstSeen == 0 || current.LastUpdate < windowStart || current.LastUpdate <= current.FirstSeen {
+		return 0, 0, reset
 	}
 
-	return deltaPackets, deltaBytes
+	frac := float64(current.LastUpdate-windowStart) / float64(current.LastUpdate-current.FirstSeen)
+	deltaPackets = uint64(float64(current.Packets)*frac + 0.5)
+	deltaBytes = uint64(float64(current.Bytes)*frac + 0.5)
+	return deltaPackets, deltaBytes, reset
+}
+
+// 当前单调时钟（纳秒），与 bpf_ktime_get_ns 同源
+func monotonicNow() uint64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return uint64(ts.Nano())
 }
 
 // CalculateRates 计算流量速率
@@ -100,22 +130,22 @@ func CalculateRates(deltaBytes uint64, intervalSeconds float64) (bytesPerSec, bi
 }
 
 // UpdateMetrics 更新流级别速率 metrics
-func (k *FlowKey) UpdateMetrics(srcPort, dstPort uint16, trafficType string,
-	bytesPerSec, bitsPerSec float64, iface, hostIP string) {
+func (s *FlowSample) UpdateMetrics(hostIP string) {
+	srcIP, dstIP, srcPort, dstPort := s.EndpointLabels()
 
 	labels := map[string]string{
-		"src_ip":       ipToStr(k.SrcIP),
-		"dst_ip":       ipToStr(k.DstIP),
-		"src_port":     strconv.Itoa(int(srcPort)),
-		"dst_port":     strconv.Itoa(int(dstPort)),
-		"protocol":     strconv.Itoa(int(k.Proto)),
-		"traffic_type": trafficType,
-		"interface":    iface,
+		"src_ip":       srcIP,
+		"dst_ip":       dstIP,
+		"src_port":     srcPort,
+		"dst_port":     dstPort,
+		"protocol":     strconv.Itoa(int(s.Key.Proto)),
+		"traffic_type": s.TrafficType,
+		"interface":    s.Interface,
 		"host_ip":      hostIP,
-		"collect_agg":  collectAgg,
+		"collect_agg":  currentCollectAgg(),
 	}
 
 	// 速率指标（与 node_exporter irate 兼容）
-	networkFlowBytesRate.With(labels).Set(bytesPerSec)
-	networkFlowBitsRate.With(labels).Set(bitsPerSec)
+	networkFlowBytesRate.With(labels).Set(s.BytesPerSec)
+	networkFlowBitsRate.With(labels).Set(s.BitsPerSec)
 }
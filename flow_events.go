@@ -0,0 +1,316 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 流生命周期事件类型
+const (
+	flowEventStart    = "flow_start"
+	flowEventEnd      = "flow_end"
+	flowEventElephant = "elephant_flow" // 流被判定为大象流（--elephant-*）
+)
+
+// 流结束的原因
+const (
+	flowEndIdle         = "idle_timeout" // 超过空闲超时没有新的数据包
+	flowEndShutdown     = "shutdown"     // 程序退出时仍在活动
+	flowEndEndOfCapture = "end_of_capture"
+)
+
+// 流事件输出目标为标准输出时的取值
+const flowEventsStdout = "stdout"
+
+// 默认空闲超时（毫秒）
+const defaultFlowIdleTimeoutMs = 60000
+
+// 流生命周期事件（全局变量）
+var (
+	flowEventsEnabled bool
+	flowEventsTarget  string   // stdout、文件路径或 http(s):// webhook
+	flowEventsFile    *os.File // 输出到文件时的文件
+	flowEvents        *flowTracker
+)
+
+// 一条流生命周期事件（JSON 输出）
+type flowEvent struct {
+	Event           string  `json:"event"`
+	Timestamp       string  `json:"timestamp"` // 检测到事件的采集时刻
+	Interface       string  `json:"interface"`
+	SrcIP           string  `json:"src_ip"`
+	DstIP           string  `json:"dst_ip"`
+	SrcPort         uint16  `json:"src_port"`
+	DstPort         uint16  `json:"dst_port"`
+	Protocol        uint8   `json:"protocol"`
+	TrafficType     string  `json:"traffic_type"`
+	FirstSeen       string  `json:"first_seen"`
+	LastSeen        string  `json:"last_seen"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Packets         uint64  `json:"packets"`
+	Bytes           uint64  `json:"bytes"`
+	PeakBytesPerSec float64 `json:"peak_bytes_per_sec"`
+	BytesPerSec     float64 `json:"bytes_per_sec,omitempty"` // 仅 elephant_flow：判定时的速率
+	LinkShare       float64 `json:"link_share,omitempty"`    // 仅 elephant_flow：占接口带宽的比例（带宽未知时省略）
+	Reason          string  `json:"reason,omitempty"`        // 仅 flow_end
+	HostIP          string  `json:"host_ip"`
+
+	key       flowSessionKey
+	firstSeen time.Time
+}
+
+// 按接口区分的流
+type flowSessionKey struct {
+	iface string
+	key   FlowKey
+}
+
+// 一个活动中的流
+type flowSession struct {
+	sample          FlowSample // 最近一次有增量的样本（地址、端口和流量类型）
+	firstSeen       time.Time
+	lastSeen        time.Time
+	packets         uint64 // 开始以来的累计值
+	bytes           uint64
+	peakBytesPerSec float64 // 单个采集周期内的最高平均速率
+}
+
+// flowTracker 按采集周期跟踪流的开始和结束
+//
+// 流在第一次出现增量的周期开始，超过空闲超时没有新数据包后结束。
+// 同一五元组结束后再次出现流量时作为新的流开始。只在导出 goroutine 中使用，不加锁。
+type flowTracker struct {
+	idleTimeout time.Duration
+	sessions    map[flowSessionKey]*flowSession
+}
+
+func newFlowTracker(idleTimeout time.Duration) *flowTracker {
+	return &flowTracker{
+		idleTimeout: idleTimeout,
+		sessions:    make(map[flowSessionKey]*flowSession),
+	}
+}
+
+// update 处理一个采集周期的流样本，返回本周期开始和结束的流事件
+func (t *flowTracker) update(epoch time.Time, flows []FlowSample) []flowEvent {
+	var events []flowEvent
+	for i := range flows {
+		s := &flows[i]
+		if s.Remainder || s.DeltaPackets == 0 {
+			continue
+		}
+
+		key := flowSessionKey{s.Interface, s.Key}
+		session, ok := t.sessions[key]
+		if !ok {
+			// 条目在本周期内创建时使用内核记录的创建时间，
+			// 否则（程序启动前已存在、空闲后重新活动）只能确定在本周期内开始
+			windowStart := s.Timestamp.Add(-time.Duration(s.Interval * float64(time.Second)))
+			first := s.FirstSeen
+			if first.IsZero() || first.Before(windowStart) {
+				first = windowStart
+			}
+			session = &flowSession{firstSeen: first}
+			t.sessions[key] = session
+		}
+
+		session.sample = *s
+		session.packets += s.DeltaPackets
+		session.bytes += s.DeltaBytes
+		session.peakBytesPerSec = max(session.peakBytesPerSec, s.BytesPerSec)
+		session.lastSeen = s.LastSeen
+		if session.lastSeen.IsZero() {
+			session.lastSeen = s.Timestamp
+		}
+		if !ok {
+			events = append(events, session.event(flowEventStart, epoch, key))
+		}
+		if s.NewElephant {
+			e := session.event(flowEventElephant, epoch, key)
+			e.BytesPerSec = s.BytesPerSec
+			e.LinkShare = s.LinkShare
+			events = append(events, e)
+		}
+	}
+
+	for key, session := range t.sessions {
+		if epoch.Sub(session.lastSeen) >= t.idleTimeout {
+			e := session.event(flowEventEnd, epoch, key)
+			e.Reason = flowEndIdle
+			events = append(events, e)
+			delete(t.sessions, key)
+		}
+	}
+	sortFlowEvents(events)
+	return events
+}
+
+// flush 结束所有活动中的流（程序退出、回放结束）
+func (t *flowTracker) flush(now time.Time, reason string) []flowEvent {
+	var events []flowEvent
+	for key, session := range t.sessions {
+		e := session.event(flowEventEnd, now, key)
+		e.Reason = reason
+		events = append(events, e)
+		delete(t.sessions, key)
+	}
+	sortFlowEvents(events)
+	return events
+}
+
+func (s *flowSession) event(kind string, epoch time.Time, key flowSessionKey) flowEvent {
+	srcIP, dstIP, _, _ := s.sample.EndpointLabels()
+	return flowEvent{
+		Event:           kind,
+		Timestamp:       epoch.Format(time.RFC3339Nano),
+		Interface:       s.sample.Interface,
+		SrcIP:           srcIP,
+		DstIP:           dstIP,
+		SrcPort:         s.sample.SrcPort,
+		DstPort:         s.sample.DstPort,
+		Protocol:        s.sample.Key.Proto,
+		TrafficType:     s.sample.TrafficType,
+		FirstSeen:       s.firstSeen.Format(time.RFC3339Nano),
+		LastSeen:        s.lastSeen.Format(time.RFC3339Nano),
+		DurationSeconds: max(s.lastSeen.Sub(s.firstSeen).Seconds(), 0),
+		Packets:         s.packets,
+		Bytes:           s.bytes,
+		PeakBytesPerSec: s.peakBytesPerSec,
+		key:             key,
+		firstSeen:       s.firstSeen,
+	}
+}
+
+// 同一周期内事件类型的输出顺序：结束、开始、大象流
+var flowEventOrder = map[string]int{flowEventEnd: 0, flowEventStart: 1, flowEventElephant: 2}
+
+// 按事件类型、接口、开始时间排序，输出稳定
+func sortFlowEvents(events []flowEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		a, b := &events[i], &events[j]
+		switch {
+		case a.Event != b.Event:
+			return flowEventOrder[a.Event] < flowEventOrder[b.Event]
+		case a.Interface != b.Interface:
+			return a.Interface < b.Interface
+		case !a.firstSeen.Equal(b.firstSeen):
+			return a.firstSeen.Before(b.firstSeen)
+		case a.key.key.SrcIP != b.key.key.SrcIP:
+			return ipLess(a.key.key.SrcIP, b.key.key.SrcIP)
+		case a.key.key.DstIP != b.key.key.DstIP:
+			return ipLess(a.key.key.DstIP, b.key.key.DstIP)
+		case a.SrcPort != b.SrcPort:
+			return a.SrcPort < b.SrcPort
+		case a.DstPort != b.DstPort:
+			return a.DstPort < b.DstPort
+		}
+		return a.Protocol < b.Protocol
+	})
+}
+
+// 初始化流生命周期事件输出
+// target 为 stdout、文件路径（追加写入）或 http(s):// webhook（每个周期 POST 一个 JSON 数组）
+func initFlowEvents(target string, idleTimeout time.Duration) error {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") && target != flowEventsStdout {
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("打开流事件文件失败: %w", err)
+		}
+		flowEventsFile = f
+	}
+	flowEventsTarget = target
+	flowEvents = newFlowTracker(idleTimeout)
+	flowEventsEnabled = true
+
+	log.Printf("流生命周期事件输出: %s，空闲超时: %v", target, idleTimeout)
+	return nil
+}
+
+// 处理一个采集周期的快照，输出本周期开始和结束的流
+func emitFlowEvents(snap epochSnapshot, hostIP string) {
+	events := flowEvents.update(snap.Epoch, snap.flowSamples())
+	if err := writeFlowEvents(events, hostIP); err != nil {
+		log.Printf("输出流事件失败: %v", err)
+	}
+}
+
+// 结束所有活动中的流并关闭输出
+func closeFlowEvents(now time.Time, reason, hostIP string) {
+	if !flowEventsEnabled {
+		return
+	}
+	if err := writeFlowEvents(flowEvents.flush(now, reason), hostIP); err != nil {
+		log.Printf("输出流事件失败: %v", err)
+	}
+	if flowEventsFile != nil {
+		flowEventsFile.Close()
+	}
+}
+
+// 按输出目标写出流事件（每行一个 JSON 对象；webhook 为一个 JSON 数组）
+func writeFlowEvents(events []flowEvent, hostIP string) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for i := range events {
+		events[i].HostIP = hostIP
+	}
+
+	if strings.HasPrefix(flowEventsTarget, "http://") || strings.HasPrefix(flowEventsTarget, "https://") {
+		return postFlowEvents(events)
+	}
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("JSON 编码失败: %w", err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if flowEventsFile != nil {
+		_, err := flowEventsFile.Write(buf.Bytes())
+		return err
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// 以 JSON 数组 POST 到 webhook
+func postFlowEvents(events []flowEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("JSON 编码失败: %w", err)
+	}
+	req, err := http.NewRequest("POST", flowEventsTarget, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook 返回错误状态码 %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
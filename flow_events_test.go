@@ -0,0 +1,197 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 一个周期的流样本：周期时刻 epoch，最后一个数据包在 lastSeen
+func testFlowEventSample(key FlowKey, epoch, firstSeen, lastSeen time.Time, packets, bytes uint64) FlowSample {
+	return FlowSample{
+		Interface:    "ib0",
+		Key:          key,
+		TrafficType:  key.GetTrafficType(),
+		DeltaPackets: packets,
+		DeltaBytes:   bytes,
+		BytesPerSec:  float64(bytes),
+		FirstSeen:    firstSeen,
+		LastSeen:     lastSeen,
+		Interval:     1,
+		Timestamp:    epoch,
+	}
+}
+
+func TestFlowTrackerLifecycle(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	tracker := newFlowTracker(3 * time.Second)
+
+	type wantEvent struct {
+		event   string
+		key     FlowKey
+		packets uint64
+		bytes   uint64
+		reason  string
+	}
+	steps := []struct {
+		name  string
+		epoch time.Time
+		flows []FlowSample
+		want  []wantEvent
+	}{
+		{
+			name:  "new RoCE flow starts at its kernel first_seen",
+			epoch: at(1000),
+			flows: []FlowSample{testFlowEventSample(testRoCEKey, at(1000), at(200), at(900), 10, 1000)},
+			want:  []wantEvent{{flowEventStart, testRoCEKey, 10, 1000, ""}},
+		},
+		{
+			name:  "active flow accumulates, TCP flow starts, idle samples are ignored",
+			epoch: at(2000),
+			flows: []FlowSample{
+				testFlowEventSample(testRoCEKey, at(2000), at(200), at(1950), 30, 5000),
+				testFlowEventSample(testTCPKey, at(2000), at(1500), at(1600), 1, 60),
+				testFlowEventSample(testDNSKey, at(2000), at(100), at(100), 0, 0),
+			},
+			want: []wantEvent{{flowEventStart, testTCPKey, 1, 60, ""}},
+		},
+		{
+			name:  "no events while within the idle timeout",
+			epoch: at(4000),
+			flows: []FlowSample{testFlowEventSample(testRoCEKey, at(4000), at(200), at(3500), 5, 500)},
+		},
+		{
+			name:  "TCP flow ends after the idle timeout",
+			epoch: at(5000),
+			want:  []wantEvent{{flowEventEnd, testTCPKey, 1, 60, flowEndIdle}},
+		},
+		{
+			name:  "RoCE flow ends after the idle timeout",
+			epoch: at(7000),
+			want:  []wantEvent{{flowEventEnd, testRoCEKey, 45, 6500, flowEndIdle}},
+		},
+		{
+			name:  "reused five-tuple starts a new flow",
+			epoch: at(8000),
+			flows: []FlowSample{testFlowEventSample(testRoCEKey, at(8000), at(200), at(7800), 2, 200)},
+			want:  []wantEvent{{flowEventStart, testRoCEKey, 2, 200, ""}},
+		},
+	}
+
+	for _, step := range steps {
+		events := tracker.update(step.epoch, step.flows)
+		if len(events) != len(step.want) {
+			t.Fatalf("%s: got %d events, want %d: %+v", step.name, len(events), len(step.want), events)
+		}
+		for i, w := range step.want {
+			e := events[i]
+			if e.Event != w.event || e.key.key != w.key || e.Packets != w.packets || e.Bytes != w.bytes || e.Reason != w.reason {
+				t.Errorf("%s: event %d = %s %+v packets=%d bytes=%d reason=%q, want %s %+v packets=%d bytes=%d reason=%q",
+					step.name, i, e.Event, e.key.key, e.Packets, e.Bytes, e.Reason, w.event, w.key, w.packets, w.bytes, w.reason)
+			}
+		}
+	}
+
+	// 结束事件：首次出现取内核记录，最后出现取 LastUpdate，峰值为单周期最高速率
+	tracker = newFlowTracker(3 * time.Second)
+	tracker.update(at(1000), []FlowSample{testFlowEventSample(testRoCEKey, at(1000), at(200), at(900), 10, 1000)})
+	tracker.update(at(2000), []FlowSample{testFlowEventSample(testRoCEKey, at(2000), at(200), at(1950), 30, 5000)})
+	events := tracker.flush(at(2500), flowEndShutdown)
+	if len(events) != 1 {
+		t.Fatalf("flush: got %d events, want 1", len(events))
+	}
+	e := events[0]
+	if e.FirstSeen != at(200).Format(time.RFC3339Nano) || e.LastSeen != at(1950).Format(time.RFC3339Nano) {
+		t.Errorf("first_seen=%s last_seen=%s", e.FirstSeen, e.LastSeen)
+	}
+	if e.DurationSeconds != 1.75 || e.PeakBytesPerSec != 5000 || e.Packets != 40 || e.Bytes != 6000 {
+		t.Errorf("duration=%v peak=%v packets=%d bytes=%d", e.DurationSeconds, e.PeakBytesPerSec, e.Packets, e.Bytes)
+	}
+	if e.Reason != flowEndShutdown || e.Timestamp != at(2500).Format(time.RFC3339Nano) {
+		t.Errorf("reason=%q timestamp=%s", e.Reason, e.Timestamp)
+	}
+	if len(tracker.flush(at(3000), flowEndShutdown)) != 0 {
+		t.Errorf("second flush returned events")
+	}
+}
+
+func TestFlowTrackerFirstSeenBeforeWindow(t *testing.T) {
+	// 程序启动前已存在的流：只能确定在本周期内开始
+	epoch := time.Unix(1700000010, 0)
+	tracker := newFlowTracker(time.Minute)
+	sample := testFlowEventSample(testTCPKey, epoch, epoch.Add(-time.Hour), epoch.Add(-time.Millisecond), 5, 500)
+	sample.Interval = 5
+	events := tracker.update(epoch, []FlowSample{sample})
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if want := epoch.Add(-5 * time.Second).Format(time.RFC3339Nano); events[0].FirstSeen != want {
+		t.Errorf("first_seen = %s, want %s", events[0].FirstSeen, want)
+	}
+}
+
+func TestWriteFlowEventsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := initFlowEvents(path, time.Minute); err != nil {
+		t.Fatalf("initFlowEvents: %v", err)
+	}
+	t.Cleanup(func() {
+		flowEventsEnabled = false
+		flowEventsFile = nil
+		flowEvents = nil
+	})
+
+	epoch := time.Unix(1700000001, 0)
+	emitFlowEvents(epochSnapshot{
+		Epoch: epoch,
+		Interfaces: []ifaceSnapshot{{
+			Interface: "ib0",
+			Flows:     []FlowSample{testFlowEventSample(testRoCEKey, epoch, epoch.Add(-time.Second/2), epoch, 3, 300)},
+		}},
+	}, "192.0.2.1")
+	closeFlowEvents(epoch.Add(time.Second), flowEndShutdown, "192.0.2.1")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	for i, want := range []string{flowEventStart, flowEventEnd} {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &e); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if e["event"] != want || e["host_ip"] != "192.0.2.1" || e["traffic_type"] != "RoCE_v2" || e["bytes"] != float64(300) {
+			t.Errorf("line %d = %s", i, lines[i])
+		}
+	}
+}
+
+func TestFlowTrackerElephantEvent(t *testing.T) {
+	epoch := time.Unix(1700000003, 0)
+	tracker := newFlowTracker(time.Minute)
+	elephant := testFlowEventSample(testRoCEKey, epoch, epoch.Add(-time.Second/2), epoch, 10, 8000)
+	elephant.NewElephant, elephant.Elephant, elephant.LinkShare = true, true, 0.6
+
+	events := tracker.update(epoch, []FlowSample{elephant, testFlowEventSample(testTCPKey, epoch, epoch, epoch, 1, 60)})
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Event)
+	}
+	if strings.Join(kinds, ",") != "flow_start,flow_start,elephant_flow" {
+		t.Fatalf("events = %v", kinds)
+	}
+	if e := events[2]; e.key.key != testRoCEKey || e.BytesPerSec != 8000 || e.LinkShare != 0.6 || e.Reason != "" {
+		t.Errorf("elephant event = %+v", e)
+	}
+}
@@ -0,0 +1,193 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 默认的健康检查监听地址：只监听本机回环地址，程序通常以 host network 运行，
+// 对外暴露端口需要显式指定（例如 --health-listen :9435）
+const defaultHealthListen = "127.0.0.1:9435"
+
+// 推送结果的宽限时间（HTTP 推送超时）
+const pushStaleGrace = 10 * time.Second
+
+// 接口挂载状态（/readyz 使用）
+type ifaceHealth struct {
+	attached bool
+	err      string // 监控启动失败的原因
+}
+
+// 健康检查状态
+var (
+	healthMu          sync.Mutex
+	healthInterfaces  []string                       // 配置的接口名 / 通配符模式
+	ifaceHealthStates = make(map[string]ifaceHealth) // 按接口名索引
+	lastPushSuccess   time.Time
+)
+
+// 启动健康检查 HTTP 服务：/healthz、/readyz、/metrics（程序自身运行状态），以及可选的 /debug/pprof
+func initHealthServer(listen string, enablePprof bool, interfaces []string) error {
+	healthMu.Lock()
+	healthInterfaces = interfaces
+	healthMu.Unlock()
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %w", listen, err)
+	}
+	server := &http.Server{Handler: newHealthMux(enablePprof), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("健康检查服务异常退出: %v", err)
+		}
+	}()
+
+	pprofMsg := ""
+	if enablePprof {
+		pprofMsg = "，/debug/pprof 已启用"
+	}
+	log.Printf("健康检查服务: http://%s/healthz, /readyz, /metrics%s", listen, pprofMsg)
+	return nil
+}
+
+// 健康检查服务的路由
+func newHealthMux(enablePprof bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	if agentRegistry != nil {
+		mux.Handle("/metrics", promhttp.HandlerFor(agentRegistry, promhttp.HandlerOpts{}))
+	}
+	if enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// 进程存活
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// 就绪：所有配置的接口都已挂载 XDP，且启用导出器时最近有推送成功
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, report := readiness(time.Now())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprint(w, report)
+}
+
+// 检查就绪状态，返回是否就绪和逐项说明
+func readiness(now time.Time) (bool, string) {
+	settingsMu.RLock()
+	interval := time.Duration(collectIntervalMs) * time.Millisecond
+	settingsMu.RUnlock()
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	ready := true
+	var b strings.Builder
+
+	// 指定了具体名称的接口必须存在并已挂载
+	for _, name := range healthInterfaces {
+		if isInterfacePattern(name) {
+			continue
+		}
+		if _, ok := ifaceHealthStates[name]; !ok {
+			ready = false
+			fmt.Fprintf(&b, "%s: 未监控（接口不存在）\n", name)
+		}
+	}
+
+	// 所有正在监控（或监控失败）的接口
+	names := make([]string, 0, len(ifaceHealthStates))
+	for name := range ifaceHealthStates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		state := ifaceHealthStates[name]
+		switch {
+		case state.err != "":
+			ready = false
+			fmt.Fprintf(&b, "%s: 监控失败: %s\n", name, state.err)
+		case !state.attached:
+			ready = false
+			fmt.Fprintf(&b, "%s: XDP 未挂载\n", name)
+		default:
+			fmt.Fprintf(&b, "%s: 已挂载\n", name)
+		}
+	}
+	if len(names) == 0 {
+		ready = false
+		fmt.Fprintf(&b, "没有匹配 %v 的接口\n", healthInterfaces)
+	}
+
+	// 启用导出器时，最近 3 个采集周期内至少有一次推送成功
+	if pushEnabled() {
+		maxAge := 3*interval + pushStaleGrace
+		switch {
+		case lastPushSuccess.IsZero():
+			ready = false
+			fmt.Fprintf(&b, "推送: 尚未成功推送\n")
+		case now.Sub(lastPushSuccess) > maxAge:
+			ready = false
+			fmt.Fprintf(&b, "推送: 最近一次成功推送在 %v 前（超过 %v）\n", now.Sub(lastPushSuccess).Round(time.Second), maxAge)
+		default:
+			fmt.Fprintf(&b, "推送: 最近一次成功推送在 %v 前\n", now.Sub(lastPushSuccess).Round(time.Millisecond))
+		}
+	}
+
+	if ready {
+		return true, "ready\n" + b.String()
+	}
+	return false, "not ready\n" + b.String()
+}
+
+// 更新接口的挂载状态
+func setInterfaceAttached(iface string, attached bool) {
+	healthMu.Lock()
+	ifaceHealthStates[iface] = ifaceHealth{attached: attached}
+	healthMu.Unlock()
+}
+
+// 记录接口监控启动失败（加载 eBPF 或挂载 XDP 失败后该接口不再被监控）
+func setInterfaceFailed(iface string, err error) {
+	healthMu.Lock()
+	ifaceHealthStates[iface] = ifaceHealth{err: err.Error()}
+	healthMu.Unlock()
+}
+
+// 接口不再监控（停止监控、被删除或改名）
+func forgetInterfaceHealth(iface string) {
+	healthMu.Lock()
+	delete(ifaceHealthStates, iface)
+	healthMu.Unlock()
+}
+
+// 记录一次成功的推送
+func recordPushSuccess(now time.Time) {
+	healthMu.Lock()
+	lastPushSuccess = now
+	healthMu.Unlock()
+}
@@ -0,0 +1,163 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	healthMu.Lock()
+	oldInterfaces, oldStates, oldPush := healthInterfaces, ifaceHealthStates, lastPushSuccess
+	healthMu.Unlock()
+	oldInterval, oldMetrics := collectIntervalMs, metricsEnabled
+	t.Cleanup(func() {
+		healthMu.Lock()
+		healthInterfaces, ifaceHealthStates, lastPushSuccess = oldInterfaces, oldStates, oldPush
+		healthMu.Unlock()
+		collectIntervalMs, metricsEnabled = oldInterval, oldMetrics
+	})
+
+	now := time.Unix(1700000000, 0)
+	attached := map[string]ifaceHealth{"ib0": {attached: true}, "ib1": {attached: true}}
+	const never = time.Duration(-1)
+
+	tests := []struct {
+		name       string
+		interfaces []string
+		states     map[string]ifaceHealth
+		intervalMs int
+		push       bool          // 是否启用导出器
+		pushAge    time.Duration // 距最近一次成功推送的时间，never 表示尚未推送
+		want       bool
+		wantLines  []string
+	}{
+		{
+			name:       "all attached",
+			interfaces: []string{"ib0", "ib1"},
+			states:     attached,
+			want:       true,
+			wantLines:  []string{"ib0: 已挂载", "ib1: 已挂载"},
+		},
+		{
+			name:       "named interface missing",
+			interfaces: []string{"ib0", "ib2"},
+			states:     map[string]ifaceHealth{"ib0": {attached: true}},
+			wantLines:  []string{"ib2: 未监控（接口不存在）", "ib0: 已挂载"},
+		},
+		{
+			// 通配符模式不要求某个具体接口存在
+			name:       "pattern matched",
+			interfaces: []string{"ib*"},
+			states:     attached,
+			want:       true,
+		},
+		{
+			name:       "pattern without match",
+			interfaces: []string{"ib*"},
+			states:     map[string]ifaceHealth{},
+			wantLines:  []string{"没有匹配 [ib*] 的接口"},
+		},
+		{
+			name:       "detached",
+			interfaces: []string{"ib*"},
+			states:     map[string]ifaceHealth{"ib0": {attached: true}, "ib1": {}},
+			wantLines:  []string{"ib1: XDP 未挂载"},
+		},
+		{
+			name:       "monitor failed",
+			interfaces: []string{"ib0"},
+			states:     map[string]ifaceHealth{"ib0": {err: "挂载 XDP 失败"}},
+			wantLines:  []string{"ib0: 监控失败: 挂载 XDP 失败"},
+		},
+		{
+			name:       "never pushed",
+			interfaces: []string{"ib0"},
+			states:     attached,
+			intervalMs: 5000,
+			push:       true,
+			pushAge:    never,
+			wantLines:  []string{"推送: 尚未成功推送"},
+		},
+		{
+			name:       "recent push",
+			interfaces: []string{"ib0"},
+			states:     attached,
+			intervalMs: 5000,
+			push:       true,
+			pushAge:    5 * time.Second,
+			want:       true,
+			wantLines:  []string{"推送: 最近一次成功推送在 5s 前"},
+		},
+		{
+			// 3×5s + 10s 宽限，恰好在边界上仍然就绪
+			name:       "push at limit",
+			interfaces: []string{"ib0"},
+			states:     attached,
+			intervalMs: 5000,
+			push:       true,
+			pushAge:    25 * time.Second,
+			want:       true,
+		},
+		{
+			name:       "push stale",
+			interfaces: []string{"ib0"},
+			states:     attached,
+			intervalMs: 5000,
+			push:       true,
+			pushAge:    25*time.Second + time.Millisecond,
+			wantLines:  []string{"推送: 最近一次成功推送在 25s 前（超过 25s）"},
+		},
+		{
+			// 亚秒采集间隔：3×500ms + 10s
+			name:       "sub-second interval stale",
+			interfaces: []string{"ib0"},
+			states:     attached,
+			intervalMs: 500,
+			push:       true,
+			pushAge:    12 * time.Second,
+			wantLines:  []string{"（超过 11.5s）"},
+		},
+		{
+			// 未启用导出器时不检查推送
+			name:       "push disabled",
+			interfaces: []string{"ib0"},
+			states:     attached,
+			intervalMs: 500,
+			pushAge:    time.Hour,
+			want:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var last time.Time
+			if tt.pushAge != never {
+				last = now.Add(-tt.pushAge)
+			}
+			healthMu.Lock()
+			healthInterfaces, ifaceHealthStates, lastPushSuccess = tt.interfaces, tt.states, last
+			healthMu.Unlock()
+			collectIntervalMs, metricsEnabled = tt.intervalMs, tt.push
+
+			ready, report := readiness(now)
+			if ready != tt.want {
+				t.Errorf("ready = %v, want %v:\n%s", ready, tt.want, report)
+			}
+			wantFirst := "not ready\n"
+			if tt.want {
+				wantFirst = "ready\n"
+			}
+			if !strings.HasPrefix(report, wantFirst) {
+				t.Errorf("report does not start with %q:\n%s", wantFirst, report)
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(report, line) {
+					t.Errorf("report missing %q:\n%s", line, report)
+				}
+			}
+		})
+	}
+}
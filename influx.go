@@ -0,0 +1,252 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UDP 单个数据报的最大负载（按行切分，避免 IP 分片）
+const influxUDPPayloadSize = 1400
+
+// InfluxDB line protocol 导出器（全局变量）
+var (
+	influxEnabled bool
+	influxURL     *url.URL
+	influxToken   string
+)
+
+// 初始化 InfluxDB 导出器
+// 支持的地址格式：
+//   - http(s)://host:8086/api/v2/write     InfluxDB v2 HTTP 写入（org/bucket 可通过参数或 URL query 指定）
+//   - udp://host:8094                      Telegraf socket_listener (UDP)
+//   - unix:///run/telegraf.sock             Telegraf socket_listener (Unix stream)
+//   - unixgram:///run/telegraf.sock         Telegraf socket_listener (Unix datagram)
+func initInfluxExporter(rawURL, token, org, bucket string) error {
+	if rawURL == "" {
+		rawURL = "http://localhost:8086/api/v2/write"
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("解析 InfluxDB 地址失败: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/api/v2/write"
+		}
+		q := u.Query()
+		if org != "" {
+			q.Set("org", org)
+		}
+		if bucket != "" {
+			q.Set("bucket", bucket)
+		}
+		if q.Get("bucket") == "" {
+			return fmt.Errorf("InfluxDB HTTP 写入需要指定 bucket")
+		}
+		q.Set("precision", "ns")
+		u.RawQuery = q.Encode()
+	case "udp", "unix", "unixgram":
+		if influxSocketAddr(u) == "" {
+			return fmt.Errorf("InfluxDB socket 地址为空: %s", rawURL)
+		}
+	default:
+		return fmt.Errorf("不支持的 InfluxDB 地址协议: %s（可选: http, https, udp, unix, unixgram）", u.Scheme)
+	}
+
+	influxURL = u
+	influxToken = token
+	influxEnabled = true
+
+	log.Printf("InfluxDB line protocol 导出器配置: %s", u.Redacted())
+	return nil
+}
+
+// socket 类地址（udp 使用 host:port，unix 使用文件路径）
+func influxSocketAddr(u *url.URL) string {
+	if u.Scheme == "udp" {
+		return u.Host
+	}
+	return u.Host + u.Path
+}
+
+// 推送本轮样本到 InfluxDB / Telegraf
+func pushMetricsToInflux(flows []FlowSample, nics []NICSample, aggs []AggSample, hostIP string) error {
+	if len(flows) == 0 && len(nics) == 0 && len(aggs) == 0 {
+		return nil
+	}
+
+	data := encodeInfluxLines(flows, nics, aggs, hostIP)
+	addPushPayload(exporterInfluxDB, len(data))
+
+	switch influxURL.Scheme {
+	case "http", "https":
+		return writeInfluxHTTP(data)
+	case "udp", "unixgram":
+		return writeInfluxDatagrams(influxURL.Scheme, influxSocketAddr(influxURL), data)
+	default:
+		return writeInfluxStream(influxURL.Scheme, influxSocketAddr(influxURL), data)
+	}
+}
+
+// 通过 InfluxDB v2 HTTP API 写入
+func writeInfluxHTTP(data []byte) error {
+	req, err := http.NewRequest("POST", influxURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if influxToken != "" {
+		req.Header.Set("Authorization", "Token "+influxToken)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("InfluxDB 返回错误状态码 %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// 通过数据报 socket 写入（按行切分，每个数据报不超过 influxUDPPayloadSize）
+func writeInfluxDatagrams(network, addr string, data []byte) error {
+	conn, err := net.DialTimeout(network, addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("连接 %s://%s 失败: %w", network, addr, err)
+	}
+	defer conn.Close()
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > influxUDPPayloadSize {
+			// 在最大长度内寻找最后一个换行，保证不拆分单行
+			n = bytes.LastIndexByte(data[:influxUDPPayloadSize], '\n') + 1
+			if n == 0 {
+				// 单行超长，只能整行发送
+				n = bytes.IndexByte(data, '\n') + 1
+				if n == 0 {
+					n = len(data)
+				}
+			}
+		}
+		if _, err := conn.Write(data[:n]); err != nil {
+			return fmt.Errorf("写入 %s://%s 失败: %w", network, addr, err)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// 通过流式 socket 写入
+func writeInfluxStream(network, addr string, data []byte) error {
+	conn, err := net.DialTimeout(network, addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("连接 %s://%s 失败: %w", network, addr, err)
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(data); err != nil {
+		return fmt.Errorf("写入 %s://%s 失败: %w", network, addr, err)
+	}
+	return nil
+}
+
+// 将流样本、NIC 样本和聚合层级样本编码为 InfluxDB line protocol
+// 流五元组等作为 tag，速率和增量作为 field，时间戳为采集时刻（纳秒）
+func encodeInfluxLines(flows []FlowSample, nics []NICSample, aggs []AggSample, hostIP string) []byte {
+	var buf bytes.Buffer
+	static := sortedStaticLabels()
+	writeStaticTags := func() {
+		for i := 0; i < len(static); i += 2 {
+			writeInfluxTag(&buf, static[i], static[i+1])
+		}
+	}
+
+	for _, s := range flows {
+		srcIP, dstIP, srcPort, dstPort := s.EndpointLabels()
+		buf.WriteString("xtrace_network_flow")
+		writeInfluxTag(&buf, "src_ip", srcIP)
+		writeInfluxTag(&buf, "dst_ip", dstIP)
+		writeInfluxTag(&buf, "src_port", srcPort)
+		writeInfluxTag(&buf, "dst_port", dstPort)
+		writeInfluxTag(&buf, "protocol", strconv.Itoa(int(s.Key.Proto)))
+		writeInfluxTag(&buf, "traffic_type", s.TrafficType)
+		writeInfluxTag(&buf, "interface", s.Interface)
+		writeInfluxTag(&buf, "host_ip", hostIP)
+		writeInfluxTag(&buf, "collect_agg", currentCollectAgg())
+		writeStaticTags()
+		fmt.Fprintf(&buf, " bytes_rate=%s,bits_rate=%s,bytes=%di,packets=%di %d\n",
+			strconv.FormatFloat(s.BytesPerSec, 'f', -1, 64),
+			strconv.FormatFloat(s.BitsPerSec, 'f', -1, 64),
+			s.DeltaBytes, s.DeltaPackets, s.Timestamp.UnixNano())
+	}
+
+	for _, s := range nics {
+		buf.WriteString("xtrace_network_nic")
+		writeInfluxTag(&buf, "interface", s.Interface)
+		writeInfluxTag(&buf, "src_ip", ipToStr(s.Key.SrcIP))
+		writeInfluxTag(&buf, "dst_ip", ipToStr(s.Key.DstIP))
+		writeInfluxTag(&buf, "protocol", strconv.Itoa(int(s.Key.Proto)))
+		writeInfluxTag(&buf, "traffic_type", s.Rate.trafficType)
+		writeInfluxTag(&buf, "host_ip", hostIP)
+		writeInfluxTag(&buf, "collect_agg", currentCollectAgg())
+		writeStaticTags()
+		fmt.Fprintf(&buf, " bytes_rate=%s,bits_rate=%s %d\n",
+			strconv.FormatFloat(s.Rate.bytesPerSec, 'f', -1, 64),
+			strconv.FormatFloat(s.Rate.bitsPerSec, 'f', -1, 64),
+			s.Timestamp.UnixNano())
+	}
+
+	for _, a := range aggs {
+		buf.WriteString(influxMeasurementEscaper.Replace("xtrace_network_agg_" + a.Level.name))
+		for i, name := range a.Level.labelNames() {
+			writeInfluxTag(&buf, name, a.Values[i])
+		}
+		writeInfluxTag(&buf, "interface", a.Interface)
+		writeInfluxTag(&buf, "host_ip", hostIP)
+		writeInfluxTag(&buf, "collect_agg", currentCollectAgg())
+		writeStaticTags()
+		fmt.Fprintf(&buf, " bytes_rate=%s,bits_rate=%s,bytes=%di,packets=%di %d\n",
+			strconv.FormatFloat(a.BytesPerSec, 'f', -1, 64),
+			strconv.FormatFloat(a.BitsPerSec, 'f', -1, 64),
+			a.DeltaBytes, a.DeltaPackets, a.Timestamp.UnixNano())
+	}
+
+	return buf.Bytes()
+}
+
+// line protocol 中 tag key/value 需要转义逗号、等号和空格，measurement 需要转义逗号和空格
+var (
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+)
+
+// 写入一个 tag（空值的 tag 在 line protocol 中不合法，直接跳过）
+func writeInfluxTag(buf *bytes.Buffer, key, value string) {
+	if value == "" {
+		return
+	}
+	buf.WriteByte(',')
+	buf.WriteString(influxTagEscaper.Replace(key))
+	buf.WriteByte('=')
+	buf.WriteString(influxTagEscaper.Replace(value))
+}
@@ -0,0 +1,248 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeInfluxLines(t *testing.T) {
+	ts := time.Unix(1700000000, 123456789)
+	flows, nics := testSamples(ts)
+	setCollectAgg("test-agg")
+	t.Cleanup(func() {
+		setCollectAgg("")
+		staticLabels = nil
+	})
+
+	level, err := parseAggLevel("src_subnet/24,traffic_type")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggs := []AggSample{{
+		Level:        level,
+		Interface:    "ib0",
+		Values:       []string{"10.0.0.0/24", "RoCE_v2"},
+		DeltaPackets: 10,
+		DeltaBytes:   4096,
+		BytesPerSec:  819.2,
+		BitsPerSec:   6553.6,
+		Timestamp:    ts,
+	}}
+
+	// 接口名中的特殊字符需要在 tag 中转义，空值 tag 不输出
+	escaped := flows[0]
+	escaped.Interface = "eth 0,a=b"
+	escaped.TrafficType = ""
+
+	tests := []struct {
+		name   string
+		flows  []FlowSample
+		nics   []NICSample
+		aggs   []AggSample
+		static map[string]string
+		want   string
+	}{
+		{
+			name:  "flow",
+			flows: flows,
+			want: "xtrace_network_flow,src_ip=10.0.0.1,dst_ip=10.0.0.2,src_port=4791,dst_port=4791,protocol=254,traffic_type=RoCE_v2,interface=ib0,host_ip=192.0.2.10,collect_agg=test-agg" +
+				" bytes_rate=819.2,bits_rate=6553.6,bytes=4096i,packets=10i 1700000000123456789\n",
+		},
+		{
+			name: "nic",
+			nics: nics,
+			want: "xtrace_network_nic,interface=ib0,src_ip=10.0.0.1,dst_ip=10.0.0.2,protocol=254,traffic_type=RoCE_v2,host_ip=192.0.2.10,collect_agg=test-agg" +
+				" bytes_rate=819.2,bits_rate=6553.6 1700000000123456789\n",
+		},
+		{
+			name: "aggregate",
+			aggs: aggs,
+			want: "xtrace_network_agg_src_subnet24_traffic_type,src_subnet=10.0.0.0/24,traffic_type=RoCE_v2,interface=ib0,host_ip=192.0.2.10,collect_agg=test-agg" +
+				" bytes_rate=819.2,bits_rate=6553.6,bytes=4096i,packets=10i 1700000000123456789\n",
+		},
+		{
+			name:  "escaping and static labels",
+			flows: []FlowSample{escaped},
+			static: map[string]string{
+				"zone":    "us east,1",
+				"cluster": "a=b",
+			},
+			want: `xtrace_network_flow,src_ip=10.0.0.1,dst_ip=10.0.0.2,src_port=4791,dst_port=4791,protocol=254,interface=eth\ 0\,a\=b,host_ip=192.0.2.10,collect_agg=test-agg,cluster=a\=b,zone=us\ east\,1` +
+				" bytes_rate=819.2,bits_rate=6553.6,bytes=4096i,packets=10i 1700000000123456789\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staticLabels = tt.static
+			got := string(encodeInfluxLines(tt.flows, tt.nics, tt.aggs, "192.0.2.10"))
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// 聚合层级名称已限制为 [a-zA-Z0-9_]，measurement 转义只是兜底
+func TestInfluxMeasurementEscaping(t *testing.T) {
+	if got := influxMeasurementEscaper.Replace("a b,c=d"); got != `a\ b\,c=d` {
+		t.Errorf("measurement = %s", got)
+	}
+}
+
+// 启动一个 line protocol 接收端，返回导出地址和收到的数据
+type influxReceiver func(t *testing.T) (rawURL string, received <-chan []byte)
+
+func httpInfluxReceiver(t *testing.T) (string, <-chan []byte) {
+	ch := make(chan []byte, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v2/write" || q.Get("precision") != "ns" || q.Get("org") != "infra" || q.Get("bucket") != "xtrace" {
+			http.Error(w, "bad query: "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "Token secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		ch <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, ch
+}
+
+func packetInfluxReceiver(network string) influxReceiver {
+	return func(t *testing.T) (string, <-chan []byte) {
+		addr := "127.0.0.1:0"
+		if network == "unixgram" {
+			addr = filepath.Join(t.TempDir(), "telegraf.sock")
+		}
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			t.Fatalf("listen %s: %v", network, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		ch := make(chan []byte, 64)
+		go func() {
+			buf := make([]byte, 65536)
+			for {
+				n, _, err := conn.ReadFrom(buf)
+				if err != nil {
+					close(ch)
+					return
+				}
+				ch <- bytes.Clone(buf[:n])
+			}
+		}()
+		return network + "://" + conn.LocalAddr().String(), ch
+	}
+}
+
+func unixInfluxReceiver(t *testing.T) (string, <-chan []byte) {
+	path := filepath.Join(t.TempDir(), "telegraf.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen unix: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		ch <- data
+	}()
+	return "unix://" + path, ch
+}
+
+func TestPushMetricsToInflux(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	setCollectAgg("test-agg")
+	t.Cleanup(func() {
+		setCollectAgg("")
+		influxEnabled, influxURL, influxToken = false, nil, ""
+	})
+
+	// 足够多的流，UDP 需要按行切分为多个数据报
+	var flows []FlowSample
+	for i := 0; i < 40; i++ {
+		f, _ := testSamples(ts)
+		f[0].SrcPort = uint16(10000 + i)
+		flows = append(flows, f[0])
+	}
+	want := string(encodeInfluxLines(flows, nil, nil, "192.0.2.10"))
+	if len(want) <= influxUDPPayloadSize {
+		t.Fatalf("test payload is only %d bytes", len(want))
+	}
+
+	tests := []struct {
+		name       string
+		receiver   influxReceiver
+		datagrams  bool // 接收端按数据报接收
+		token, org string
+		bucket     string
+	}{
+		{name: "http", receiver: httpInfluxReceiver, token: "secret", org: "infra", bucket: "xtrace"},
+		{name: "udp", receiver: packetInfluxReceiver("udp"), datagrams: true},
+		{name: "unixgram", receiver: packetInfluxReceiver("unixgram"), datagrams: true},
+		{name: "unix", receiver: unixInfluxReceiver},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawURL, received := tt.receiver(t)
+			if err := initInfluxExporter(rawURL, tt.token, tt.org, tt.bucket); err != nil {
+				t.Fatal(err)
+			}
+			if err := pushMetricsToInflux(flows, nil, nil, "192.0.2.10"); err != nil {
+				t.Fatalf("push: %v", err)
+			}
+
+			var got strings.Builder
+			for got.Len() < len(want) {
+				select {
+				case data := <-received:
+					if tt.datagrams {
+						if len(data) > influxUDPPayloadSize || !bytes.HasSuffix(data, []byte("\n")) {
+							t.Errorf("datagram of %d bytes does not end on a line boundary", len(data))
+						}
+					}
+					got.Write(data)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out after %d of %d bytes", got.Len(), len(want))
+				}
+			}
+			if got.String() != want {
+				t.Errorf("received:\n%s\nwant:\n%s", got.String(), want)
+			}
+		})
+	}
+}
+
+func TestInitInfluxExporterErrors(t *testing.T) {
+	t.Cleanup(func() { influxEnabled, influxURL, influxToken = false, nil, "" })
+	for _, rawURL := range []string{
+		"http://localhost:8086/api/v2/write", // 缺少 bucket
+		"tcp://localhost:8094",
+		"udp://",
+	} {
+		if err := initInfluxExporter(rawURL, "", "", ""); err == nil {
+			t.Errorf("initInfluxExporter(%q) succeeded", rawURL)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// 接口名是否包含通配符（例如 ib*、ens*f*np*）
+func isInterfacePattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// 校验接口名 / 通配符模式
+func validateInterfacePattern(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("无效的接口匹配模式 %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// 接口名是否匹配任一模式
+func matchInterface(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 接口删除后保留监控 goroutine 的时间：驱动重载时接口会以新的 ifindex 重新出现，
+// 在此期间重新出现的同名接口沿用原有的 eBPF map 和 lastStats
+const ifaceRemovedGracePeriod = 2 * time.Minute
+
+// 单个接口的监控 goroutine
+type ifaceMonitor struct {
+	name       string
+	stop       chan struct{}    // 关闭后监控 goroutine 卸载 XDP 并退出
+	done       chan struct{}    // 监控 goroutine 退出后关闭
+	ticks      chan collectTick // 调度器发送的采集请求
+	grace      *time.Timer      // 接口被删除后等待重新出现的计时器
+	collecting bool             // XDP 已挂载、开始周期采集（受 ifaceManager.mu 保护）
+}
+
+// 接口管理器：按模式匹配接口，跟随 netlink 事件挂载 / 卸载 XDP
+type ifaceManager struct {
+	patterns []string
+	wg       *sync.WaitGroup
+
+	failed chan error // --on-attach-error=fail 时接收第一个挂载错误
+
+	mu      sync.Mutex
+	running map[int]*ifaceMonitor    // 按 ifindex 索引，接口改名时 ifindex 不变
+	removed map[string]*ifaceMonitor // 接口已删除、等待重新出现的监控（按接口名索引）
+	skipped map[int]string           // 挂载失败后跳过的接口（--on-attach-error=skip），接口删除或改名后清除
+}
+
+func newIfaceManager(patterns []string, wg *sync.WaitGroup) *ifaceManager {
+	return &ifaceManager{
+		patterns: patterns,
+		wg:       wg,
+		failed:   make(chan error, 1),
+		running:  make(map[int]*ifaceMonitor),
+		removed:  make(map[string]*ifaceMonitor),
+		skipped:  make(map[int]string),
+	}
+}
+
+// 当前正在采集的接口（仍在加载或重试挂载的接口不参与采集）
+// 等待重新出现的接口仍在采集，同样包含在内
+func (m *ifaceManager) collectingMonitors() []*ifaceMonitor {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var mons []*ifaceMonitor
+	for _, mon := range m.running {
+		if mon.collecting {
+			mons = append(mons, mon)
+		}
+	}
+	for _, mon := range m.removed {
+		if mon.collecting {
+			mons = append(mons, mon)
+		}
+	}
+	return mons
+}
+
+// 为接口启动监控 goroutine
+func (m *ifaceManager) start(index int, name string) {
+	m.mu.Lock()
+	if _, ok := m.running[index]; ok {
+		m.mu.Unlock()
+		return
+	}
+	mon := &ifaceMonitor{
+		name:  name,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		ticks: make(chan collectTick, 1),
+	}
+	m.running[index] = mon
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(mon.done)
+		err := monitorInterface(name, index, mon.stop, mon.ticks, func() {
+			m.mu.Lock()
+			mon.collecting = true
+			m.mu.Unlock()
+		})
+
+		// 挂载失败等原因提前退出时，从运行列表中移除
+		m.mu.Lock()
+		for i, r := range m.running {
+			if r == mon {
+				delete(m.running, i)
+			}
+		}
+		if m.removed[name] == mon {
+			delete(m.removed, name)
+		}
+		if err != nil && attachErrorAction(onAttachError) == attachActionSkip {
+			m.skipped[index] = name
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			m.handleAttachError(name, err)
+		}
+	}()
+}
+
+// 处理接口加载 / 挂载失败（--on-attach-error 为 fail 或 skip）
+func (m *ifaceManager) handleAttachError(name string, err error) {
+	if attachErrorAction(onAttachError) == attachActionExit {
+		log.Printf("[%s] %v", name, err)
+		select {
+		case m.failed <- fmt.Errorf("[%s] %w", name, err):
+		default: // 已有接口失败，进程正在退出
+		}
+		return
+	}
+	log.Printf("[%s] %v，跳过该接口（接口被删除后重新出现时再次尝试）", name, err)
+}
+
+// 停止接口监控并等待 XDP 卸载完成（避免同一 ifindex 上的新旧程序冲突）
+func (m *ifaceManager) stopMonitor(index int) {
+	m.mu.Lock()
+	mon, ok := m.running[index]
+	if ok {
+		delete(m.running, index)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	close(mon.stop)
+	<-mon.done
+}
+
+// 停止一个已删除接口的监控（宽限期结束仍未重新出现）
+func (m *ifaceManager) stopRemoved(name string, mon *ifaceMonitor) {
+	m.mu.Lock()
+	ok := m.removed[name] == mon
+	if ok {
+		delete(m.removed, name)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	log.Printf("[%s] 接口在 %v 内未重新出现，停止监控", name, ifaceRemovedGracePeriod)
+	close(mon.stop)
+	<-mon.done
+	removeInterfacePins(name)
+}
+
+// 停止所有接口监控
+func (m *ifaceManager) stopAll() {
+	m.mu.Lock()
+	var indexes []int
+	for index := range m.running {
+		indexes = append(indexes, index)
+	}
+	removed := m.removed
+	m.removed = make(map[string]*ifaceMonitor)
+	m.mu.Unlock()
+	for _, index := range indexes {
+		m.stopMonitor(index)
+	}
+	for _, mon := range removed {
+		mon.grace.Stop()
+		close(mon.stop)
+		<-mon.done
+	}
+}
+
+// 处理一个接口出现 / 变化事件
+func (m *ifaceManager) handleLink(index int, name string) {
+	m.mu.Lock()
+	mon, ok := m.running[index]
+	if !ok {
+		// 已跳过的接口：同名时不再尝试，改名后按新名称重新匹配
+		skippedName, skipped := m.skipped[index]
+		if skipped && skippedName == name {
+			m.mu.Unlock()
+			return
+		}
+		delete(m.skipped, index)
+	}
+	m.mu.Unlock()
+
+	if ok {
+		if mon.name == name {
+			return
+		}
+		// 接口改名：按旧名称卸载，新名称匹配时重新挂载
+		log.Printf("[%s] 接口已改名为 %s，卸载 XDP", mon.name, name)
+		m.stopMonitor(index)
+		removeInterfacePins(mon.name)
+	}
+	if !matchInterface(m.patterns, name) {
+		return
+	}
+
+	// 已删除的同名接口重新出现（例如驱动重载）：沿用原监控，由其按新 ifindex 重新挂载
+	m.mu.Lock()
+	mon, ok = m.removed[name]
+	if ok && mon.grace.Stop() {
+		delete(m.removed, name)
+		m.running[index] = mon
+		m.mu.Unlock()
+		log.Printf("[%s] 接口重新出现 (索引: %d)，等待重新挂载 XDP", name, index)
+		return
+	}
+	m.mu.Unlock()
+	if ok {
+		// 宽限期恰好结束，等待旧监控卸载后再重新挂载
+		<-mon.done
+	}
+
+	log.Printf("[%s] 发现匹配的接口 (索引: %d)，挂载 XDP", name, index)
+	m.start(index, name)
+}
+
+// 处理接口删除事件：保留监控一段时间，等待同名接口重新出现
+func (m *ifaceManager) handleLinkRemoved(index int, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mon, ok := m.running[index]
+	if !ok {
+		// 监控启动失败的接口被删除后，不再影响就绪状态
+		delete(m.skipped, index)
+		if _, waiting := m.removed[name]; !waiting {
+			forgetInterfaceHealth(name)
+		}
+		return
+	}
+	delete(m.running, index)
+	if old, exists := m.removed[mon.name]; exists {
+		// 理论上不会出现：同名接口已在等待中，直接结束旧监控
+		old.grace.Stop()
+		close(old.stop)
+	}
+	m.removed[mon.name] = mon
+	mon.grace = time.AfterFunc(ifaceRemovedGracePeriod, func() {
+		m.stopRemoved(mon.name, mon)
+	})
+	log.Printf("[%s] 接口已删除，%v 内重新出现将自动重新挂载", mon.name, ifaceRemovedGracePeriod)
+}
+
+// 运行接口管理器：订阅 netlink 接口事件，直到 stop 关闭
+func (m *ifaceManager) run(stop <-chan struct{}) {
+	updates := make(chan netlink.LinkUpdate, 64)
+	done := make(chan struct{})
+	defer close(done)
+
+	err := netlink.LinkSubscribeWithOptions(updates, done, netlink.LinkSubscribeOptions{
+		ListExisting: true,
+		ErrorCallback: func(err error) {
+			log.Printf("netlink 接口事件订阅错误: %v", err)
+		},
+	})
+	if err != nil {
+		// 无法订阅时退化为启动时的一次性匹配
+		log.Printf("警告: 订阅 netlink 接口事件失败: %v，仅监控当前已存在的接口", err)
+		m.scanExisting()
+		<-stop
+		m.stopAll()
+		return
+	}
+
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				log.Printf("警告: netlink 接口事件订阅已关闭，不再跟踪接口变化")
+				updates = nil
+				continue
+			}
+			attrs := u.Link.Attrs()
+			switch u.Header.Type {
+			case unix.RTM_NEWLINK:
+				m.handleLink(attrs.Index, attrs.Name)
+			case unix.RTM_DELLINK:
+				m.handleLinkRemoved(attrs.Index, attrs.Name)
+			}
+		case <-stop:
+			m.stopAll()
+			return
+		}
+	}
+}
+
+// 匹配当前已存在的接口
+func (m *ifaceManager) scanExisting() {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		log.Printf("获取网络接口列表失败: %v", err)
+		return
+	}
+	for _, iface := range ifaces {
+		m.handleLink(iface.Index, iface.Name)
+	}
+}
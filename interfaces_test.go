@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMatchInterface(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{[]string{"ib0"}, "ib0", true},
+		{[]string{"ib0"}, "ib01", false},
+		{[]string{"ib*"}, "ib0", true},
+		{[]string{"ib*"}, "ib0.8001", true}, // IPoIB 子接口
+		{[]string{"ib*"}, "eth0", false},
+		{[]string{"ib*"}, "vib0", false},
+		{[]string{"ens*f*np*"}, "ens1f0np0", true},
+		{[]string{"ens*f*np*"}, "ens1f0", false},
+		{[]string{"ens*f*np*"}, "ens1f0v0", false}, // VF 代表口不匹配
+		{[]string{"eth?"}, "eth1", true},
+		{[]string{"eth?"}, "eth10", false},
+		{[]string{"eth[0-1]"}, "eth1", true},
+		{[]string{"eth[0-1]"}, "eth2", false},
+		{[]string{"eth[^0]"}, "eth0", false},
+		{[]string{"eth[^0]"}, "eth3", true},
+		// 任一模式匹配即可
+		{[]string{"ib*", "ens*f*np*"}, "ens2f1np1", true},
+		{[]string{"ib*", "ens*f*np*"}, "lo", false},
+		{nil, "ib0", false},
+	}
+	for _, tt := range tests {
+		if got := matchInterface(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("matchInterface(%q, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInterfacePatternSyntax(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		isPattern bool
+		valid     bool
+	}{
+		{"ib0", false, true},
+		{"ens1f0np0", false, true},
+		{"ib*", true, true},
+		{"eth?", true, true},
+		{"eth[0-3]", true, true},
+		{"eth[", true, false},
+		{"eth[a-", true, false},
+		{`ib\`, false, false},
+	}
+	for _, tt := range tests {
+		if got := isInterfacePattern(tt.pattern); got != tt.isPattern {
+			t.Errorf("isInterfacePattern(%q) = %v, want %v", tt.pattern, got, tt.isPattern)
+		}
+		if err := validateInterfacePattern(tt.pattern); (err == nil) != tt.valid {
+			t.Errorf("validateInterfacePattern(%q) = %v, want valid=%v", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
+// 不匹配的接口和已跳过的接口不会启动监控（不涉及 XDP 挂载）
+func TestIfaceManagerIgnoresExcludedLinks(t *testing.T) {
+	m := newIfaceManager([]string{"ib*", "ens*f*np*"}, &sync.WaitGroup{})
+
+	for index, name := range map[int]string{1: "lo", 2: "eth0", 3: "ens1f0v0", 4: "docker0"} {
+		m.handleLink(index, name)
+	}
+	if len(m.running) != 0 {
+		t.Errorf("started monitors for unmatched interfaces: %v", m.running)
+	}
+
+	// 挂载失败后跳过的接口：同名事件不再尝试
+	m.skipped[5] = "ib0"
+	m.handleLink(5, "ib0")
+	if len(m.running) != 0 || m.skipped[5] != "ib0" {
+		t.Errorf("skipped interface retried: running %v skipped %v", m.running, m.skipped)
+	}
+	// 改名为不匹配的名称后清除跳过记录，且不启动监控
+	m.handleLink(5, "eth5")
+	if len(m.running) != 0 {
+		t.Errorf("started monitor after rename: %v", m.running)
+	}
+	if _, ok := m.skipped[5]; ok {
+		t.Errorf("skipped entry kept after rename: %v", m.skipped)
+	}
+}
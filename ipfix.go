@@ -0,0 +1,381 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// IPFIX (RFC 7011) / NetFlow v9 (RFC 3954) 导出器
+const (
+	ipfixVersion     = 10
+	netflowV9Version = 9
+
+	// 模板 ID（>= 256 为数据模板）
+	ipfixTemplateID = 256
+
+	// UDP 上的模板需要周期性重发，采集器重启后才能重新解码
+	ipfixTemplateRefresh = time.Minute
+
+	// 单个导出报文的最大长度（避免 IP 分片）
+	ipfixMaxPacketSize = 1400
+
+	// 默认企业号：RFC 5612 文档示例企业号，生产环境应配置为自己的 PEN
+	defaultIPFIXEnterpriseID = 32473
+
+	// 企业私有 IE：RDMA/RoCE 流量类型（unsigned8，取值见 ipfixTrafficTypeCode）
+	ipfixIETrafficType = 1
+
+	// NetFlow v9 没有企业 IE，使用厂商私有字段类型承载流量类型
+	netflowV9FieldTrafficType = 40001
+)
+
+// 模板字段定义
+type ipfixField struct {
+	id         uint16
+	length     uint16
+	enterprise bool // 是否为企业私有 IE（仅 IPFIX）
+}
+
+// IPFIX 数据模板：五元组 + 入接口 + 增量计数 + 流起止时间 + 流量类型
+var ipfixTemplateFields = []ipfixField{
+	{id: 8, length: 4},   // sourceIPv4Address
+	{id: 12, length: 4},  // destinationIPv4Address
+	{id: 7, length: 2},   // sourceTransportPort
+	{id: 11, length: 2},  // destinationTransportPort
+	{id: 4, length: 1},   // protocolIdentifier
+	{id: 10, length: 4},  // ingressInterface
+	{id: 1, length: 8},   // octetDeltaCount
+	{id: 2, length: 8},   // packetDeltaCount
+	{id: 152, length: 8}, // flowStartMilliseconds
+	{id: 153, length: 8}, // flowEndMilliseconds
+	{id: ipfixIETrafficType, length: 1, enterprise: true},
+}
+
+// NetFlow v9 数据模板（时间使用相对 sysUptime 的毫秒数）
+var netflowV9TemplateFields = []ipfixField{
+	{id: 8, length: 4},  // IPV4_SRC_ADDR
+	{id: 12, length: 4}, // IPV4_DST_ADDR
+	{id: 7, length: 2},  // L4_SRC_PORT
+	{id: 11, length: 2}, // L4_DST_PORT
+	{id: 4, length: 1},  // PROTOCOL
+	{id: 10, length: 4}, // INPUT_SNMP
+	{id: 1, length: 8},  // IN_BYTES
+	{id: 2, length: 8},  // IN_PKTS
+	{id: 22, length: 4}, // FIRST_SWITCHED
+	{id: 21, length: 4}, // LAST_SWITCHED
+	{id: netflowV9FieldTrafficType, length: 1},
+}
+
+// 流量类型编码（企业 IE 的取值）
+func ipfixTrafficTypeCode(trafficType string) uint8 {
+	switch trafficType {
+	case "TCP":
+		return 1
+	case "UDP":
+		return 2
+	case "RoCE_v2":
+		return 3
+	case "RoCE_v2_UDP":
+		return 4
+	case "RoCE_v1_IBoE":
+		return 5
+	case "InfiniBand":
+		return 6
+	default:
+		return 0
+	}
+}
+
+// IPFIX / NetFlow v9 导出器（全局变量）
+var (
+	ipfixEnabled bool
+	ipfixConn    net.Conn
+	ipfixEnc     *ipfixEncoder
+)
+
+// 报文编码器，维护序列号和模板重发时间
+type ipfixEncoder struct {
+	version      uint16
+	domainID     uint32
+	enterpriseID uint32
+	bootTime     time.Time // NetFlow v9 sysUptime 的起点：系统启动时刻，回放时为抓包文件的第一个采集周期
+
+	sequence     uint32 // IPFIX: 已发送数据记录数；NetFlow v9: 已发送报文数
+	lastTemplate time.Time
+	ifindexCache map[string]uint32 // 本轮导出的接口索引
+}
+
+// 初始化 IPFIX / NetFlow v9 导出器
+func initIPFIXExporter(collector, version, domainID, enterpriseID string) error {
+	if collector == "" {
+		collector = "localhost:4739"
+	}
+
+	enc := &ipfixEncoder{
+		domainID:     1,
+		enterpriseID: defaultIPFIXEnterpriseID,
+		bootTime:     systemBootTime(),
+		ifindexCache: make(map[string]uint32),
+	}
+
+	switch strings.ToLower(strings.TrimSpace(version)) {
+	case "", "ipfix", "10":
+		enc.version = ipfixVersion
+	case "netflow9", "netflow", "v9", "9":
+		enc.version = netflowV9Version
+	default:
+		return fmt.Errorf("不支持的导出协议版本: %s（可选: ipfix, netflow9）", version)
+	}
+
+	if domainID != "" {
+		v, err := strconv.ParseUint(domainID, 10, 32)
+		if err != nil {
+			return fmt.Errorf("无效的 Observation Domain ID: %s", domainID)
+		}
+		enc.domainID = uint32(v)
+	}
+	if enterpriseID != "" {
+		v, err := strconv.ParseUint(enterpriseID, 10, 32)
+		if err != nil {
+			return fmt.Errorf("无效的企业号: %s", enterpriseID)
+		}
+		enc.enterpriseID = uint32(v)
+	}
+
+	conn, err := net.Dial("udp", collector)
+	if err != nil {
+		return fmt.Errorf("连接流采集器 %s 失败: %w", collector, err)
+	}
+
+	ipfixConn = conn
+	ipfixEnc = enc
+	ipfixEnabled = true
+
+	name := "IPFIX"
+	if enc.version == netflowV9Version {
+		name = "NetFlow v9"
+	}
+	log.Printf("%s 导出器配置: %s (observation domain: %d, enterprise: %d)", name, collector, enc.domainID, enc.enterpriseID)
+	return nil
+}
+
+// 计算系统启动时刻（wall clock - CLOCK_MONOTONIC），bpf_ktime_get_ns 与 CLOCK_MONOTONIC 同源
+func systemBootTime() time.Time {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return time.Now()
+	}
+	return time.Now().Add(-time.Duration(ts.Nano()))
+}
+
+// 回放时以抓包文件的时钟计算 sysUptime（数据包时间早于本机启动时刻）
+func setIPFIXUptimeBase(start time.Time) {
+	if ipfixEnc != nil {
+		ipfixEnc.bootTime = start
+	}
+}
+
+// 推送本轮流样本到 IPFIX / NetFlow v9 采集器（now 为采集周期时刻）
+func pushFlowsToIPFIX(flows []FlowSample, now time.Time) error {
+	for _, pkt := range ipfixEnc.encode(flows, now) {
+		if _, err := ipfixConn.Write(pkt); err != nil {
+			return fmt.Errorf("发送流记录失败: %w", err)
+		}
+		addPushPayload(exporterIPFIX, len(pkt))
+	}
+	return nil
+}
+
+// 关闭 IPFIX 导出器
+func closeIPFIXExporter() {
+	if ipfixConn != nil {
+		ipfixConn.Close()
+	}
+}
+
+// 将流样本编码为若干个导出报文（跳过本周期无增量的流）
+func (e *ipfixEncoder) encode(flows []FlowSample, now time.Time) [][]byte {
+	fields := ipfixTemplateFields
+	if e.version == netflowV9Version {
+		fields = netflowV9TemplateFields
+	}
+	recordLen := 0
+	for _, f := range fields {
+		recordLen += int(f.length)
+	}
+
+	headerLen := 16
+	if e.version == netflowV9Version {
+		headerLen = 20
+	}
+
+	// 接口可能被重命名或重建（多接口管理器重新挂载），每轮导出重新查询接口索引
+	clear(e.ifindexCache)
+
+	var packets [][]byte
+	sendTemplate := now.Sub(e.lastTemplate) >= ipfixTemplateRefresh
+
+	i := 0
+	for i < len(flows) || sendTemplate {
+		pkt := make([]byte, headerLen, ipfixMaxPacketSize)
+		records := 0 // 报文中的记录数（NetFlow v9 头部需要，含模板记录）
+
+		if sendTemplate {
+			pkt = e.appendTemplateSet(pkt, fields)
+			records++
+			sendTemplate = false
+			e.lastTemplate = now
+		}
+
+		// 数据集：尽可能多地装入记录（预留 Set 头部和 4 字节对齐填充）
+		setStart := len(pkt)
+		dataRecords := 0
+		for i < len(flows) && len(pkt)+8+recordLen <= ipfixMaxPacketSize {
+			s := flows[i]
+			i++
+			if s.DeltaPackets == 0 {
+				continue
+			}
+			if dataRecords == 0 {
+				pkt = binary.BigEndian.AppendUint16(pkt, ipfixTemplateID)
+				pkt = binary.BigEndian.AppendUint16(pkt, 0) // 长度稍后回填
+			}
+			pkt = e.appendDataRecord(pkt, s)
+			dataRecords++
+		}
+		if dataRecords > 0 {
+			// NetFlow v9 的 FlowSet 需要 4 字节对齐
+			if e.version == netflowV9Version {
+				for (len(pkt)-setStart)%4 != 0 {
+					pkt = append(pkt, 0)
+				}
+			}
+			binary.BigEndian.PutUint16(pkt[setStart+2:], uint16(len(pkt)-setStart))
+			records += dataRecords
+		}
+
+		if records == 0 {
+			continue
+		}
+		e.putHeader(pkt, records, dataRecords, now)
+		packets = append(packets, pkt)
+	}
+
+	return packets
+}
+
+// 追加模板集
+func (e *ipfixEncoder) appendTemplateSet(pkt []byte, fields []ipfixField) []byte {
+	setStart := len(pkt)
+	setID := uint16(2) // IPFIX Template Set
+	if e.version == netflowV9Version {
+		setID = 0 // NetFlow v9 Template FlowSet
+	}
+	pkt = binary.BigEndian.AppendUint16(pkt, setID)
+	pkt = binary.BigEndian.AppendUint16(pkt, 0) // 长度稍后回填
+	pkt = binary.BigEndian.AppendUint16(pkt, ipfixTemplateID)
+	pkt = binary.BigEndian.AppendUint16(pkt, uint16(len(fields)))
+	for _, f := range fields {
+		if f.enterprise {
+			pkt = binary.BigEndian.AppendUint16(pkt, f.id|0x8000)
+			pkt = binary.BigEndian.AppendUint16(pkt, f.length)
+			pkt = binary.BigEndian.AppendUint32(pkt, e.enterpriseID)
+		} else {
+			pkt = binary.BigEndian.AppendUint16(pkt, f.id)
+			pkt = binary.BigEndian.AppendUint16(pkt, f.length)
+		}
+	}
+	binary.BigEndian.PutUint16(pkt[setStart+2:], uint16(len(pkt)-setStart))
+	return pkt
+}
+
+// 追加一条数据记录（字段顺序与模板一致）
+func (e *ipfixEncoder) appendDataRecord(pkt []byte, s FlowSample) []byte {
+	// IP 地址在 FlowKey 中保持网络字节序
+	pkt = binary.LittleEndian.AppendUint32(pkt, s.Key.SrcIP)
+	pkt = binary.LittleEndian.AppendUint32(pkt, s.Key.DstIP)
+	pkt = binary.BigEndian.AppendUint16(pkt, s.SrcPort)
+	pkt = binary.BigEndian.AppendUint16(pkt, s.DstPort)
+
+	// RoCE v2 在 BPF 中使用 0xFE 标记，导出时还原为真实的 UDP 协议号
+	proto := s.Key.Proto
+	if proto == 0xFE {
+		proto = 17
+	}
+	pkt = append(pkt, proto)
+	pkt = binary.BigEndian.AppendUint32(pkt, e.ifindex(s.Interface))
+	pkt = binary.BigEndian.AppendUint64(pkt, s.DeltaBytes)
+	pkt = binary.BigEndian.AppendUint64(pkt, s.DeltaPackets)
+
+	// 流起止时间：起点为本采集周期开始，终点为流的最后更新时间（已按时钟偏移换算）
+	end := s.LastSeen
+	start := s.Timestamp.Add(-time.Duration(s.Interval * float64(time.Second)))
+	if end.IsZero() || end.After(s.Timestamp) {
+		end = s.Timestamp
+	}
+	if start.After(end) {
+		start = end
+	}
+
+	if e.version == netflowV9Version {
+		pkt = binary.BigEndian.AppendUint32(pkt, e.uptimeMillis(start))
+		pkt = binary.BigEndian.AppendUint32(pkt, e.uptimeMillis(end))
+	} else {
+		pkt = binary.BigEndian.AppendUint64(pkt, uint64(start.UnixMilli()))
+		pkt = binary.BigEndian.AppendUint64(pkt, uint64(end.UnixMilli()))
+	}
+
+	return append(pkt, ipfixTrafficTypeCode(s.TrafficType))
+}
+
+// 回填报文头部并更新序列号
+func (e *ipfixEncoder) putHeader(pkt []byte, records, dataRecords int, now time.Time) {
+	if e.version == netflowV9Version {
+		binary.BigEndian.PutUint16(pkt[0:], netflowV9Version)
+		binary.BigEndian.PutUint16(pkt[2:], uint16(records))
+		binary.BigEndian.PutUint32(pkt[4:], e.uptimeMillis(now))
+		binary.BigEndian.PutUint32(pkt[8:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(pkt[12:], e.sequence)
+		binary.BigEndian.PutUint32(pkt[16:], e.domainID)
+		e.sequence++
+		return
+	}
+
+	binary.BigEndian.PutUint16(pkt[0:], ipfixVersion)
+	binary.BigEndian.PutUint16(pkt[2:], uint16(len(pkt)))
+	binary.BigEndian.PutUint32(pkt[4:], uint32(now.Unix()))
+	binary.BigEndian.PutUint32(pkt[8:], e.sequence)
+	binary.BigEndian.PutUint32(pkt[12:], e.domainID)
+	e.sequence += uint32(dataRecords)
+}
+
+// 换算为 sysUptime 毫秒数（早于起点的时刻记为 0，避免 uint32 回绕）
+func (e *ipfixEncoder) uptimeMillis(t time.Time) uint32 {
+	if t.Before(e.bootTime) {
+		return 0
+	}
+	return uint32(t.Sub(e.bootTime).Milliseconds())
+}
+
+// 获取接口索引（在一轮导出内缓存，接口不存在时返回 0）
+func (e *ipfixEncoder) ifindex(iface string) uint32 {
+	if idx, ok := e.ifindexCache[iface]; ok {
+		return idx
+	}
+	var idx uint32
+	if ifi, err := net.InterfaceByName(iface); err == nil {
+		idx = uint32(ifi.Index)
+	}
+	e.ifindexCache[iface] = idx
+	return idx
+}
@@ -0,0 +1,308 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// 解码后的导出报文
+type decodedFlowPacket struct {
+	version    uint16
+	count      uint16 // NetFlow v9: 记录数；IPFIX: 报文长度
+	exportTime uint32
+	sequence   uint32
+	domainID   uint32
+	template   []ipfixField // 报文中的模板（没有模板时为 nil）
+	enterprise []uint32     // 企业 IE 的企业号
+	records    [][]byte
+}
+
+// 按 RFC 7011 / RFC 3954 解码导出报文，数据记录按报文内的模板切分
+func decodeFlowPacket(t *testing.T, pkt []byte, recordLen int) decodedFlowPacket {
+	t.Helper()
+	var d decodedFlowPacket
+	d.version = binary.BigEndian.Uint16(pkt[0:])
+	d.count = binary.BigEndian.Uint16(pkt[2:])
+	off := 16
+	templateSetID := uint16(2)
+	if d.version == netflowV9Version {
+		d.exportTime = binary.BigEndian.Uint32(pkt[8:])
+		d.sequence = binary.BigEndian.Uint32(pkt[12:])
+		d.domainID = binary.BigEndian.Uint32(pkt[16:])
+		off = 20
+		templateSetID = 0
+	} else {
+		if int(d.count) != len(pkt) {
+			t.Errorf("IPFIX length = %d, packet is %d bytes", d.count, len(pkt))
+		}
+		d.exportTime = binary.BigEndian.Uint32(pkt[4:])
+		d.sequence = binary.BigEndian.Uint32(pkt[8:])
+		d.domainID = binary.BigEndian.Uint32(pkt[12:])
+	}
+
+	for off < len(pkt) {
+		id := binary.BigEndian.Uint16(pkt[off:])
+		length := int(binary.BigEndian.Uint16(pkt[off+2:]))
+		if length < 4 || off+length > len(pkt) {
+			t.Fatalf("bad set length %d at offset %d", length, off)
+		}
+		if d.version == netflowV9Version && length%4 != 0 {
+			t.Errorf("flowset %d length %d is not 4-byte aligned", id, length)
+		}
+		body := pkt[off+4 : off+length]
+		switch id {
+		case templateSetID:
+			if tid := binary.BigEndian.Uint16(body); tid != ipfixTemplateID {
+				t.Errorf("template ID = %d", tid)
+			}
+			n := int(binary.BigEndian.Uint16(body[2:]))
+			p := 4
+			for i := 0; i < n; i++ {
+				f := ipfixField{id: binary.BigEndian.Uint16(body[p:]), length: binary.BigEndian.Uint16(body[p+2:])}
+				p += 4
+				if d.version == ipfixVersion && f.id&0x8000 != 0 {
+					f.id &^= 0x8000
+					f.enterprise = true
+					d.enterprise = append(d.enterprise, binary.BigEndian.Uint32(body[p:]))
+					p += 4
+				}
+				d.template = append(d.template, f)
+			}
+			if p != len(body) {
+				t.Errorf("template set has %d trailing bytes", len(body)-p)
+			}
+		case ipfixTemplateID:
+			for len(body) >= recordLen {
+				d.records = append(d.records, body[:recordLen])
+				body = body[recordLen:]
+			}
+			for _, b := range body {
+				if b != 0 {
+					t.Errorf("non-zero padding %x", body)
+					break
+				}
+			}
+		default:
+			t.Errorf("unexpected set ID %d", id)
+		}
+		off += length
+	}
+	return d
+}
+
+func testFlowSample(i int, epoch time.Time) FlowSample {
+	return FlowSample{
+		Key: FlowKey{
+			SrcIP: binary.LittleEndian.Uint32([]byte{10, 0, 0, byte(i)}),
+			DstIP: binary.LittleEndian.Uint32([]byte{10, 0, 1, byte(i)}),
+			Proto: 0xFE,
+		},
+		SrcPort:      uint16(50000 + i),
+		DstPort:      4791,
+		Interface:    "lo",
+		TrafficType:  "RoCE_v2",
+		DeltaBytes:   uint64(1000 * (i + 1)),
+		DeltaPackets: uint64(i + 1),
+		Timestamp:    epoch,
+		Interval:     5,
+		LastSeen:     epoch.Add(-time.Second),
+	}
+}
+
+// sysUptime 早于起点的时刻记为 0
+func TestIPFIXUptimeMillis(t *testing.T) {
+	boot := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := &ipfixEncoder{version: netflowV9Version, bootTime: boot}
+	if got := e.uptimeMillis(boot.Add(90 * time.Second)); got != 90000 {
+		t.Errorf("uptimeMillis = %d, want 90000", got)
+	}
+	if got := e.uptimeMillis(boot.Add(-time.Hour)); got != 0 {
+		t.Errorf("uptimeMillis before base = %d, want 0", got)
+	}
+}
+
+func TestIPFIXReplayTimestamps(t *testing.T) {
+	// 抓包文件中的时刻远早于本机启动时刻
+	epoch := time.Date(2024, 3, 1, 12, 0, 10, 0, time.UTC)
+	flow := FlowSample{
+		Key:          FlowKey{Proto: 6},
+		Interface:    "replay0",
+		TrafficType:  "TCP",
+		DeltaBytes:   1000,
+		DeltaPackets: 10,
+		Timestamp:    epoch,
+		Interval:     5,
+		Stats:        FlowStats{LastUpdate: uint64(epoch.Add(-time.Second).UnixNano())},
+		LastSeen:     epoch.Add(-time.Second),
+	}
+
+	t.Run("ipfix", func(t *testing.T) {
+		e := &ipfixEncoder{version: ipfixVersion, bootTime: systemBootTime(), ifindexCache: make(map[string]uint32)}
+		pkts := e.encode([]FlowSample{flow}, epoch)
+		if len(pkts) != 1 {
+			t.Fatalf("got %d packets", len(pkts))
+		}
+		if got := binary.BigEndian.Uint32(pkts[0][4:]); got != uint32(epoch.Unix()) {
+			t.Errorf("export time = %d, want %d", got, epoch.Unix())
+		}
+		rec := decodeFlowPacket(t, pkts[0], 50).records[0]
+		start, end := binary.BigEndian.Uint64(rec[33:]), binary.BigEndian.Uint64(rec[41:])
+		if start != uint64(epoch.Add(-5*time.Second).UnixMilli()) || end != uint64(flow.LastSeen.UnixMilli()) {
+			t.Errorf("flowStart = %d flowEnd = %d", start, end)
+		}
+	})
+
+	t.Run("netflow9", func(t *testing.T) {
+		e := &ipfixEncoder{version: netflowV9Version, bootTime: systemBootTime(), ifindexCache: make(map[string]uint32)}
+		ipfixEnc = e
+		t.Cleanup(func() { ipfixEnc = nil })
+		setIPFIXUptimeBase(epoch.Add(-5 * time.Second))
+
+		pkts := e.encode([]FlowSample{flow}, epoch)
+		if len(pkts) != 1 {
+			t.Fatalf("got %d packets", len(pkts))
+		}
+		if got := binary.BigEndian.Uint32(pkts[0][4:]); got != 5000 {
+			t.Errorf("sysUptime = %d, want 5000", got)
+		}
+		rec := decodeFlowPacket(t, pkts[0], 42).records[0]
+		first, last := binary.BigEndian.Uint32(rec[33:]), binary.BigEndian.Uint32(rec[37:])
+		if first != 0 || last != 4000 {
+			t.Errorf("FIRST_SWITCHED = %d LAST_SWITCHED = %d, want 0 / 4000", first, last)
+		}
+	})
+}
+
+func TestIPFIXEncode(t *testing.T) {
+	epoch := time.Date(2025, 1, 1, 0, 0, 5, 0, time.UTC)
+	e := &ipfixEncoder{version: ipfixVersion, domainID: 7, enterpriseID: 12345, ifindexCache: make(map[string]uint32)}
+	idle := testFlowSample(2, epoch)
+	idle.DeltaBytes, idle.DeltaPackets = 0, 0
+
+	pkts := e.encode([]FlowSample{testFlowSample(0, epoch), idle, testFlowSample(1, epoch)}, epoch)
+	if len(pkts) != 1 {
+		t.Fatalf("got %d packets, want 1", len(pkts))
+	}
+	d := decodeFlowPacket(t, pkts[0], 50)
+	if d.version != ipfixVersion || d.exportTime != uint32(epoch.Unix()) || d.sequence != 0 || d.domainID != 7 {
+		t.Errorf("header = %+v", d)
+	}
+	if len(d.template) != len(ipfixTemplateFields) {
+		t.Fatalf("template has %d fields, want %d", len(d.template), len(ipfixTemplateFields))
+	}
+	for i, f := range ipfixTemplateFields {
+		if d.template[i] != f {
+			t.Errorf("template field %d = %+v, want %+v", i, d.template[i], f)
+		}
+	}
+	if len(d.enterprise) != 1 || d.enterprise[0] != 12345 {
+		t.Errorf("enterprise numbers = %v, want [12345]", d.enterprise)
+	}
+
+	// 无增量的流不导出
+	if len(d.records) != 2 {
+		t.Fatalf("got %d records, want 2", len(d.records))
+	}
+	rec := d.records[1]
+	if string(rec[0:4]) != string([]byte{10, 0, 0, 1}) || string(rec[4:8]) != string([]byte{10, 0, 1, 1}) {
+		t.Errorf("addresses = %v -> %v", rec[0:4], rec[4:8])
+	}
+	if sp, dp := binary.BigEndian.Uint16(rec[8:]), binary.BigEndian.Uint16(rec[10:]); sp != 50001 || dp != 4791 {
+		t.Errorf("ports = %d -> %d", sp, dp)
+	}
+	if rec[12] != 17 {
+		t.Errorf("protocol = %d, want 17 for RoCE v2", rec[12])
+	}
+	if lo, err := net.InterfaceByName("lo"); err == nil && binary.BigEndian.Uint32(rec[13:]) != uint32(lo.Index) {
+		t.Errorf("ingressInterface = %d, want %d", binary.BigEndian.Uint32(rec[13:]), lo.Index)
+	}
+	if b, p := binary.BigEndian.Uint64(rec[17:]), binary.BigEndian.Uint64(rec[25:]); b != 2000 || p != 2 {
+		t.Errorf("octets = %d packets = %d", b, p)
+	}
+	if rec[49] != 3 {
+		t.Errorf("traffic type = %d, want 3", rec[49])
+	}
+
+	// 序列号为已发送的数据记录数；一分钟内不重发模板
+	pkts = e.encode([]FlowSample{testFlowSample(3, epoch)}, epoch.Add(5*time.Second))
+	d = decodeFlowPacket(t, pkts[0], 50)
+	if d.sequence != 2 || d.template != nil || len(d.records) != 1 {
+		t.Errorf("second packet: sequence = %d template = %v records = %d", d.sequence, d.template, len(d.records))
+	}
+
+	// 模板刷新：没有数据时也单独发送模板
+	pkts = e.encode(nil, epoch.Add(ipfixTemplateRefresh))
+	if len(pkts) != 1 {
+		t.Fatalf("got %d packets on template refresh, want 1", len(pkts))
+	}
+	d = decodeFlowPacket(t, pkts[0], 50)
+	if d.sequence != 3 || d.template == nil || len(d.records) != 0 {
+		t.Errorf("refresh packet: sequence = %d template = %v records = %d", d.sequence, d.template, len(d.records))
+	}
+}
+
+func TestNetFlowV9Encode(t *testing.T) {
+	epoch := time.Date(2025, 1, 1, 0, 0, 5, 0, time.UTC)
+	e := &ipfixEncoder{version: netflowV9Version, domainID: 3, bootTime: epoch.Add(-time.Hour), ifindexCache: make(map[string]uint32)}
+
+	// 超过单个报文长度时拆分为多个报文
+	var flows []FlowSample
+	for i := 0; i < 60; i++ {
+		flows = append(flows, testFlowSample(i, epoch))
+	}
+	pkts := e.encode(flows, epoch)
+	if len(pkts) < 2 {
+		t.Fatalf("got %d packets, want at least 2", len(pkts))
+	}
+	total := 0
+	for i, pkt := range pkts {
+		if len(pkt) > ipfixMaxPacketSize {
+			t.Errorf("packet %d is %d bytes", i, len(pkt))
+		}
+		d := decodeFlowPacket(t, pkt, 42)
+		// NetFlow v9 序列号按报文递增，count 包含模板记录
+		if d.version != netflowV9Version || d.sequence != uint32(i) || d.domainID != 3 {
+			t.Errorf("packet %d header = %+v", i, d)
+		}
+		want := len(d.records)
+		if i == 0 {
+			want++
+			if len(d.template) != len(netflowV9TemplateFields) || d.enterprise != nil {
+				t.Errorf("template = %+v enterprise = %v", d.template, d.enterprise)
+			}
+		} else if d.template != nil {
+			t.Errorf("packet %d repeats the template", i)
+		}
+		if int(d.count) != want {
+			t.Errorf("packet %d count = %d, want %d", i, d.count, want)
+		}
+		if up := binary.BigEndian.Uint32(pkt[4:]); up != uint32(time.Hour.Milliseconds()) {
+			t.Errorf("sysUptime = %d", up)
+		}
+		total += len(d.records)
+	}
+	if total != len(flows) {
+		t.Errorf("exported %d records, want %d", total, len(flows))
+	}
+}
+
+func TestIPFIXIfindexRefreshedPerExport(t *testing.T) {
+	epoch := time.Date(2025, 1, 1, 0, 0, 5, 0, time.UTC)
+	e := &ipfixEncoder{version: ipfixVersion, ifindexCache: make(map[string]uint32)}
+	// 上一轮导出时的接口索引（接口随后被删除重建）
+	e.ifindexCache["lo"] = 9999
+
+	d := decodeFlowPacket(t, e.encode([]FlowSample{testFlowSample(0, epoch)}, epoch)[0], 50)
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+	if got := binary.BigEndian.Uint32(d.records[0][13:]); got != uint32(lo.Index) {
+		t.Errorf("ingressInterface = %d, want %d", got, lo.Index)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"runtime"
 	"strings"
 )
 
@@ -29,15 +30,6 @@ func getHostIP() string {
 	return "unknown"
 }
 
-// 获取网络接口索引
-func ifaceIndex(ifaceName string) int {
-	iface, err := net.InterfaceByName(ifaceName)
-	if err != nil {
-		log.Fatalf("failed to get interface %s: %v", ifaceName, err)
-	}
-	return iface.Index
-}
-
 // 检查网络接口是否存在
 func isValidInterface(ifaceName string) bool {
 	_, err := net.InterfaceByName(ifaceName)
@@ -61,30 +53,98 @@ func listNetworkInterfaces() {
 	}
 }
 
+// 可重复指定的字符串参数（例如 --aggregate 多次）
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 func main() {
+	// 子命令：离线回放抓包文件、自检
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "selftest":
+			runSelftest(os.Args[2:])
+			return
+		}
+	}
+
 	// 命令行参数解析
 	var iface string
 	var showHelp bool
+	var showVersion bool
 	var listInterfaces bool
 	var filterTraffic string
 	var excludeDNS bool
 	var intervalMs int
+	var output string
+	var tui bool
+	var topFlowsN int
+	var aggregates stringListFlag
+	var flowMetrics bool
+	var conversations string
+	var flowEventsOut string
+	var flowIdleTimeoutMs int
+	var elephantRateMbps int
+	var elephantShare float64
+	var elephantTicks int
+	var linkSpeedMbps int
+	var burstSlotUs int
+	var pin bool
+	var pinDir string
+	var onAttachErr string
+	var healthListen string
+	var pprofEnabled bool
 
-	flag.StringVar(&iface, "i", "", "网络接口名称，支持多个接口用逗号分隔 (例如: eth0, eth0,eth1,ib0)")
-	flag.StringVar(&iface, "interface", "", "网络接口名称，支持多个接口用逗号分隔 (例如: eth0, eth0,eth1,ib0)")
+	flag.StringVar(&configPath, "c", "", "配置文件路径（.yaml/.yml/.toml），收到 SIGHUP 时重新加载")
+	flag.StringVar(&configPath, "config", "", "配置文件路径（.yaml/.yml/.toml），收到 SIGHUP 时重新加载")
+	flag.StringVar(&iface, "i", "", "网络接口名称或通配符，支持多个用逗号分隔 (例如: eth0, eth0,ib0, 'ib*,ens*f*np*')")
+	flag.StringVar(&iface, "interface", "", "网络接口名称或通配符，支持多个用逗号分隔 (例如: eth0, eth0,ib0, 'ib*,ens*f*np*')")
+	flag.StringVar(&onAttachErr, "on-attach-error", attachErrorSkip, "接口加载或挂载 XDP 失败时的处理: fail（退出）、skip（跳过该接口）、retry（按退避重试）")
 	flag.StringVar(&filterTraffic, "f", "", "过滤流量类型: roce, roce_v1, roce_v2, tcp, udp, ib, all")
 	flag.StringVar(&filterTraffic, "filter", "", "过滤流量类型: roce, roce_v1, roce_v2, tcp, udp, ib, all")
 	flag.BoolVar(&excludeDNS, "exclude-dns", false, "排除DNS流量（过滤常见DNS服务器）")
 	flag.IntVar(&intervalMs, "t", 5000, "数据采集和推送间隔（毫秒），默认5000ms")
 	flag.IntVar(&intervalMs, "interval", 5000, "数据采集和推送间隔（毫秒），默认5000ms")
+	flag.StringVar(&output, "o", outputText, "标准输出格式: text, json, csv")
+	flag.StringVar(&output, "output", outputText, "标准输出格式: text, json, csv")
+	flag.IntVar(&topFlowsN, "top-flows", 0, "每个接口只导出字节数最多的 N 个流，其余按流量类型汇总为 other（0 表示不限制）")
+	flag.Var(&aggregates, "aggregate", "额外的聚合层级，可重复指定 (例如: src_ip,dst_ip 或 rack=src_subnet/24,dst_subnet/24)")
+	flag.BoolVar(&flowMetrics, "flow-metrics", true, "导出五元组级别的流指标（false 时只导出 NIC 和聚合层级指标）")
+	flag.StringVar(&conversations, "conversations", "", "合并两个方向的流为会话输出，并导出 xtrace_conversation_* 指标: ip（按 IP 对）, port（按五元组）")
+	flag.StringVar(&flowEventsOut, "flow-events", "", "输出流开始 / 结束事件: stdout、文件路径或 http(s):// webhook")
+	flag.IntVar(&flowIdleTimeoutMs, "flow-idle-timeout", defaultFlowIdleTimeoutMs, "流超过该时间（毫秒）没有新数据包时视为结束")
+	flag.IntVar(&elephantRateMbps, "elephant-rate", 0, "大象流速率阈值（Mbit/s），0 表示不按速率判定；xtrace_elephant_flow 只推送到 VictoriaMetrics")
+	flag.Float64Var(&elephantShare, "elephant-share", 0, "大象流占接口带宽的百分比阈值（0-100），0 表示不按占比判定；xtrace_elephant_flow 只推送到 VictoriaMetrics")
+	flag.IntVar(&elephantTicks, "elephant-ticks", defaultElephantTicks, "连续超过阈值多少个采集周期后判定为大象流")
+	flag.IntVar(&linkSpeedMbps, "link-speed", 0, "大象流占比使用的接口带宽（Mbit/s），0 表示从 /sys/class/net/<iface>/speed 读取")
+	flag.IntVar(&burstSlotUs, "burst-slot", 0, "微突发统计的时间片长度（微秒），0 表示关闭（需要重启生效）")
+	flag.BoolVar(&pin, "pin", false, "将 XDP link 和 flows map 固定到 bpffs，重启后沿用（升级不中断采集）")
+	flag.StringVar(&pinDir, "pin-path", defaultPinPath, "固定目录，每个接口使用 <pin-path>/<iface>")
+	flag.StringVar(&healthListen, "health-listen", defaultHealthListen, "健康检查 HTTP 监听地址（/healthz、/readyz、/metrics），为空时关闭")
+	flag.BoolVar(&pprofEnabled, "pprof", false, "在健康检查服务上启用 /debug/pprof")
+	flag.BoolVar(&tui, "tui", false, "交互式终端界面（实时排序的流量表）")
 	flag.BoolVar(&showHelp, "h", false, "显示帮助信息")
 	flag.BoolVar(&showHelp, "help", false, "显示帮助信息")
+	flag.BoolVar(&showVersion, "v", false, "显示版本号")
+	flag.BoolVar(&showVersion, "version", false, "显示版本号")
 	flag.BoolVar(&listInterfaces, "l", false, "列出所有可用的网络接口")
 	flag.BoolVar(&listInterfaces, "list", false, "列出所有可用的网络接口")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "XTrace-Catch: XDP 网络流量监控器\n\n")
-		fmt.Fprintf(os.Stderr, "用法: %s [选项]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "用法: %s [选项]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "      %s replay --pcap FILE [选项]   # 离线回放抓包文件，详见 replay -h\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "      %s selftest [选项]             # 在临时 veth 对上自检，详见 selftest -h\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "选项:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\n流量过滤:\n")
@@ -96,18 +156,54 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  ib         - 仅 InfiniBand 流量\n")
 		fmt.Fprintf(os.Stderr, "  all        - 所有流量 (默认)\n")
 		fmt.Fprintf(os.Stderr, "\n其他选项:\n")
+		fmt.Fprintf(os.Stderr, "  -c, --config      配置文件（YAML/TOML），命令行参数 > 环境变量 > 配置文件；kill -HUP 重新加载\n")
+		fmt.Fprintf(os.Stderr, "  --on-attach-error 接口加载或挂载 XDP 失败时的处理 (默认: skip)\n")
+		fmt.Fprintf(os.Stderr, "                    fail: 停止所有监控并以非 0 退出码退出；skip: 跳过该接口，直到接口被删除后重新出现；\n")
+		fmt.Fprintf(os.Stderr, "                    retry: 按 1s 到 60s 的退避持续重试\n")
 		fmt.Fprintf(os.Stderr, "  --exclude-dns     排除DNS流量（过滤223.5.5.5等常见DNS服务器）\n")
 		fmt.Fprintf(os.Stderr, "  -t, --interval    数据采集和推送间隔（毫秒），默认5000ms，范围100-3600000\n")
+		fmt.Fprintf(os.Stderr, "  -o, --output      标准输出格式: text (默认)、json (每行一个 JSON 对象)、csv\n")
+		fmt.Fprintf(os.Stderr, "  --top-flows N     每个接口只导出本周期字节数最多的 N 个流，其余流量按流量类型汇总为 other 序列\n")
+		fmt.Fprintf(os.Stderr, "  --aggregate SPEC  额外的聚合层级 [name=]dim,dim,...，可重复指定，每个层级导出为独立的指标族\n")
+		fmt.Fprintf(os.Stderr, "                    维度: src_ip, dst_ip, src_subnet/N, dst_subnet/N, src_port, dst_port, protocol, traffic_type\n")
+		fmt.Fprintf(os.Stderr, "  --flow-metrics    是否导出五元组级别的流指标 (默认 true，--flow-metrics=false 只保留 NIC 和聚合层级)\n")
+		fmt.Fprintf(os.Stderr, "  --conversations M 合并两个方向的流为会话: ip（按 IP 对和协议，适合 RoCE v2）或 port（按五元组）\n")
+		fmt.Fprintf(os.Stderr, "                    标准输出改为每个会话一条记录（a->b / b->a 字节数和不对称比例），并导出 xtrace_conversation_* 指标\n")
+		fmt.Fprintf(os.Stderr, "  --flow-events T   输出流开始 / 结束事件（首次 / 最后出现时间、累计字节数和包数、持续时间、峰值速率）\n")
+		fmt.Fprintf(os.Stderr, "                    T 为 stdout（每行一个 JSON）、文件路径（追加写入）或 http(s):// webhook（每个周期 POST 一个 JSON 数组）\n")
+		fmt.Fprintf(os.Stderr, "  --flow-idle-timeout MS  流超过该时间没有新数据包时输出结束事件 (默认: %d，不能小于采集间隔)\n", defaultFlowIdleTimeoutMs)
+		fmt.Fprintf(os.Stderr, "  --elephant-rate MBPS   大象流速率阈值（Mbit/s）；--elephant-share PCT 大象流占接口带宽的百分比阈值\n")
+		fmt.Fprintf(os.Stderr, "                    任一条件连续 --elephant-ticks 个周期 (默认: %d) 满足时判定为大象流，\n", defaultElephantTicks)
+		fmt.Fprintf(os.Stderr, "                    写入日志和流事件，并导出 xtrace_elephant_flow（仅 VictoriaMetrics，OTLP / InfluxDB 不导出）；\n")
+		fmt.Fprintf(os.Stderr, "                    --link-speed 覆盖 sysfs 中的接口带宽\n")
+		fmt.Fprintf(os.Stderr, "  --burst-slot US   在 XDP 程序中按 US 微秒的时间片统计接口字节数 (%d-%d，默认 0 关闭)，\n", minBurstSlotUs, maxBurstSlotUs)
+		fmt.Fprintf(os.Stderr, "                    导出每个周期的峰值速率 xtrace_interface_peak_rate_bytes 和时间片速率直方图\n")
+		fmt.Fprintf(os.Stderr, "  --pin             将 XDP link 和 flows map 固定到 %s/<iface>，重启后沿用已有计数\n", defaultPinPath)
+		fmt.Fprintf(os.Stderr, "  --pin-path DIR    固定目录 (默认: %s)\n", defaultPinPath)
+		fmt.Fprintf(os.Stderr, "  --tui             交互式终端界面：实时排序的流量表、协议过滤、接口汇总和趋势图\n")
+		fmt.Fprintf(os.Stderr, "  --health-listen   健康检查 HTTP 监听地址 (默认: %s)，提供 /healthz、/readyz 和 /metrics，为空时关闭\n", defaultHealthListen)
+		fmt.Fprintf(os.Stderr, "  --pprof           在健康检查服务上启用 /debug/pprof\n")
+		fmt.Fprintf(os.Stderr, "  -v, --version     显示版本号\n")
 		fmt.Fprintf(os.Stderr, "\n注意: 流量统计默认包含完整包长（含L2层开销），与node_exporter统计方式一致\n")
 		fmt.Fprintf(os.Stderr, "\n示例:\n")
 		fmt.Fprintf(os.Stderr, "  %s -i eth0                        # 监控 eth0 接口\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i eth0,eth1                  # 同时监控 eth0 和 eth1 接口\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i 'ib*,ens*f*np*'             # 按通配符匹配接口，接口出现/删除时自动挂载/卸载\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i ib0 -f roce                 # 仅显示 RoCE 流量\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i ib0 -f roce_v2              # 仅显示 RoCE v2 流量\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i eth0 --exclude-dns          # 排除DNS流量\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i eth0 -t 500                 # 每500ms采集一次（高频）\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -i eth0 -t 10000               # 每10秒采集一次数据\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i eth0 --output=json | jq .   # 以 JSON 格式输出，便于管道处理\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i ib0 --aggregate src_subnet/24,dst_subnet/24 --flow-metrics=false  # 只导出子网级别汇总\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i ib0 --conversations ip      # 按 IP 对合并双向流量，查看 RDMA 会话的不对称\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i 'ens*f*np*' --elephant-share 40  # 连续 3 个周期占接口带宽 40%% 以上的流判定为大象流\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i ib0 --burst-slot 1000       # 按 1ms 时间片统计微突发\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -i ib0,ib1 --tui               # 交互式终端界面\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -c /etc/xtrace-catch/config.yaml  # 从配置文件读取接口、过滤、导出器等设置\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --list                         # 列出所有网络接口\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s replay --pcap job.pcapng       # 离线回放抓包文件\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s selftest                       # 验证 XDP 程序在本机内核上的统计是否准确\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\n环境变量:\n")
 		fmt.Fprintf(os.Stderr, "  NETWORK_INTERFACE             设置默认网络接口\n")
 		fmt.Fprintf(os.Stderr, "  VICTORIAMETRICS_ENABLED       启用 VictoriaMetrics 推送 (true/1 启用)\n")
@@ -115,7 +211,34 @@ func main() {
 		fmt.Fprintf(os.Stderr, "                                支持: /api/v1/import/prometheus (Text Format)\n")
 		fmt.Fprintf(os.Stderr, "                                      /api/v1/write (Remote Write Protocol)\n")
 		fmt.Fprintf(os.Stderr, "                                (默认: http://localhost:8428/api/v1/import/prometheus)\n")
+		fmt.Fprintf(os.Stderr, "  OTLP_ENABLED                  启用 OpenTelemetry OTLP 推送 (true/1 启用)\n")
+		fmt.Fprintf(os.Stderr, "  OTLP_PROTOCOL                 OTLP 传输协议: http (默认) 或 grpc\n")
+		fmt.Fprintf(os.Stderr, "  OTLP_ENDPOINT                 OTLP 接收端地址\n")
+		fmt.Fprintf(os.Stderr, "                                (默认: http://localhost:4318/v1/metrics 或 localhost:4317)\n")
+		fmt.Fprintf(os.Stderr, "  INFLUXDB_ENABLED              启用 InfluxDB line protocol 输出 (true/1 启用)\n")
+		fmt.Fprintf(os.Stderr, "  INFLUXDB_URL                  InfluxDB/Telegraf 地址\n")
+		fmt.Fprintf(os.Stderr, "                                支持: http(s)://host:8086/api/v2/write\n")
+		fmt.Fprintf(os.Stderr, "                                      udp://host:8094, unix:///path, unixgram:///path\n")
+		fmt.Fprintf(os.Stderr, "                                (默认: http://localhost:8086/api/v2/write)\n")
+		fmt.Fprintf(os.Stderr, "  INFLUXDB_TOKEN                InfluxDB API Token (HTTP)\n")
+		fmt.Fprintf(os.Stderr, "  INFLUXDB_ORG                  InfluxDB 组织 (HTTP)\n")
+		fmt.Fprintf(os.Stderr, "  INFLUXDB_BUCKET               InfluxDB Bucket (HTTP 必填)\n")
+		fmt.Fprintf(os.Stderr, "  IPFIX_ENABLED                 启用 IPFIX / NetFlow v9 导出 (true/1 启用)\n")
+		fmt.Fprintf(os.Stderr, "  IPFIX_COLLECTOR               流采集器地址 host:port (默认: localhost:4739)\n")
+		fmt.Fprintf(os.Stderr, "  IPFIX_VERSION                 导出协议: ipfix (默认) 或 netflow9\n")
+		fmt.Fprintf(os.Stderr, "  IPFIX_OBSERVATION_DOMAIN      Observation Domain ID / Source ID (默认: 1)\n")
+		fmt.Fprintf(os.Stderr, "  IPFIX_ENTERPRISE_ID           企业私有 IE 使用的 PEN (默认: 32473)\n")
+		fmt.Fprintf(os.Stderr, "  ON_ATTACH_ERROR               接口挂载失败时的处理: fail, skip (默认), retry\n")
 		fmt.Fprintf(os.Stderr, "  COLLECT_AGG                   算网标签，用于标识数据来源 (默认: default)\n")
+		fmt.Fprintf(os.Stderr, "  HEALTH_LISTEN                 健康检查 HTTP 监听地址 (默认: %s，为空时关闭)\n", defaultHealthListen)
+		fmt.Fprintf(os.Stderr, "  PPROF_ENABLED                 启用 /debug/pprof (true/1 启用)\n")
+		fmt.Fprintf(os.Stderr, "  FLOW_EVENTS                   流生命周期事件输出: stdout、文件路径或 http(s):// webhook\n")
+		fmt.Fprintf(os.Stderr, "  FLOW_IDLE_TIMEOUT_MS          流的空闲超时（毫秒，默认: %d）\n", defaultFlowIdleTimeoutMs)
+		fmt.Fprintf(os.Stderr, "  ELEPHANT_RATE_MBPS            大象流速率阈值（Mbit/s）\n")
+		fmt.Fprintf(os.Stderr, "  ELEPHANT_LINK_SHARE           大象流占接口带宽的百分比阈值\n")
+		fmt.Fprintf(os.Stderr, "  ELEPHANT_TICKS                连续超过阈值的采集周期数 (默认: %d)\n", defaultElephantTicks)
+		fmt.Fprintf(os.Stderr, "  LINK_SPEED_MBPS               接口带宽（Mbit/s），默认从 sysfs 读取\n")
+		fmt.Fprintf(os.Stderr, "  BURST_SLOT_US                 微突发统计的时间片长度（微秒，默认 0 关闭）\n")
 	}
 
 	flag.Parse()
@@ -126,72 +249,132 @@ func main() {
 		return
 	}
 
+	// 显示版本号
+	if showVersion {
+		fmt.Printf("xtrace-catch %s (%s)\n", version, runtime.Version())
+		return
+	}
+
 	// 列出网络接口
 	if listInterfaces {
 		listNetworkInterfaces()
 		return
 	}
 
-	// 确定网络接口：命令行参数 > 环境变量 > 默认值
-	if iface == "" {
-		iface = os.Getenv("NETWORK_INTERFACE")
+	// 命令行显式指定的参数覆盖配置文件和环境变量（SIGHUP 重新加载时同样生效）
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	isSet := func(names ...string) bool {
+		for _, name := range names {
+			if setFlags[name] {
+				return true
+			}
+		}
+		return false
 	}
-	if iface == "" {
-		iface = "eth0" // 默认接口
+	applyFlagOverrides = func(cfg *Config) {
+		if isSet("i", "interface") {
+			cfg.Interfaces = parseInterfaceList(iface)
+		}
+		if isSet("on-attach-error") {
+			cfg.OnAttachError = onAttachErr
+		}
+		if isSet("f", "filter") {
+			cfg.Filter = filterTraffic
+		}
+		if isSet("exclude-dns") {
+			cfg.ExcludeDNS = excludeDNS
+		}
+		if isSet("t", "interval") {
+			cfg.IntervalMs = intervalMs
+		}
+		if isSet("o", "output") {
+			cfg.Output = output
+		}
+		if isSet("tui") {
+			cfg.TUI = tui
+		}
+		if isSet("top-flows") {
+			cfg.TopFlows = topFlowsN
+		}
+		if isSet("flow-metrics") {
+			cfg.FlowMetrics = flowMetrics
+		}
+		if isSet("aggregate") {
+			cfg.Aggregate = aggregates
+		}
+		if isSet("conversations") {
+			cfg.Conversations = conversations
+		}
+		if isSet("flow-events") {
+			cfg.FlowEvents.Target = flowEventsOut
+		}
+		if isSet("flow-idle-timeout") {
+			cfg.FlowEvents.IdleTimeoutMs = flowIdleTimeoutMs
+		}
+		if isSet("elephant-rate") {
+			cfg.Elephant.RateMbps = elephantRateMbps
+		}
+		if isSet("elephant-share") {
+			cfg.Elephant.LinkSharePercent = elephantShare
+		}
+		if isSet("elephant-ticks") {
+			cfg.Elephant.Ticks = elephantTicks
+		}
+		if isSet("link-speed") {
+			cfg.Elephant.LinkSpeedMbps = linkSpeedMbps
+		}
+		if isSet("burst-slot") {
+			cfg.BurstSlotUs = burstSlotUs
+		}
+		if isSet("pin") {
+			cfg.Pin = pin
+		}
+		if isSet("pin-path") {
+			cfg.PinPath = pinDir
+		}
+		if isSet("health-listen") {
+			cfg.Health.Listen = healthListen
+		}
+		if isSet("pprof") {
+			cfg.Health.Pprof = pprofEnabled
+		}
 	}
 
-	// 解析多个接口（逗号分隔）
-	interfaceList := parseInterfaceList(iface)
-	if len(interfaceList) == 0 {
-		log.Fatalf("未指定有效的网络接口")
+	// 组装配置：命令行参数 > 环境变量 > 配置文件 > 默认值
+	cfg, err := buildConfig()
+	if err != nil {
+		log.Fatalf("配置无效: %v", err)
+	}
+	if configPath != "" {
+		log.Printf("已加载配置文件: %s", configPath)
 	}
 
-	// 验证所有网络接口是否存在
-	var invalidInterfaces []string
-	for _, ifaceName := range interfaceList {
-		if !isValidInterface(ifaceName) {
-			invalidInterfaces = append(invalidInterfaces, ifaceName)
+	// 检查指定的接口名（不含通配符）当前是否存在；不存在的接口会在出现后自动挂载
+	var missingInterfaces []string
+	for _, ifaceName := range cfg.Interfaces {
+		if !isInterfacePattern(ifaceName) && !isValidInterface(ifaceName) {
+			missingInterfaces = append(missingInterfaces, ifaceName)
 		}
 	}
-	if len(invalidInterfaces) > 0 {
-		log.Printf("警告: 以下网络接口可能不存在: %v", invalidInterfaces)
+	if len(missingInterfaces) > 0 && cfg.OnAttachError == attachErrorFail {
+		log.Fatalf("以下网络接口不存在 (--on-attach-error=fail): %v", missingInterfaces)
+	}
+	if len(missingInterfaces) > 0 {
+		log.Printf("警告: 以下网络接口当前不存在，将在出现后自动挂载: %v", missingInterfaces)
 		log.Printf("可用接口列表:")
 		listNetworkInterfaces()
-		log.Fatalf("请使用 -i 参数指定正确的网络接口")
 	}
 
-	// 检查是否启用 VictoriaMetrics
-	metricsEnabled = false
-	if enabled := os.Getenv("VICTORIAMETRICS_ENABLED"); enabled == "true" || enabled == "1" {
-		metricsEnabled = true
-
-		// 获取 VictoriaMetrics Remote Write URL
-		remoteWriteURL := os.Getenv("VICTORIAMETRICS_REMOTE_WRITE")
-		if remoteWriteURL == "" {
-			remoteWriteURL = "http://localhost:8428/api/v1/import/prometheus" // 默认 VictoriaMetrics URL
-		}
-
-		// 获取算网标签
-		collectAgg = os.Getenv("COLLECT_AGG")
-		if collectAgg == "" {
-			collectAgg = "default" // 默认值
-		}
-		log.Printf("算网标签 (collect_agg): %s", collectAgg)
+	// 设置运行时参数、聚合层级并初始化各导出器
+	applyStartupConfig(cfg)
 
-		// 初始化 VictoriaMetrics metrics
-		initVictoriaMetrics(remoteWriteURL)
-	}
-
-	// 验证间隔参数
-	if intervalMs < 100 {
-		log.Fatal("间隔时间必须大于等于100毫秒")
-	}
-	if intervalMs > 3600000 {
-		log.Fatal("间隔时间不能超过3600000毫秒（1小时）")
+	if pushEnabled() {
+		log.Printf("算网标签 (collect_agg): %s", currentCollectAgg())
 	}
 
 	// 启动 XDP 监控（支持多接口，包括单接口）
-	startMultiInterfaceMonitor(interfaceList, filterTraffic, excludeDNS, intervalMs)
+	startMultiInterfaceMonitor(cfg.Interfaces)
 }
 
 // 解析接口列表（逗号分隔）
@@ -67,7 +67,7 @@ func (r NICRates) UpdateMetrics(iface, hostIP string) {
 			"protocol":     strconv.Itoa(int(nicKey.Proto)),
 			"traffic_type": rate.trafficType,
 			"host_ip":      hostIP,
-			"collect_agg":  collectAgg,
+			"collect_agg":  currentCollectAgg(),
 		}
 		networkNICBytesRate.With(labels).Set(rate.bytesPerSec)
 		networkNICBitsRate.With(labels).Set(rate.bitsPerSec)
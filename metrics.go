@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -25,13 +28,108 @@ var (
 	metricsEnabled       bool
 	vmRemoteWriteURL     string
 	vmRegistry           *prometheus.Registry
-	networkFlowBytesRate *prometheus.GaugeVec // bytes/s 速率
-	networkFlowBitsRate  *prometheus.GaugeVec // bits/s 速率（Mbps）
-	networkNICBytesRate  *prometheus.GaugeVec // NIC网卡的速率 bytes/s
-	networkNICBitsRate   *prometheus.GaugeVec // NIC网卡的速率 bits/s
-	collectAgg           string               // 算网标签
+	agentRegistry        *prometheus.Registry   // 程序自身运行状态（启用任一导出器或健康检查服务时创建，不随推送重置）
+	networkFlowBytesRate *prometheus.GaugeVec   // bytes/s 速率
+	networkFlowBitsRate  *prometheus.GaugeVec   // bits/s 速率（Mbps）
+	networkNICBytesRate  *prometheus.GaugeVec   // NIC网卡的速率 bytes/s
+	networkNICBitsRate   *prometheus.GaugeVec   // NIC网卡的速率 bits/s
+	flowCounterResets    *prometheus.CounterVec // 检测到的流计数器重置次数（不随推送重置）
+	vmSampleTimestamps   bool                   // 样本携带采集周期时刻（回放模式），否则使用推送时间
 )
 
+// 算网标签（可热加载），通过 currentCollectAgg 读取
+// 更新不随推送重置的序列时持有 collectAggMu 读锁，热加载修改标签时旧标签的序列不会在清理后重新出现
+var (
+	collectAggMu sync.RWMutex
+	collectAgg   string
+)
+
+func currentCollectAgg() string {
+	collectAggMu.RLock()
+	defer collectAggMu.RUnlock()
+	return collectAgg
+}
+
+// 设置算网标签：不随推送重置的 gauge 序列改为新标签（值不变），旧标签的 counter 序列删除后从 0 重新计数
+func setCollectAgg(agg string) {
+	collectAggMu.Lock()
+	defer collectAggMu.Unlock()
+	old := collectAgg
+	collectAgg = agg
+	if old == "" || old == agg {
+		return
+	}
+
+	for _, g := range []*prometheus.GaugeVec{interfaceAttached, agentBuildInfo, agentMapEntries,
+		agentMapCapacity, agentIterationSeconds, agentFlowsProcessed, agentPushDuration} {
+		if g != nil {
+			relabelGauge(g, old, agg)
+		}
+	}
+	for _, c := range []*prometheus.CounterVec{interfaceReattachTotal, flowCounterResets, agentUnparsedPackets,
+		agentUnparsedBytes, agentCollectSignalsDropped, agentPushTotal, agentPushPayloadBytes} {
+		if c != nil {
+			c.DeletePartialMatch(prometheus.Labels{"collect_agg": old})
+		}
+	}
+}
+
+// 把 gauge 中 collect_agg=old 的序列改为 collect_agg=agg
+func relabelGauge(vec *prometheus.GaugeVec, old, agg string) {
+	type series struct {
+		labels prometheus.Labels
+		value  float64
+	}
+	var moved []series
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+		labels := make(prometheus.Labels, len(pb.Label))
+		for _, l := range pb.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["collect_agg"] == old {
+			moved = append(moved, series{labels, pb.GetGauge().GetValue()})
+		}
+	}
+
+	// Collect 结束后才能修改
+	for _, s := range moved {
+		vec.Delete(s.labels)
+		s.labels["collect_agg"] = agg
+		vec.With(s.labels).Set(s.value)
+	}
+}
+
+// 初始化程序自身运行状态 metrics：接口挂载状态、流计数器重置和 xtrace_agent_*
+// 与流量 metrics 分开注册，只启用 OTLP、InfluxDB 或 IPFIX 时也可以通过健康检查服务的 /metrics 获取
+func initAgentMetrics() {
+	agentRegistry = prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels(staticLabels), agentRegistry)
+
+	// 注册接口挂载状态指标
+	registerAttachMetrics(registerer)
+
+	flowCounterResets = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "xtrace_flow_counter_resets_total",
+			Help: "Number of flow counter resets detected (kernel entry recreated or counter went backwards)",
+		},
+		[]string{"interface", "host_ip", "collect_agg"},
+	)
+	registerer.MustRegister(flowCounterResets)
+
+	// 注册程序自身运行状态指标（xtrace_agent_*）
+	registerAgentMetrics(registerer)
+}
+
 // 初始化 VictoriaMetrics metrics
 func initVictoriaMetrics(remoteWriteURL string) {
 	// 创建独立的 registry
@@ -69,11 +167,28 @@ func initVictoriaMetrics(remoteWriteURL string) {
 		[]string{"interface", "src_ip", "dst_ip", "protocol", "traffic_type", "host_ip", "collect_agg"},
 	)
 
-	// 注册 metrics 到独立的 registry
-	vmRegistry.MustRegister(networkFlowBytesRate)
-	vmRegistry.MustRegister(networkFlowBitsRate)
-	vmRegistry.MustRegister(networkNICBytesRate)
-	vmRegistry.MustRegister(networkNICBitsRate)
+	// 注册 metrics 到独立的 registry（配置文件中的静态标签作为常量标签附加到所有指标上）
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels(staticLabels), vmRegistry)
+	registerer.MustRegister(networkFlowBytesRate)
+	registerer.MustRegister(networkFlowBitsRate)
+	registerer.MustRegister(networkNICBytesRate)
+	registerer.MustRegister(networkNICBitsRate)
+
+	// 注册自定义聚合层级的指标族（--aggregate）
+	registerAggregationMetrics(registerer)
+
+	// 注册双向会话指标（--conversations）
+	if conversationMode != "" {
+		registerConversationMetrics(registerer)
+	}
+
+	// 注册大象流指标（阈值可热加载，始终注册）
+	registerElephantMetrics(registerer)
+
+	// 注册微突发指标（--burst-slot）
+	if burstSlot > 0 {
+		registerBurstMetrics(registerer)
+	}
 
 	vmRemoteWriteURL = remoteWriteURL
 
@@ -85,13 +200,25 @@ func initVictoriaMetrics(remoteWriteURL string) {
 	log.Printf("VictoriaMetrics Remote Write 配置: %s [%s]", remoteWriteURL, format)
 }
 
-// 推送 metrics 到 VictoriaMetrics
-func pushMetricsToVictoriaMetrics() error {
-	// 收集所有 metrics
-	metricsFamilies, err := vmRegistry.Gather()
+// 推送 metrics 到 VictoriaMetrics（ts 不为零时作为所有样本的时间戳）
+func pushMetricsToVictoriaMetrics(ts time.Time) error {
+	// 收集所有 metrics（流量 metrics 和程序自身运行状态）
+	gatherers := prometheus.Gatherers{vmRegistry}
+	if agentRegistry != nil {
+		gatherers = append(gatherers, agentRegistry)
+	}
+	metricsFamilies, err := gatherers.Gather()
 	if err != nil {
 		return fmt.Errorf("收集 metrics 失败: %w", err)
 	}
+	if !ts.IsZero() {
+		ms := ts.UnixMilli()
+		for _, mf := range metricsFamilies {
+			for _, m := range mf.Metric {
+				m.TimestampMs = &ms
+			}
+		}
+	}
 
 	// 根据 URL 判断使用哪种格式
 	useRemoteWrite := strings.Contains(vmRemoteWriteURL, "/api/v1/write")
@@ -108,6 +235,7 @@ func pushMetricsToVictoriaMetrics() error {
 	if err != nil {
 		return err
 	}
+	addPushPayload(exporterVictoriaMetrics, int(req.ContentLength))
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
@@ -150,47 +278,7 @@ func createRemoteWriteRequest(metricsFamilies []*dto.MetricFamily) (*http.Reques
 
 	for _, mf := range metricsFamilies {
 		for _, m := range mf.Metric {
-			ts := &prompb.TimeSeries{}
-
-			// 添加 metric name label
-			ts.Labels = append(ts.Labels, prompb.Label{
-				Name:  "__name__",
-				Value: *mf.Name,
-			})
-
-			// 添加其他 labels
-			for _, label := range m.Label {
-				ts.Labels = append(ts.Labels, prompb.Label{
-					Name:  *label.Name,
-					Value: *label.Value,
-				})
-			}
-
-			// 添加样本值
-			now := time.Now().UnixMilli()
-			var value float64
-
-			switch mf.GetType() {
-			case dto.MetricType_COUNTER:
-				if m.Counter != nil {
-					value = *m.Counter.Value
-				}
-			case dto.MetricType_GAUGE:
-				if m.Gauge != nil {
-					value = *m.Gauge.Value
-				}
-			case dto.MetricType_UNTYPED:
-				if m.Untyped != nil {
-					value = *m.Untyped.Value
-				}
-			}
-
-			ts.Samples = []prompb.Sample{{
-				Value:     value,
-				Timestamp: now,
-			}}
-
-			writeRequest.Timeseries = append(writeRequest.Timeseries, *ts)
+			writeRequest.Timeseries = append(writeRequest.Timeseries, remoteWriteSeries(mf, m)...)
 		}
 	}
 
@@ -214,3 +302,50 @@ func createRemoteWriteRequest(metricsFamilies []*dto.MetricFamily) (*http.Reques
 
 	return req, nil
 }
+
+// 把一个样本转换为 Remote Write 时间序列
+// Histogram 展开为 _bucket{le=...}（含 +Inf）、_sum 和 _count，与 Text Format 的序列一致
+func remoteWriteSeries(mf *dto.MetricFamily, m *dto.Metric) []prompb.TimeSeries {
+	timestamp := time.Now().UnixMilli()
+	if m.TimestampMs != nil {
+		timestamp = *m.TimestampMs
+	}
+	series := func(name string, value float64, extra ...prompb.Label) prompb.TimeSeries {
+		// metric name label 和其他 labels
+		labels := []prompb.Label{{Name: "__name__", Value: name}}
+		for _, label := range m.Label {
+			labels = append(labels, prompb.Label{Name: label.GetName(), Value: label.GetValue()})
+		}
+		return prompb.TimeSeries{
+			Labels:  append(labels, extra...),
+			Samples: []prompb.Sample{{Value: value, Timestamp: timestamp}},
+		}
+	}
+
+	name := mf.GetName()
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		return []prompb.TimeSeries{series(name, m.GetCounter().GetValue())}
+	case dto.MetricType_GAUGE:
+		return []prompb.TimeSeries{series(name, m.GetGauge().GetValue())}
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		var out []prompb.TimeSeries
+		hasInf := false
+		for _, b := range h.GetBucket() {
+			le := b.GetUpperBound()
+			hasInf = hasInf || math.IsInf(le, 1)
+			out = append(out, series(name+"_bucket", float64(b.GetCumulativeCount()),
+				prompb.Label{Name: "le", Value: strconv.FormatFloat(le, 'g', -1, 64)}))
+		}
+		if !hasInf {
+			out = append(out, series(name+"_bucket", float64(h.GetSampleCount()),
+				prompb.Label{Name: "le", Value: "+Inf"}))
+		}
+		return append(out,
+			series(name+"_sum", h.GetSampleSum()),
+			series(name+"_count", float64(h.GetSampleCount())))
+	default:
+		return []prompb.TimeSeries{series(name, m.GetUntyped().GetValue())}
+	}
+}
@@ -0,0 +1,277 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// 编码为 Remote Write 请求后再解码
+func roundTripRemoteWrite(t *testing.T, families []*dto.MetricFamily) []prompb.TimeSeries {
+	t.Helper()
+	req, err := createRemoteWriteRequest(families)
+	if err != nil {
+		t.Fatalf("createRemoteWriteRequest: %v", err)
+	}
+	if req.Header.Get("Content-Encoding") != "snappy" {
+		t.Errorf("Content-Encoding = %q", req.Header.Get("Content-Encoding"))
+	}
+	body, _ := io.ReadAll(req.Body)
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("snappy: %v", err)
+	}
+	var wr prompb.WriteRequest
+	if err := proto.Unmarshal(data, &wr); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return wr.Timeseries
+}
+
+func TestRemoteWriteHistogram(t *testing.T) {
+	vmRemoteWriteURL = "http://127.0.0.1/api/v1/write"
+	t.Cleanup(func() { vmRemoteWriteURL = "" })
+
+	registry := prometheus.NewRegistry()
+	registerBurstMetrics(registry)
+	t.Cleanup(func() {
+		interfacePeakRate = nil
+		burstHistograms = nil
+	})
+	s := burstSample{Slot: time.Millisecond, PeakBytes: 5000, SumBytes: 7000}
+	s.Buckets[0], s.Buckets[3], s.Buckets[burstBuckets-1] = 2, 1, 4
+	s.UpdateMetrics("ib0", "192.0.2.1")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	// 与回放推送相同：所有样本使用周期时刻
+	ms := int64(1700000000000)
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			m.TimestampMs = &ms
+		}
+	}
+
+	// 按 __name__ 和 le 索引样本值
+	got := make(map[string]float64)
+	for _, ts := range roundTripRemoteWrite(t, families) {
+		var name, le, iface string
+		for _, l := range ts.Labels {
+			switch l.Name {
+			case "__name__":
+				name = l.Value
+			case "le":
+				le = l.Value
+			case "interface":
+				iface = l.Value
+			}
+		}
+		key := name
+		if le != "" {
+			key += "{le=" + le + "}"
+		}
+		if iface != "ib0" {
+			t.Errorf("%s: interface = %q", key, iface)
+		}
+		if len(ts.Samples) != 1 || ts.Samples[0].Timestamp != ms {
+			t.Errorf("%s: samples = %+v", key, ts.Samples)
+			continue
+		}
+		if _, dup := got[key]; dup {
+			t.Errorf("duplicate series %s", key)
+		}
+		got[key] = ts.Samples[0].Value
+	}
+
+	want := map[string]float64{
+		"xtrace_interface_peak_rate_bytes":                      5e6,
+		"xtrace_interface_slot_rate_bytes_bucket{le=1.024e+06}": 2,
+		"xtrace_interface_slot_rate_bytes_bucket{le=8.192e+06}": 3,
+		"xtrace_interface_slot_rate_bytes_bucket{le=+Inf}":      7,
+		"xtrace_interface_slot_rate_bytes_sum":                  7e6,
+		"xtrace_interface_slot_rate_bytes_count":                7,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["xtrace_interface_slot_rate_bytes"]; ok {
+		t.Errorf("histogram exported as a single series under its base name")
+	}
+	// 峰值 Gauge + 15 个有限上界 + +Inf + _sum + _count
+	if len(got) != 1+burstBuckets+2 {
+		t.Errorf("got %d series, want %d: %v", len(got), 1+burstBuckets+2, got)
+	}
+}
+
+func TestSetCollectAggRelabelsPersistentSeries(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registerAttachMetrics(registry)
+	registerAgentMetrics(registry)
+	resetAgentMetrics(t)
+	setCollectAgg("old-agg")
+
+	a := &xdpAttachment{iface: "ib0", hostIP: "192.0.2.1"}
+	a.setAttached(true)
+	t.Cleanup(func() { forgetInterfaceHealth("ib0") })
+	setAgentBuildInfo()
+	observeCollect("ib0", 10, 100, 5, time.Millisecond, 3, 300)
+
+	setCollectAgg("new-agg")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	values := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "collect_agg" && l.GetValue() != "new-agg" {
+					t.Errorf("%s still has collect_agg=%q", mf.GetName(), l.GetValue())
+				}
+			}
+			values[mf.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+
+	// gauge 改为新标签且值不变，counter 删除后从 0 重新计数
+	for name, want := range map[string]float64{
+		"xtrace_interface_attached": 1,
+		"xtrace_agent_build_info":   1,
+		"xtrace_agent_map_entries":  10,
+		"xtrace_agent_map_capacity": 100,
+	} {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", name, got, ok, want)
+		}
+	}
+	if _, ok := values["xtrace_agent_unparsed_packets_total"]; ok {
+		t.Errorf("old-label counter was not deleted")
+	}
+	if currentCollectAgg() != "new-agg" {
+		t.Errorf("currentCollectAgg() = %q", currentCollectAgg())
+	}
+}
+
+// 测试结束后清除程序自身运行状态 metrics
+func resetAgentMetrics(t *testing.T) {
+	t.Helper()
+	oldAgg := currentCollectAgg()
+	t.Cleanup(func() {
+		agentRegistry, flowCounterResets = nil, nil
+		interfaceAttached, interfaceReattachTotal = nil, nil
+		agentBuildInfo, agentMapEntries, agentMapCapacity, agentIterationSeconds = nil, nil, nil, nil
+		agentFlowsProcessed, agentUnparsedPackets, agentUnparsedBytes = nil, nil, nil
+		agentCollectSignalsDropped, agentPushDuration, agentPushTotal, agentPushPayloadBytes = nil, nil, nil, nil
+		setCollectAgg(oldAgg)
+	})
+}
+
+// 请求健康检查服务的 /metrics
+func scrapeHealthMetrics(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(newHealthMux(false))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics status %d: %s", resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestAgentMetricsWithoutVictoriaMetrics(t *testing.T) {
+	resetAgentMetrics(t)
+	setCollectAgg("")
+	initAgentMetrics()
+
+	a := &xdpAttachment{iface: "ib0", hostIP: "192.0.2.1"}
+	a.setAttached(true)
+	t.Cleanup(func() { forgetInterfaceHealth("ib0") })
+	setAgentBuildInfo()
+	observePush(exporterInfluxDB, func() error { return nil })
+
+	body := scrapeHealthMetrics(t)
+	for _, want := range []string{
+		`xtrace_interface_attached{collect_agg="",host_ip="192.0.2.1",interface="ib0"} 1`,
+		`xtrace_agent_build_info{`,
+		`xtrace_agent_push_total{collect_agg="",exporter="influxdb",host_ip="",result="success"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+// 只设置 --health-listen（未启用任何导出器）时也注册程序自身运行状态 metrics
+func TestHealthOnlyRegistersAgentMetrics(t *testing.T) {
+	restoreConfigState(t)
+	resetAgentMetrics(t)
+	oldTUI, oldOnAttach, oldPin, oldPinPath := tuiEnabled, onAttachError, pinEnabled, pinPath
+	oldAggLevels, oldConversations, oldBurstSlot := aggLevels, conversationMode, burstSlot
+	oldStatic, oldMetrics := staticLabels, metricsEnabled
+	healthMu.Lock()
+	oldHealthInterfaces := healthInterfaces
+	healthMu.Unlock()
+	t.Cleanup(func() {
+		tuiEnabled, onAttachError, pinEnabled, pinPath = oldTUI, oldOnAttach, oldPin, oldPinPath
+		aggLevels, conversationMode, burstSlot = oldAggLevels, oldConversations, oldBurstSlot
+		staticLabels, metricsEnabled = oldStatic, oldMetrics
+		healthMu.Lock()
+		healthInterfaces = oldHealthInterfaces
+		healthMu.Unlock()
+	})
+
+	cfg := defaultConfig()
+	cfg.Interfaces = []string{"ib0"}
+	cfg.Health.Listen = "127.0.0.1:0"
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	applyStartupConfig(cfg)
+
+	if pushEnabled() {
+		t.Fatalf("default config enabled an exporter")
+	}
+	if agentRegistry == nil {
+		t.Fatalf("agent metrics not registered with only --health-listen set")
+	}
+
+	a := &xdpAttachment{iface: "ib0", hostIP: "192.0.2.1"}
+	a.setAttached(true)
+	t.Cleanup(func() { forgetInterfaceHealth("ib0") })
+	setAgentBuildInfo()
+
+	body := scrapeHealthMetrics(t)
+	for _, want := range []string{
+		`xtrace_interface_attached{collect_agg="default",host_ip="192.0.2.1",interface="ib0"} 1`,
+		`xtrace_agent_build_info{`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP 传输协议
+const (
+	otlpProtocolHTTP = "http"
+	otlpProtocolGRPC = "grpc"
+)
+
+// OpenTelemetry OTLP 导出器（全局变量）
+var (
+	otlpEnabled    bool
+	otlpProtocol   string
+	otlpEndpoint   string
+	otlpGRPCConn   *grpc.ClientConn
+	otlpGRPCClient colmetricspb.MetricsServiceClient
+)
+
+// 初始化 OTLP 导出器
+// protocol 为 http（OTLP/HTTP protobuf）或 grpc（OTLP/gRPC），endpoint 为空时使用协议默认地址
+func initOTLPExporter(endpoint, protocol string) error {
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	if protocol == "" {
+		protocol = otlpProtocolHTTP
+	}
+
+	switch protocol {
+	case otlpProtocolHTTP:
+		if endpoint == "" {
+			endpoint = "http://localhost:4318/v1/metrics"
+		}
+	case otlpProtocolGRPC:
+		if endpoint == "" {
+			endpoint = "localhost:4317"
+		}
+		conn, err := newOTLPGRPCConn(endpoint)
+		if err != nil {
+			return fmt.Errorf("创建 OTLP gRPC 连接失败: %w", err)
+		}
+		otlpGRPCConn = conn
+		otlpGRPCClient = colmetricspb.NewMetricsServiceClient(conn)
+	default:
+		return fmt.Errorf("不支持的 OTLP 协议: %s（可选: http, grpc）", protocol)
+	}
+
+	otlpProtocol = protocol
+	otlpEndpoint = endpoint
+	otlpEnabled = true
+
+	log.Printf("OTLP 导出器配置: %s [%s]", endpoint, protocol)
+	return nil
+}
+
+// 创建 OTLP gRPC 连接（https:// 前缀使用 TLS，其余使用明文）
+func newOTLPGRPCConn(endpoint string) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		endpoint = strings.TrimPrefix(endpoint, "https://")
+		creds = credentials.NewTLS(&tls.Config{})
+	case strings.HasPrefix(endpoint, "http://"):
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+	}
+	return grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+}
+
+// 推送本轮样本到 OTLP 接收端
+func pushMetricsToOTLP(flows []FlowSample, nics []NICSample, aggs []AggSample, hostIP string) error {
+	if len(flows) == 0 && len(nics) == 0 && len(aggs) == 0 {
+		return nil
+	}
+
+	exportReq := buildOTLPRequest(flows, nics, aggs, hostIP)
+
+	if otlpProtocol == otlpProtocolGRPC {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		addPushPayload(exporterOTLP, proto.Size(exportReq))
+		resp, err := otlpGRPCClient.Export(ctx, exportReq)
+		if err != nil {
+			return fmt.Errorf("OTLP gRPC 导出失败: %w", err)
+		}
+		if ps := resp.GetPartialSuccess(); ps != nil && ps.GetRejectedDataPoints() > 0 {
+			return fmt.Errorf("OTLP 接收端拒绝了 %d 个数据点: %s", ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+		}
+		return nil
+	}
+
+	data, err := proto.Marshal(exportReq)
+	if err != nil {
+		return fmt.Errorf("protobuf 编码失败: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", otlpEndpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	addPushPayload(exporterOTLP, len(data))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("OTLP 接收端返回错误状态码 %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// 将流样本、NIC 样本和聚合层级样本转换为 OTLP 请求
+// 每个接口对应一个 Resource（host_ip、collect_agg、interface），
+// 字节/包增量映射为 Delta Sum，速率映射为 Gauge
+func buildOTLPRequest(flows []FlowSample, nics []NICSample, aggs []AggSample, hostIP string) *colmetricspb.ExportMetricsServiceRequest {
+	type aggPoints struct {
+		bytesRate, bitsRate []*metricspb.NumberDataPoint
+	}
+	type ifaceMetrics struct {
+		flowBytes, flowPackets      []*metricspb.NumberDataPoint
+		flowBytesRate, flowBitsRate []*metricspb.NumberDataPoint
+		nicBytesRate, nicBitsRate   []*metricspb.NumberDataPoint
+		agg                         map[*aggLevel]*aggPoints
+	}
+	byIface := make(map[string]*ifaceMetrics)
+	get := func(iface string) *ifaceMetrics {
+		m, ok := byIface[iface]
+		if !ok {
+			m = &ifaceMetrics{agg: make(map[*aggLevel]*aggPoints)}
+			byIface[iface] = m
+		}
+		return m
+	}
+
+	for _, s := range flows {
+		m := get(s.Interface)
+		srcIP, dstIP, srcPort, dstPort := s.EndpointLabels()
+		attrs := otlpAttributes(
+			"src_ip", srcIP,
+			"dst_ip", dstIP,
+			"src_port", srcPort,
+			"dst_port", dstPort,
+			"protocol", strconv.Itoa(int(s.Key.Proto)),
+			"traffic_type", s.TrafficType,
+		)
+		end := uint64(s.Timestamp.UnixNano())
+		start := end - uint64(s.Interval*float64(time.Second))
+
+		m.flowBytes = append(m.flowBytes, otlpIntPoint(attrs, start, end, s.DeltaBytes))
+		m.flowPackets = append(m.flowPackets, otlpIntPoint(attrs, start, end, s.DeltaPackets))
+		m.flowBytesRate = append(m.flowBytesRate, otlpDoublePoint(attrs, end, s.BytesPerSec))
+		m.flowBitsRate = append(m.flowBitsRate, otlpDoublePoint(attrs, end, s.BitsPerSec))
+	}
+
+	for _, s := range nics {
+		m := get(s.Interface)
+		attrs := otlpAttributes(
+			"src_ip", ipToStr(s.Key.SrcIP),
+			"dst_ip", ipToStr(s.Key.DstIP),
+			"protocol", strconv.Itoa(int(s.Key.Proto)),
+			"traffic_type", s.Rate.trafficType,
+		)
+		ts := uint64(s.Timestamp.UnixNano())
+		m.nicBytesRate = append(m.nicBytesRate, otlpDoublePoint(attrs, ts, s.Rate.bytesPerSec))
+		m.nicBitsRate = append(m.nicBitsRate, otlpDoublePoint(attrs, ts, s.Rate.bitsPerSec))
+	}
+
+	for _, a := range aggs {
+		m := get(a.Interface)
+		p, ok := m.agg[a.Level]
+		if !ok {
+			p = &aggPoints{}
+			m.agg[a.Level] = p
+		}
+		kv := make([]string, 0, len(a.Values)*2)
+		for i, name := range a.Level.labelNames() {
+			kv = append(kv, name, a.Values[i])
+		}
+		attrs := otlpAttributes(kv...)
+		ts := uint64(a.Timestamp.UnixNano())
+		p.bytesRate = append(p.bytesRate, otlpDoublePoint(attrs, ts, a.BytesPerSec))
+		p.bitsRate = append(p.bitsRate, otlpDoublePoint(attrs, ts, a.BitsPerSec))
+	}
+
+	// 按接口名排序，保证输出稳定
+	ifaces := make([]string, 0, len(byIface))
+	for iface := range byIface {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+
+	exportReq := &colmetricspb.ExportMetricsServiceRequest{}
+	for _, iface := range ifaces {
+		m := byIface[iface]
+
+		var metrics []*metricspb.Metric
+		metrics = appendOTLPSum(metrics, "xtrace_network_flow_bytes", "Network flow bytes in the collection interval", "By", m.flowBytes)
+		metrics = appendOTLPSum(metrics, "xtrace_network_flow_packets", "Network flow packets in the collection interval", "{packet}", m.flowPackets)
+		metrics = appendOTLPGauge(metrics, "xtrace_network_flow_bytes_rate", "Network flow rate in bytes per second", "By/s", m.flowBytesRate)
+		metrics = appendOTLPGauge(metrics, "xtrace_network_flow_bits_rate", "Network flow rate in bits per second", "bit/s", m.flowBitsRate)
+		metrics = appendOTLPGauge(metrics, "xtrace_network_nic_bytes_rate", "Network traffic rate per NIC interface in bytes per second (aggregated by IP pair)", "By/s", m.nicBytesRate)
+		metrics = appendOTLPGauge(metrics, "xtrace_network_nic_bits_rate", "Network traffic rate per NIC interface in bits per second (aggregated by IP pair)", "bit/s", m.nicBitsRate)
+		for _, l := range aggLevels {
+			if p, ok := m.agg[l]; ok {
+				help := "aggregated by " + strings.Join(l.labelNames(), ", ")
+				metrics = appendOTLPGauge(metrics, "xtrace_network_agg_"+l.name+"_bytes_rate", "Network traffic rate in bytes per second "+help, "By/s", p.bytesRate)
+				metrics = appendOTLPGauge(metrics, "xtrace_network_agg_"+l.name+"_bits_rate", "Network traffic rate in bits per second "+help, "bit/s", p.bitsRate)
+			}
+		}
+
+		exportReq.ResourceMetrics = append(exportReq.ResourceMetrics, &metricspb.ResourceMetrics{
+			Resource: &resourcepb.Resource{
+				Attributes: otlpAttributes(append([]string{
+					"host_ip", hostIP,
+					"collect_agg", currentCollectAgg(),
+					"interface", iface,
+				}, sortedStaticLabels()...)...),
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: "xtrace-catch"},
+				Metrics: metrics,
+			}},
+		})
+	}
+
+	return exportReq
+}
+
+// 追加 Delta 单调 Sum 指标（无数据点时跳过）
+func appendOTLPSum(metrics []*metricspb.Metric, name, help, unit string, points []*metricspb.NumberDataPoint) []*metricspb.Metric {
+	if len(points) == 0 {
+		return metrics
+	}
+	return append(metrics, &metricspb.Metric{
+		Name:        name,
+		Description: help,
+		Unit:        unit,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             points,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+		}},
+	})
+}
+
+// 追加 Gauge 指标（无数据点时跳过）
+func appendOTLPGauge(metrics []*metricspb.Metric, name, help, unit string, points []*metricspb.NumberDataPoint) []*metricspb.Metric {
+	if len(points) == 0 {
+		return metrics
+	}
+	return append(metrics, &metricspb.Metric{
+		Name:        name,
+		Description: help,
+		Unit:        unit,
+		Data:        &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: points}},
+	})
+}
+
+func otlpIntPoint(attrs []*commonpb.KeyValue, start, end, value uint64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		Value:             &metricspb.NumberDataPoint_AsInt{AsInt: int64(value)},
+	}
+}
+
+func otlpDoublePoint(attrs []*commonpb.KeyValue, ts uint64, value float64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:   attrs,
+		TimeUnixNano: ts,
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+// 将 key, value 交替排列的字符串转换为 OTLP 属性
+func otlpAttributes(kv ...string) []*commonpb.KeyValue {
+	attrs := make([]*commonpb.KeyValue, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   kv[i],
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: kv[i+1]}},
+		})
+	}
+	return attrs
+}
+
+// 关闭 OTLP 导出器（释放 gRPC 连接）
+func closeOTLPExporter() {
+	if otlpGRPCConn != nil {
+		otlpGRPCConn.Close()
+		otlpGRPCConn = nil
+	}
+}
@@ -0,0 +1,216 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// 测试用 IP：10.0.0.1 -> 10.0.0.2（与 BPF map 中的网络字节序保持一致）
+const (
+	testSrcIP = uint32(0x0100000a)
+	testDstIP = uint32(0x0200000a)
+)
+
+func testSamples(ts time.Time) ([]FlowSample, []NICSample) {
+	key := FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: 0xb712, DstPort: 0xb712, Proto: 0xFE}
+	flows := []FlowSample{{
+		Interface:    "ib0",
+		Key:          key,
+		SrcPort:      4791,
+		DstPort:      4791,
+		TrafficType:  "RoCE_v2",
+		DeltaPackets: 10,
+		DeltaBytes:   4096,
+		BytesPerSec:  819.2,
+		BitsPerSec:   6553.6,
+		Interval:     5,
+		Timestamp:    ts,
+	}}
+	nics := []NICSample{{
+		Interface: "ib0",
+		Key:       NICKey{SrcIP: testSrcIP, DstIP: testDstIP, Proto: 0xFE},
+		Rate:      NICRate{bytesPerSec: 819.2, bitsPerSec: 6553.6, trafficType: "RoCE_v2"},
+		Timestamp: ts,
+	}}
+	return flows, nics
+}
+
+func attrMap(attrs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		m[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return m
+}
+
+// 校验接收端收到的请求与 testSamples 一致
+func checkOTLPRequest(t *testing.T, req *colmetricspb.ExportMetricsServiceRequest, ts time.Time) {
+	t.Helper()
+
+	if len(req.ResourceMetrics) != 1 {
+		t.Fatalf("ResourceMetrics = %d, want 1", len(req.ResourceMetrics))
+	}
+	rm := req.ResourceMetrics[0]
+	res := attrMap(rm.GetResource().GetAttributes())
+	if res["host_ip"] != "192.0.2.10" || res["collect_agg"] != "test-agg" || res["interface"] != "ib0" {
+		t.Errorf("resource attributes = %v", res)
+	}
+
+	metrics := make(map[string]*metricspb.Metric)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	bytesSum := metrics["xtrace_network_flow_bytes"].GetSum()
+	if bytesSum == nil {
+		t.Fatalf("xtrace_network_flow_bytes is not a Sum")
+	}
+	if bytesSum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA || !bytesSum.IsMonotonic {
+		t.Errorf("xtrace_network_flow_bytes temporality = %v monotonic = %v", bytesSum.AggregationTemporality, bytesSum.IsMonotonic)
+	}
+	dp := bytesSum.DataPoints[0]
+	if dp.GetAsInt() != 4096 {
+		t.Errorf("flow bytes = %d, want 4096", dp.GetAsInt())
+	}
+	if dp.TimeUnixNano != uint64(ts.UnixNano()) || dp.StartTimeUnixNano != uint64(ts.Add(-5*time.Second).UnixNano()) {
+		t.Errorf("flow bytes window = [%d, %d]", dp.StartTimeUnixNano, dp.TimeUnixNano)
+	}
+	attrs := attrMap(dp.Attributes)
+	if attrs["src_ip"] != "10.0.0.1" || attrs["dst_ip"] != "10.0.0.2" || attrs["dst_port"] != "4791" || attrs["traffic_type"] != "RoCE_v2" {
+		t.Errorf("flow attributes = %v", attrs)
+	}
+
+	if got := metrics["xtrace_network_flow_packets"].GetSum().GetDataPoints()[0].GetAsInt(); got != 10 {
+		t.Errorf("flow packets = %d, want 10", got)
+	}
+	if got := metrics["xtrace_network_flow_bits_rate"].GetGauge().GetDataPoints()[0].GetAsDouble(); got != 6553.6 {
+		t.Errorf("flow bits rate = %v, want 6553.6", got)
+	}
+	nic := metrics["xtrace_network_nic_bytes_rate"].GetGauge()
+	if nic == nil || nic.DataPoints[0].GetAsDouble() != 819.2 {
+		t.Errorf("nic bytes rate = %v", nic)
+	}
+	if _, ok := attrMap(nic.DataPoints[0].Attributes)["src_port"]; ok {
+		t.Errorf("nic data point should not carry port attributes")
+	}
+}
+
+// 测试结束后恢复算网标签和 OTLP 导出器配置
+func restoreOTLPExporter(t *testing.T) {
+	oldAgg := currentCollectAgg()
+	oldEnabled, oldProtocol, oldEndpoint := otlpEnabled, otlpProtocol, otlpEndpoint
+	oldConn, oldClient := otlpGRPCConn, otlpGRPCClient
+	t.Cleanup(func() {
+		setCollectAgg(oldAgg)
+		otlpEnabled, otlpProtocol, otlpEndpoint = oldEnabled, oldProtocol, oldEndpoint
+		otlpGRPCConn, otlpGRPCClient = oldConn, oldClient
+	})
+}
+
+func TestPushMetricsToOTLPHTTP(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received *colmetricspb.ExportMetricsServiceRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &colmetricspb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = req
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	restoreOTLPExporter(t)
+	setCollectAgg("test-agg")
+	if err := initOTLPExporter(srv.URL+"/v1/metrics", "http"); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Unix(1700000000, 0)
+	flows, nics := testSamples(ts)
+	if err := pushMetricsToOTLP(flows, nics, nil, "192.0.2.10"); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received == nil {
+		t.Fatal("receiver got no request")
+	}
+	checkOTLPRequest(t, received, ts)
+}
+
+// 最小化的 OTLP/gRPC 接收端
+type otlpReceiverStub struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	got chan *colmetricspb.ExportMetricsServiceRequest
+}
+
+func (s *otlpReceiverStub) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.got <- req
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestPushMetricsToOTLPGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &otlpReceiverStub{got: make(chan *colmetricspb.ExportMetricsServiceRequest, 1)}
+	srv := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(srv, stub)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	restoreOTLPExporter(t)
+	setCollectAgg("test-agg")
+	if err := initOTLPExporter(lis.Addr().String(), "grpc"); err != nil {
+		t.Fatal(err)
+	}
+	defer closeOTLPExporter()
+
+	ts := time.Unix(1700000000, 0)
+	flows, nics := testSamples(ts)
+	if err := pushMetricsToOTLP(flows, nics, nil, "192.0.2.10"); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	select {
+	case req := <-stub.got:
+		checkOTLPRequest(t, req, ts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("receiver got no request")
+	}
+}
+
+func TestInitOTLPExporterRejectsUnknownProtocol(t *testing.T) {
+	if err := initOTLPExporter("", "thrift"); err == nil {
+		t.Fatal("expected error for unknown protocol")
+	}
+}
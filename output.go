@@ -0,0 +1,212 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 标准输出格式
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputCSV  = "csv"
+)
+
+var (
+	outputFormat = outputText
+	outputMu     sync.Mutex             // 多个接口 goroutine 同时输出，保证每行完整
+	outputWriter io.Writer  = os.Stdout // 记录输出目标（测试时替换）
+	csvWriter               = csv.NewWriter(outputWriter)
+	csvHeader    sync.Once
+)
+
+// 校验输出格式
+func validOutputFormat(format string) bool {
+	switch format {
+	case outputText, outputJSON, outputCSV:
+		return true
+	default:
+		return false
+	}
+}
+
+// JSON / CSV 模式下每个流每个周期输出的一条记录
+type flowRecord struct {
+	Timestamp       string  `json:"timestamp"`
+	Interface       string  `json:"interface"`
+	SrcIP           string  `json:"src_ip"`
+	DstIP           string  `json:"dst_ip"`
+	SrcPort         uint16  `json:"src_port"`
+	DstPort         uint16  `json:"dst_port"`
+	Protocol        uint8   `json:"protocol"`
+	TrafficType     string  `json:"traffic_type"`
+	Packets         uint64  `json:"packets"`
+	Bytes           uint64  `json:"bytes"`
+	BytesPerSec     float64 `json:"bytes_per_sec"`
+	BitsPerSec      float64 `json:"bits_per_sec"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+	HostIP          string  `json:"host_ip"`
+}
+
+var flowRecordCSVHeader = []string{
+	"timestamp", "interface", "src_ip", "dst_ip", "src_port", "dst_port", "protocol", "traffic_type",
+	"packets", "bytes", "bytes_per_sec", "bits_per_sec", "interval_seconds", "host_ip",
+}
+
+func newFlowRecord(s FlowSample, hostIP string) flowRecord {
+	return flowRecord{
+		Timestamp:       s.Timestamp.Format(time.RFC3339Nano),
+		Interface:       s.Interface,
+		SrcIP:           ipToStr(s.Key.SrcIP),
+		DstIP:           ipToStr(s.Key.DstIP),
+		SrcPort:         s.SrcPort,
+		DstPort:         s.DstPort,
+		Protocol:        s.Key.Proto,
+		TrafficType:     s.TrafficType,
+		Packets:         s.DeltaPackets,
+		Bytes:           s.DeltaBytes,
+		BytesPerSec:     s.BytesPerSec,
+		BitsPerSec:      s.BitsPerSec,
+		IntervalSeconds: s.Interval,
+		HostIP:          hostIP,
+	}
+}
+
+func (r flowRecord) csvRow() []string {
+	return []string{
+		r.Timestamp, r.Interface, r.SrcIP, r.DstIP,
+		strconv.Itoa(int(r.SrcPort)), strconv.Itoa(int(r.DstPort)), strconv.Itoa(int(r.Protocol)), r.TrafficType,
+		strconv.FormatUint(r.Packets, 10), strconv.FormatUint(r.Bytes, 10),
+		strconv.FormatFloat(r.BytesPerSec, 'f', -1, 64), strconv.FormatFloat(r.BitsPerSec, 'f', -1, 64),
+		strconv.FormatFloat(r.IntervalSeconds, 'f', -1, 64), r.HostIP,
+	}
+}
+
+// 按输出格式打印一条流记录
+func printFlow(s FlowSample, hostIP, format string) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	switch format {
+	case outputJSON:
+		line, err := json.Marshal(newFlowRecord(s, hostIP))
+		if err != nil {
+			return
+		}
+		outputWriter.Write(append(line, '\n'))
+	case outputCSV:
+		csvHeader.Do(func() {
+			csvWriter.Write(flowRecordCSVHeader)
+		})
+		csvWriter.Write(newFlowRecord(s, hostIP).csvRow())
+		csvWriter.Flush()
+	default:
+		// 打印流量信息（增量值 + 速率），包含接口名称
+		fmt.Fprintf(outputWriter, "[%s] %s:%d -> %s:%d proto=%d%s packets=%d bytes=%d (%.2f MB/s, %.2f Mbps) host_ip=%s\n",
+			s.Interface, ipToStr(s.Key.SrcIP), s.SrcPort,
+			ipToStr(s.Key.DstIP), s.DstPort,
+			s.Key.Proto, formatTrafficType(s.TrafficType), s.DeltaPackets, s.DeltaBytes,
+			s.BytesPerSec/1024/1024, s.BitsPerSec/1000000, hostIP)
+	}
+}
+
+// 启用 --conversations 时每个会话每个周期输出的一条记录（替代两个方向的流记录）
+type conversationRecord struct {
+	Timestamp       string  `json:"timestamp"`
+	Interface       string  `json:"interface"`
+	IPA             string  `json:"ip_a"`
+	IPB             string  `json:"ip_b"`
+	PortA           uint16  `json:"port_a"`
+	PortB           uint16  `json:"port_b"`
+	Protocol        uint8   `json:"protocol"`
+	TrafficType     string  `json:"traffic_type"`
+	PacketsAToB     uint64  `json:"packets_a_to_b"`
+	PacketsBToA     uint64  `json:"packets_b_to_a"`
+	BytesAToB       uint64  `json:"bytes_a_to_b"`
+	BytesBToA       uint64  `json:"bytes_b_to_a"`
+	BytesPerSecAToB float64 `json:"bytes_per_sec_a_to_b"`
+	BytesPerSecBToA float64 `json:"bytes_per_sec_b_to_a"`
+	Asymmetry       float64 `json:"asymmetry"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+	HostIP          string  `json:"host_ip"`
+}
+
+var conversationRecordCSVHeader = []string{
+	"timestamp", "interface", "ip_a", "ip_b", "port_a", "port_b", "protocol", "traffic_type",
+	"packets_a_to_b", "packets_b_to_a", "bytes_a_to_b", "bytes_b_to_a",
+	"bytes_per_sec_a_to_b", "bytes_per_sec_b_to_a", "asymmetry", "interval_seconds", "host_ip",
+}
+
+func newConversationRecord(c ConversationSample, hostIP string) conversationRecord {
+	return conversationRecord{
+		Timestamp:       c.Timestamp.Format(time.RFC3339Nano),
+		Interface:       c.Interface,
+		IPA:             ipToStr(c.Key.IPA),
+		IPB:             ipToStr(c.Key.IPB),
+		PortA:           c.Key.PortA,
+		PortB:           c.Key.PortB,
+		Protocol:        c.Key.Proto,
+		TrafficType:     c.TrafficType,
+		PacketsAToB:     c.PacketsAToB,
+		PacketsBToA:     c.PacketsBToA,
+		BytesAToB:       c.BytesAToB,
+		BytesBToA:       c.BytesBToA,
+		BytesPerSecAToB: c.BytesPerSecAToB,
+		BytesPerSecBToA: c.BytesPerSecBToA,
+		Asymmetry:       c.Asymmetry(),
+		IntervalSeconds: c.Interval,
+		HostIP:          hostIP,
+	}
+}
+
+func (r conversationRecord) csvRow() []string {
+	return []string{
+		r.Timestamp, r.Interface, r.IPA, r.IPB,
+		strconv.Itoa(int(r.PortA)), strconv.Itoa(int(r.PortB)), strconv.Itoa(int(r.Protocol)), r.TrafficType,
+		strconv.FormatUint(r.PacketsAToB, 10), strconv.FormatUint(r.PacketsBToA, 10),
+		strconv.FormatUint(r.BytesAToB, 10), strconv.FormatUint(r.BytesBToA, 10),
+		strconv.FormatFloat(r.BytesPerSecAToB, 'f', -1, 64), strconv.FormatFloat(r.BytesPerSecBToA, 'f', -1, 64),
+		strconv.FormatFloat(r.Asymmetry, 'f', -1, 64), strconv.FormatFloat(r.IntervalSeconds, 'f', -1, 64), r.HostIP,
+	}
+}
+
+// 按输出格式打印一条会话记录
+func printConversation(c ConversationSample, hostIP, format string) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	switch format {
+	case outputJSON:
+		line, err := json.Marshal(newConversationRecord(c, hostIP))
+		if err != nil {
+			return
+		}
+		outputWriter.Write(append(line, '\n'))
+	case outputCSV:
+		csvHeader.Do(func() {
+			csvWriter.Write(conversationRecordCSVHeader)
+		})
+		csvWriter.Write(newConversationRecord(c, hostIP).csvRow())
+		csvWriter.Flush()
+	default:
+		endpointA, endpointB := ipToStr(c.Key.IPA), ipToStr(c.Key.IPB)
+		if conversationMode == conversationsPort {
+			endpointA += ":" + strconv.Itoa(int(c.Key.PortA))
+			endpointB += ":" + strconv.Itoa(int(c.Key.PortB))
+		}
+		fmt.Fprintf(outputWriter, "[%s] %s <-> %s proto=%d%s a->b: packets=%d bytes=%d (%.2f MB/s) b->a: packets=%d bytes=%d (%.2f MB/s) asymmetry=%.2f host_ip=%s\n",
+			c.Interface, endpointA, endpointB, c.Key.Proto, formatTrafficType(c.TrafficType),
+			c.PacketsAToB, c.BytesAToB, c.BytesPerSecAToB/1024/1024,
+			c.PacketsBToA, c.BytesBToA, c.BytesPerSecBToA/1024/1024,
+			c.Asymmetry(), hostIP)
+	}
+}
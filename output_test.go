@@ -0,0 +1,132 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 把记录输出重定向到缓冲区，测试结束后恢复到标准输出
+func captureOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	oldWriter, oldCSV := outputWriter, csvWriter
+	outputWriter = &buf
+	csvWriter = csv.NewWriter(&buf)
+	csvHeader = sync.Once{}
+	t.Cleanup(func() {
+		outputWriter, csvWriter = oldWriter, oldCSV
+		csvHeader = sync.Once{}
+	})
+	return &buf
+}
+
+func outputTestFlow() FlowSample {
+	flows, _ := testSamples(time.Unix(1700000000, 250000000).UTC())
+	f := flows[0]
+	f.BytesPerSec = 2621440
+	f.BitsPerSec = 20971520
+	return f
+}
+
+func TestPrintFlow(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: outputText,
+			want:   "[ib0] 10.0.0.1:4791 -> 10.0.0.2:4791 proto=254 [RoCE v2] packets=10 bytes=4096 (2.50 MB/s, 20.97 Mbps) host_ip=192.0.2.10\n",
+		},
+		{
+			format: outputJSON,
+			want: `{"timestamp":"2023-11-14T22:13:20.25Z","interface":"ib0","src_ip":"10.0.0.1","dst_ip":"10.0.0.2","src_port":4791,"dst_port":4791,` +
+				`"protocol":254,"traffic_type":"RoCE_v2","packets":10,"bytes":4096,"bytes_per_sec":2621440,"bits_per_sec":20971520,` +
+				`"interval_seconds":5,"host_ip":"192.0.2.10"}` + "\n",
+		},
+		{
+			// 表头只输出一次
+			format: outputCSV,
+			want: "timestamp,interface,src_ip,dst_ip,src_port,dst_port,protocol,traffic_type,packets,bytes,bytes_per_sec,bits_per_sec,interval_seconds,host_ip\n" +
+				"2023-11-14T22:13:20.25Z,ib0,10.0.0.1,10.0.0.2,4791,4791,254,RoCE_v2,10,4096,2621440,20971520,5,192.0.2.10\n" +
+				"2023-11-14T22:13:20.25Z,ib0,10.0.0.1,10.0.0.2,4791,4791,254,RoCE_v2,10,4096,2621440,20971520,5,192.0.2.10\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			buf := captureOutput(t)
+			printFlow(outputTestFlow(), "192.0.2.10", tt.format)
+			if tt.format == outputCSV {
+				printFlow(outputTestFlow(), "192.0.2.10", tt.format)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintConversation(t *testing.T) {
+	c := ConversationSample{
+		Interface:       "ib0",
+		Key:             ConversationKey{IPA: testSrcIP, IPB: testDstIP, PortA: 40000, PortB: 80, Proto: 6},
+		TrafficType:     "TCP",
+		PacketsAToB:     30,
+		PacketsBToA:     10,
+		BytesAToB:       3145728,
+		BytesBToA:       1048576,
+		BytesPerSecAToB: 3145728,
+		BytesPerSecBToA: 1048576,
+		Interval:        1,
+		Timestamp:       time.Unix(1700000000, 0).UTC(),
+	}
+
+	tests := []struct {
+		format string
+		mode   string
+		want   string
+	}{
+		{
+			format: outputText,
+			mode:   conversationsIP,
+			want:   "[ib0] 10.0.0.1 <-> 10.0.0.2 proto=6 [TCP] a->b: packets=30 bytes=3145728 (3.00 MB/s) b->a: packets=10 bytes=1048576 (1.00 MB/s) asymmetry=0.50 host_ip=192.0.2.10\n",
+		},
+		{
+			// port 模式下端点带端口
+			format: outputText,
+			mode:   conversationsPort,
+			want:   "[ib0] 10.0.0.1:40000 <-> 10.0.0.2:80 proto=6 [TCP] a->b: packets=30 bytes=3145728 (3.00 MB/s) b->a: packets=10 bytes=1048576 (1.00 MB/s) asymmetry=0.50 host_ip=192.0.2.10\n",
+		},
+		{
+			format: outputJSON,
+			mode:   conversationsPort,
+			want: `{"timestamp":"2023-11-14T22:13:20Z","interface":"ib0","ip_a":"10.0.0.1","ip_b":"10.0.0.2","port_a":40000,"port_b":80,"protocol":6,` +
+				`"traffic_type":"TCP","packets_a_to_b":30,"packets_b_to_a":10,"bytes_a_to_b":3145728,"bytes_b_to_a":1048576,` +
+				`"bytes_per_sec_a_to_b":3145728,"bytes_per_sec_b_to_a":1048576,"asymmetry":0.5,"interval_seconds":1,"host_ip":"192.0.2.10"}` + "\n",
+		},
+		{
+			format: outputCSV,
+			mode:   conversationsPort,
+			want: "timestamp,interface,ip_a,ip_b,port_a,port_b,protocol,traffic_type,packets_a_to_b,packets_b_to_a,bytes_a_to_b,bytes_b_to_a," +
+				"bytes_per_sec_a_to_b,bytes_per_sec_b_to_a,asymmetry,interval_seconds,host_ip\n" +
+				"2023-11-14T22:13:20Z,ib0,10.0.0.1,10.0.0.2,40000,80,6,TCP,30,10,3145728,1048576,3145728,1048576,0.5,1,192.0.2.10\n",
+		},
+	}
+	oldMode := conversationMode
+	t.Cleanup(func() { conversationMode = oldMode })
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.mode, func(t *testing.T) {
+			conversationMode = tt.mode
+			buf := captureOutput(t)
+			printConversation(c, "192.0.2.10", tt.format)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
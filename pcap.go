@@ -0,0 +1,264 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// pcap 文件头的 magic（微秒 / 纳秒时间戳）
+const (
+	pcapMagicMicros = 0xa1b2c3d4
+	pcapMagicNanos  = 0xa1b23c4d
+)
+
+// 单个数据包记录的最大捕获长度，超过时认为文件损坏
+const pcapMaxSnapLen = 1 << 18
+
+// 从抓包文件中读取的一个数据包
+type pcapPacket struct {
+	Timestamp time.Time
+	Data      []byte // 捕获到的数据（可能被 snaplen 截断）
+	Length    int    // 线上的原始长度
+}
+
+// 抓包文件读取器（pcap / pcapng）
+type packetReader interface {
+	// 读取下一个数据包，文件结束时返回 io.EOF
+	next() (pcapPacket, error)
+}
+
+// 按文件头识别 pcap 或 pcapng 格式
+func newPacketReader(r io.Reader) (packetReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件头失败: %w", err)
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngSectionHeader {
+		return newPcapngReader(br)
+	}
+	return newPcapReader(br)
+}
+
+// 经典 pcap 格式（libpcap / tcpdump -w）读取器
+type pcapReader struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint32
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	br := bufio.NewReader(r)
+	var hdr [24]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, fmt.Errorf("读取 pcap 文件头失败: %w", err)
+	}
+
+	p := &pcapReader{r: br}
+	switch magic := binary.LittleEndian.Uint32(hdr[0:4]); {
+	case magic == pcapMagicMicros || magic == pcapMagicNanos:
+		p.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[0:4]) == pcapMagicMicros || binary.BigEndian.Uint32(hdr[0:4]) == pcapMagicNanos:
+		p.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("不是 pcap 文件 (magic 0x%08x)", magic)
+	}
+	p.nanos = p.order.Uint32(hdr[0:4]) == pcapMagicNanos
+	p.linkType = p.order.Uint32(hdr[20:24])
+	return p, nil
+}
+
+// 读取下一个数据包，文件结束时返回 io.EOF
+func (p *pcapReader) next() (pcapPacket, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return pcapPacket{}, fmt.Errorf("数据包记录头不完整: %w", err)
+		}
+		return pcapPacket{}, err
+	}
+	sec := p.order.Uint32(hdr[0:4])
+	frac := p.order.Uint32(hdr[4:8])
+	capLen := p.order.Uint32(hdr[8:12])
+	origLen := p.order.Uint32(hdr[12:16])
+	if capLen > pcapMaxSnapLen {
+		return pcapPacket{}, fmt.Errorf("数据包捕获长度 %d 超出范围", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return pcapPacket{}, fmt.Errorf("读取数据包失败: %w", err)
+	}
+
+	nsec := int64(frac) * 1000
+	if p.nanos {
+		nsec = int64(frac)
+	}
+	return pcapPacket{
+		Timestamp: time.Unix(int64(sec), nsec),
+		Data:      data,
+		Length:    int(max(origLen, capLen)),
+	}, nil
+}
+
+// parsePacket 按 xdp_monitor.c 的规则解析一个数据包，返回写入 flows map 的 key
+//
+// data 为捕获到的数据，length 为原始长度（XDP 中的 data_end - data）。
+// 无法解析为 IPv4 的数据包返回 src_ip、dst_ip 都为 0 的 key（与 handle_other 相同）。
+func parsePacket(data []byte, length int) FlowKey {
+	// 扫描前64字节寻找 IPv4 头（0x45 开头），IPoIB 等头部大小不固定
+	for offset := 0; offset < 64; offset += 2 {
+		if offset+20 > len(data) {
+			break
+		}
+		ip := data[offset:]
+		version, ihl := ip[0]>>4, int(ip[0]&0x0F)
+		if version != 4 || ihl < 5 {
+			continue
+		}
+		// 总长度应该 <= 包长度，且 >= IP 头最小长度
+		totLen := int(binary.BigEndian.Uint16(ip[2:4]))
+		if totLen < 20 || totLen > length || ip[9] == 0 {
+			continue
+		}
+
+		key := FlowKey{
+			SrcIP: binary.LittleEndian.Uint32(ip[12:16]),
+			DstIP: binary.LittleEndian.Uint32(ip[16:20]),
+			Proto: ip[9],
+		}
+		if key.Proto == 6 || key.Proto == 17 {
+			// 与 C 代码相同，TCP 和 UDP 都按 struct tcphdr（20 字节）检查边界
+			l4 := ihl * 4
+			if l4+20 > len(ip) {
+				break
+			}
+			// 端口与 BPF map 中一致，保持网络字节序的原始内存布局
+			key.SrcPort = binary.LittleEndian.Uint16(ip[l4 : l4+2])
+			key.DstPort = binary.LittleEndian.Uint16(ip[l4+2 : l4+4])
+			// 检测 RoCE v2 流量 (UDP port 4791)
+			if key.Proto == 17 && (key.SrcPort == roceV2Port || key.DstPort == roceV2Port) {
+				key.Proto = 0xFE
+			}
+		}
+		return key
+	}
+
+	// 无法解析的数据包：记录包长度低8位和前2个字节
+	key := FlowKey{PktLenLow: uint8(length)}
+	if len(data) >= 2 {
+		key.FirstU16 = binary.LittleEndian.Uint16(data[0:2])
+	}
+	return key
+}
+
+// 按 XDP 程序的方式把一个数据包计入 flows（ts 为纳秒时间戳）
+func recordPacket(flows map[FlowKey]FlowStats, key FlowKey, length int, ts uint64) {
+	v, ok := flows[key]
+	if !ok {
+		flows[key] = FlowStats{Packets: 1, Bytes: uint64(length), LastUpdate: ts, FirstSeen: ts}
+		return
+	}
+	v.Packets++
+	v.Bytes += uint64(length)
+	v.LastUpdate = ts
+	flows[key] = v
+}
+
+// 回放抓包文件（pcap / pcapng）的流数据来源
+//
+// 数据包按 advance 推进的回放时刻计入，FlowStats 的时间戳为数据包时间（Unix 纳秒），
+// 调用方以回放时刻作为 collectFlows 的 WindowStart 和采集间隔。
+type pcapSource struct {
+	reader   packetReader
+	flows    map[FlowKey]FlowStats
+	pending  *pcapPacket // 已读取、但晚于当前回放时刻的数据包
+	lastRead time.Time   // 最后读取的数据包的时间戳
+	done     bool
+
+	packets    uint64    // 已回放的数据包数
+	lastPacket time.Time // 最后一个已回放数据包的时间戳
+
+	bursts *burstCounter // 微突发统计（--burst-slot），未启用时为 nil
+}
+
+func newPcapSource(r io.Reader) (*pcapSource, error) {
+	reader, err := newPacketReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &pcapSource{reader: reader, flows: make(map[FlowKey]FlowStats)}, nil
+}
+
+// 下一个待回放数据包的时间戳，文件已读完时返回 false
+func (s *pcapSource) nextTimestamp() (time.Time, bool, error) {
+	if err := s.fill(); err != nil {
+		return time.Time{}, false, err
+	}
+	if s.pending == nil {
+		return time.Time{}, false, nil
+	}
+	return s.pending.Timestamp, true, nil
+}
+
+// 回放时间戳不晚于 until 的所有数据包
+func (s *pcapSource) advance(until time.Time) error {
+	for {
+		if err := s.fill(); err != nil {
+			return err
+		}
+		if s.pending == nil || s.pending.Timestamp.After(until) {
+			return nil
+		}
+		pkt := s.pending
+		s.pending = nil
+		s.packets++
+		s.lastPacket = pkt.Timestamp
+		recordPacket(s.flows, parsePacket(pkt.Data, pkt.Length), pkt.Length, uint64(pkt.Timestamp.UnixNano()))
+		if s.bursts != nil {
+			s.bursts.record(pkt.Length, uint64(pkt.Timestamp.UnixNano()))
+		}
+	}
+}
+
+// 预读一个数据包
+func (s *pcapSource) fill() error {
+	if s.pending != nil || s.done {
+		return nil
+	}
+	pkt, err := s.reader.next()
+	if err == io.EOF {
+		s.done = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// 没有时间戳的数据包（pcapng Simple Packet Block）沿用上一个数据包的时间戳
+	if pkt.Timestamp.IsZero() {
+		pkt.Timestamp = s.lastRead
+	}
+	s.lastRead = pkt.Timestamp
+	s.pending = &pkt
+	return nil
+}
+
+func (s *pcapSource) Snapshot() (map[FlowKey]FlowStats, error) {
+	out := make(map[FlowKey]FlowStats, len(s.flows))
+	for k, v := range s.flows {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *pcapSource) Capacity() int {
+	return 0
+}
@@ -0,0 +1,359 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// 构造测试帧的 L2 头部
+var (
+	testEthHeader   = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0x08, 0x00}
+	testVLANHeader  = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0x81, 0x00, 0x00, 0x64, 0x08, 0x00}
+	testIPoIBHeader = []byte{0x08, 0x00, 0x00, 0x00}
+)
+
+// 构造 IPv4 数据包：l2 头 + IP 头 + L4 头（TCP 20 字节 / UDP 8 字节）+ payload 字节的填充
+func testIPv4Frame(l2 []byte, proto uint8, srcPort, dstPort uint16, payload int) []byte {
+	l4 := 0
+	switch proto {
+	case 6:
+		l4 = 20
+	case 17:
+		l4 = 8
+	}
+	ip := make([]byte, 20+l4+payload)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(len(ip)))
+	ip[8] = 64
+	ip[9] = proto
+	copy(ip[12:16], []byte{10, 0, 0, 1})
+	copy(ip[16:20], []byte{10, 0, 0, 2})
+	if l4 > 0 {
+		binary.BigEndian.PutUint16(ip[20:22], srcPort)
+		binary.BigEndian.PutUint16(ip[22:24], dstPort)
+	}
+	return append(append([]byte{}, l2...), ip...)
+}
+
+// 网络字节序端口在 FlowKey 中的表示
+func testPort(p uint16) uint16 {
+	return p>>8 | p<<8
+}
+
+func TestParsePacket(t *testing.T) {
+	arp := append(append([]byte{}, testEthHeader[:12]...), 0x08, 0x06)
+	arp = append(arp, make([]byte, 28)...)
+
+	udpShort := testIPv4Frame(testEthHeader, 17, 1000, 2000, 0)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		length int // 0 表示与 data 相同
+		want   FlowKey
+	}{
+		{
+			name: "ethernet TCP",
+			data: testIPv4Frame(testEthHeader, 6, 40000, 80, 10),
+			want: FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: testPort(40000), DstPort: testPort(80), Proto: 6},
+		},
+		{
+			name: "ethernet UDP to RoCE v2 port",
+			data: testIPv4Frame(testEthHeader, 17, 50000, 4791, 64),
+			want: FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: testPort(50000), DstPort: roceV2Port, Proto: 0xFE},
+		},
+		{
+			name: "ethernet plain UDP",
+			data: testIPv4Frame(testEthHeader, 17, 5353, 5353, 32),
+			want: FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: testPort(5353), DstPort: testPort(5353), Proto: 17},
+		},
+		{
+			name: "VLAN tagged TCP",
+			data: testIPv4Frame(testVLANHeader, 6, 1234, 443, 0),
+			want: FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: testPort(1234), DstPort: testPort(443), Proto: 6},
+		},
+		{
+			name: "IPoIB RoCE v2",
+			data: testIPv4Frame(testIPoIBHeader, 17, 4791, 4791, 256),
+			want: FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: roceV2Port, DstPort: roceV2Port, Proto: 0xFE},
+		},
+		{
+			name: "other IP protocol has no ports",
+			data: testIPv4Frame(testEthHeader, 1, 0, 0, 56),
+			want: FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, Proto: 1},
+		},
+		{
+			// 与 C 代码一致：UDP 也按 20 字节的 TCP 头检查边界
+			name: "UDP without room for a TCP header is unparsed",
+			data: udpShort,
+			want: FlowKey{PktLenLow: uint8(len(udpShort)), FirstU16: binary.LittleEndian.Uint16(udpShort)},
+		},
+		{
+			name: "ARP is unparsed",
+			data: arp,
+			want: FlowKey{PktLenLow: uint8(len(arp)), FirstU16: 0x0100},
+		},
+		{
+			name: "truncated IP header",
+			data: testIPv4Frame(testEthHeader, 6, 1, 2, 0)[:30],
+			want: FlowKey{PktLenLow: 30, FirstU16: 0x0100},
+		},
+		{
+			name:   "snaplen-truncated capture uses the original length",
+			data:   testIPv4Frame(testEthHeader, 6, 40000, 80, 1400)[:96],
+			length: 14 + 20 + 20 + 1400,
+			want:   FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: testPort(40000), DstPort: testPort(80), Proto: 6},
+		},
+		{
+			name: "one byte frame",
+			data: []byte{0x45},
+			want: FlowKey{PktLenLow: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			length := tt.length
+			if length == 0 {
+				length = len(tt.data)
+			}
+			if got := parsePacket(tt.data, length); got != tt.want {
+				t.Errorf("parsePacket() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 写入经典 pcap 格式（微秒时间戳，以太网链路类型）
+func writeTestPcap(t *testing.T, order binary.ByteOrder, packets []pcapPacket) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	hdr := make([]byte, 24)
+	order.PutUint32(hdr[0:4], pcapMagicMicros)
+	order.PutUint16(hdr[4:6], 2)
+	order.PutUint16(hdr[6:8], 4)
+	order.PutUint32(hdr[16:20], 65535)
+	order.PutUint32(hdr[20:24], 1)
+	buf.Write(hdr)
+	for _, p := range packets {
+		rec := make([]byte, 16)
+		order.PutUint32(rec[0:4], uint32(p.Timestamp.Unix()))
+		order.PutUint32(rec[4:8], uint32(p.Timestamp.Nanosecond()/1000))
+		order.PutUint32(rec[8:12], uint32(len(p.Data)))
+		order.PutUint32(rec[12:16], uint32(p.Length))
+		buf.Write(rec)
+		buf.Write(p.Data)
+	}
+	return buf.Bytes()
+}
+
+func TestPcapReader(t *testing.T) {
+	start := time.Unix(1700000000, 250000000)
+	frame := testIPv4Frame(testEthHeader, 6, 40000, 80, 10)
+	packets := []pcapPacket{
+		{Timestamp: start, Data: frame, Length: len(frame)},
+		{Timestamp: start.Add(1500 * time.Microsecond), Data: frame[:40], Length: len(frame)},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			r, err := newPcapReader(bytes.NewReader(writeTestPcap(t, order, packets)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.linkType != 1 {
+				t.Errorf("linkType = %d, want 1", r.linkType)
+			}
+			for i, want := range packets {
+				got, err := r.next()
+				if err != nil {
+					t.Fatalf("packet %d: %v", i, err)
+				}
+				if !got.Timestamp.Equal(want.Timestamp) || got.Length != want.Length || !bytes.Equal(got.Data, want.Data) {
+					t.Errorf("packet %d = %v len %d (%d captured), want %v len %d (%d captured)",
+						i, got.Timestamp, got.Length, len(got.Data), want.Timestamp, want.Length, len(want.Data))
+				}
+			}
+			if _, err := r.next(); err == nil {
+				t.Error("expected EOF after last packet")
+			}
+		})
+	}
+
+	if _, err := newPcapReader(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Error("expected error for bad magic")
+	}
+}
+
+// 回放的数据包按回放时刻计入，速率使用数据包时间而不是挂钟时间
+func TestPcapSourceReplay(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	roce := testIPv4Frame(testEthHeader, 17, 50000, 4791, 1000)
+	tcp := testIPv4Frame(testEthHeader, 6, 40000, 80, 100)
+
+	var packets []pcapPacket
+	// 第 1 秒：10 个 RoCE 包；第 2 秒：20 个 RoCE 包和 1 个 TCP 包
+	for i := 0; i < 10; i++ {
+		packets = append(packets, pcapPacket{Timestamp: start.Add(time.Duration(i) * 50 * time.Millisecond), Data: roce, Length: len(roce)})
+	}
+	for i := 0; i < 20; i++ {
+		packets = append(packets, pcapPacket{Timestamp: start.Add(time.Second + time.Duration(i)*25*time.Millisecond), Data: roce, Length: len(roce)})
+	}
+	packets = append(packets, pcapPacket{Timestamp: start.Add(1900 * time.Millisecond), Data: tcp, Length: len(tcp)})
+
+	src, err := newPcapSource(bytes.NewReader(writeTestPcap(t, binary.LittleEndian, packets)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, ok, err := src.nextTimestamp()
+	if err != nil || !ok || !first.Equal(start) {
+		t.Fatalf("nextTimestamp() = %v, %v, %v; want %v", first, ok, err, start)
+	}
+
+	roceKey := parsePacket(roce, len(roce))
+	tcpKey := parsePacket(tcp, len(tcp))
+	wantBytes := []map[FlowKey]uint64{
+		{roceKey: 10 * uint64(len(roce))},
+		{roceKey: 20 * uint64(len(roce)), tcpKey: uint64(len(tcp))},
+	}
+
+	last := map[FlowKey]FlowStats{}
+	window := start.Add(-time.Nanosecond)
+	for i, want := range wantBytes {
+		until := start.Add(time.Duration(i+1)*time.Second - time.Nanosecond)
+		if err := src.advance(until); err != nil {
+			t.Fatal(err)
+		}
+		flows, _ := src.Snapshot()
+		var snap ifaceSnapshot
+		snap, last = collectFlows("pcap", flows, last, collectOptions{
+			WindowStart: uint64(window.UnixNano()),
+			Interval:    until.Sub(window).Seconds(),
+			Epoch:       until,
+		})
+		window = until
+
+		if len(snap.Flows) != len(want) {
+			t.Fatalf("second %d: got %d flows, want %d", i, len(snap.Flows), len(want))
+		}
+		for _, f := range snap.Flows {
+			if f.DeltaBytes != want[f.Key] {
+				t.Errorf("second %d: %s delta = %d bytes, want %d", i, f.TrafficType, f.DeltaBytes, want[f.Key])
+			}
+			if rate := float64(want[f.Key]) / f.Interval; f.BytesPerSec != rate {
+				t.Errorf("second %d: %s rate = %v, want %v", i, f.TrafficType, f.BytesPerSec, rate)
+			}
+		}
+	}
+
+	if _, ok, err := src.nextTimestamp(); ok || err != nil {
+		t.Errorf("expected end of file, got ok=%v err=%v", ok, err)
+	}
+}
+
+// 写入 pcapng 格式：一个 SHB、一个纳秒分辨率的 IDB 和若干 EPB，中间夹一个被忽略的自定义块
+func writeTestPcapng(t *testing.T, order binary.ByteOrder, packets []pcapPacket) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	block := func(blockType uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		total := uint32(12 + len(body))
+		hdr := make([]byte, 8)
+		order.PutUint32(hdr[0:4], blockType)
+		order.PutUint32(hdr[4:8], total)
+		buf.Write(hdr)
+		buf.Write(body)
+		tail := make([]byte, 4)
+		order.PutUint32(tail, total)
+		buf.Write(tail)
+	}
+
+	shb := make([]byte, 16)
+	order.PutUint32(shb[0:4], pcapngByteOrderMagic)
+	order.PutUint16(shb[4:6], 1)
+	order.PutUint64(shb[8:16], ^uint64(0))
+	block(pcapngSectionHeader, shb)
+
+	// if_tsresol = 9（纳秒）
+	idb := make([]byte, 8, 20)
+	order.PutUint16(idb[0:2], 1)
+	order.PutUint32(idb[4:8], 262144)
+	opt := make([]byte, 8)
+	order.PutUint16(opt[0:2], 9)
+	order.PutUint16(opt[2:4], 1)
+	opt[4] = 9
+	idb = append(idb, opt...)
+	idb = append(idb, 0, 0, 0, 0) // opt_endofopt
+	block(pcapngInterfaceDesc, idb)
+
+	block(0x00000BAD, []byte("ignored"))
+
+	for _, p := range packets {
+		epb := make([]byte, 20)
+		ts := uint64(p.Timestamp.UnixNano())
+		order.PutUint32(epb[4:8], uint32(ts>>32))
+		order.PutUint32(epb[8:12], uint32(ts))
+		order.PutUint32(epb[12:16], uint32(len(p.Data)))
+		order.PutUint32(epb[16:20], uint32(p.Length))
+		block(pcapngEnhancedPacket, append(epb, p.Data...))
+	}
+	return buf.Bytes()
+}
+
+func TestPcapngReader(t *testing.T) {
+	start := time.Unix(1700000000, 123456789)
+	frame := testIPv4Frame(testIPoIBHeader, 17, 4791, 4791, 33)
+	packets := []pcapPacket{
+		{Timestamp: start, Data: frame, Length: len(frame)},
+		{Timestamp: start.Add(time.Nanosecond), Data: frame[:41], Length: len(frame)},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			r, err := newPacketReader(bytes.NewReader(writeTestPcapng(t, order, packets)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := r.(*pcapngReader); !ok {
+				t.Fatalf("newPacketReader() = %T, want *pcapngReader", r)
+			}
+			for i, want := range packets {
+				got, err := r.next()
+				if err != nil {
+					t.Fatalf("packet %d: %v", i, err)
+				}
+				if !got.Timestamp.Equal(want.Timestamp) || got.Length != want.Length || !bytes.Equal(got.Data, want.Data) {
+					t.Errorf("packet %d = %v len %d (%d captured), want %v len %d (%d captured)",
+						i, got.Timestamp, got.Length, len(got.Data), want.Timestamp, want.Length, len(want.Data))
+				}
+			}
+			if _, err := r.next(); err == nil {
+				t.Error("expected EOF after last packet")
+			}
+		})
+	}
+}
+
+func TestPcapngTimeResolution(t *testing.T) {
+	tests := []struct {
+		ts, perSec uint64
+		want       time.Time
+	}{
+		{1700000000123456, 1000000, time.Unix(1700000000, 123456000)},
+		{1700000000123456789, 1000000000, time.Unix(1700000000, 123456789)},
+		{1700000000<<10 | 512, 1 << 10, time.Unix(1700000000, 500000000)},
+		{17000000001, 10, time.Unix(1700000000, 100000000)},
+	}
+	for _, tt := range tests {
+		if got := pcapngTime(tt.ts, tt.perSec); !got.Equal(tt.want) {
+			t.Errorf("pcapngTime(%d, %d) = %v, want %v", tt.ts, tt.perSec, got, tt.want)
+		}
+	}
+}
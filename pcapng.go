@@ -0,0 +1,201 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// pcapng 块类型
+const (
+	pcapngSectionHeader  = 0x0A0D0D0A
+	pcapngInterfaceDesc  = 0x00000001
+	pcapngSimplePacket   = 0x00000003
+	pcapngEnhancedPacket = 0x00000006
+	pcapngByteOrderMagic = 0x1A2B3C4D
+)
+
+// 单个块的最大长度，超过时认为文件损坏
+const pcapngMaxBlockLen = 1 << 24
+
+// pcapng 中的一个接口（IDB）
+type pcapngInterface struct {
+	linkType uint16
+	snapLen  uint32
+	tsPerSec uint64 // 时间戳分辨率（每秒的刻度数），默认微秒
+}
+
+// pcapng 格式（Wireshark / dumpcap 默认）读取器，只读取数据包，忽略统计和注释等块
+type pcapngReader struct {
+	r          *bufio.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+}
+
+func newPcapngReader(r io.Reader) (*pcapngReader, error) {
+	p := &pcapngReader{r: bufio.NewReader(r)}
+	blockType, _, err := p.readBlock()
+	if err != nil {
+		return nil, fmt.Errorf("读取 pcapng 文件头失败: %w", err)
+	}
+	if blockType != pcapngSectionHeader {
+		return nil, fmt.Errorf("不是 pcapng 文件 (首个块类型 0x%08x)", blockType)
+	}
+	return p, nil
+}
+
+// 读取一个块，返回块类型和块内容（不含类型、长度字段）
+// Section Header Block 同时确定之后的字节序
+func (p *pcapngReader) readBlock() (uint32, []byte, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, fmt.Errorf("块头不完整: %w", err)
+		}
+		return 0, nil, err
+	}
+
+	// 块类型 0x0A0D0D0A 是回文，两种字节序相同
+	if binary.LittleEndian.Uint32(hdr[0:4]) == pcapngSectionHeader {
+		var magic [4]byte
+		if _, err := io.ReadFull(p.r, magic[:]); err != nil {
+			return 0, nil, fmt.Errorf("读取字节序标记失败: %w", err)
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic[:]) == pcapngByteOrderMagic:
+			p.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic[:]) == pcapngByteOrderMagic:
+			p.order = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("无效的 pcapng 字节序标记 0x%08x", binary.LittleEndian.Uint32(magic[:]))
+		}
+		// 新的 section 重新编号接口
+		p.interfaces = nil
+		body, err := p.readBody(p.order.Uint32(hdr[4:8]), 12)
+		if err != nil {
+			return 0, nil, err
+		}
+		return pcapngSectionHeader, append(magic[:], body...), nil
+	}
+
+	if p.order == nil {
+		return 0, nil, fmt.Errorf("缺少 Section Header Block")
+	}
+	blockType := p.order.Uint32(hdr[0:4])
+	body, err := p.readBody(p.order.Uint32(hdr[4:8]), 8)
+	return blockType, body, err
+}
+
+// 读取块的剩余内容（total 为块总长度，read 为已读取的字节数），并去掉末尾重复的长度字段
+func (p *pcapngReader) readBody(total uint32, read int) ([]byte, error) {
+	if total < uint32(read)+4 || total%4 != 0 || total > pcapngMaxBlockLen {
+		return nil, fmt.Errorf("无效的块长度 %d", total)
+	}
+	buf := make([]byte, int(total)-read)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return nil, fmt.Errorf("读取块内容失败: %w", err)
+	}
+	return buf[:len(buf)-4], nil
+}
+
+// 读取下一个数据包，文件结束时返回 io.EOF
+func (p *pcapngReader) next() (pcapPacket, error) {
+	for {
+		blockType, body, err := p.readBlock()
+		if err != nil {
+			return pcapPacket{}, err
+		}
+
+		switch blockType {
+		case pcapngInterfaceDesc:
+			if len(body) < 8 {
+				return pcapPacket{}, fmt.Errorf("接口描述块过短")
+			}
+			p.interfaces = append(p.interfaces, pcapngInterface{
+				linkType: p.order.Uint16(body[0:2]),
+				snapLen:  p.order.Uint32(body[4:8]),
+				tsPerSec: p.tsResolution(body[8:]),
+			})
+
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return pcapPacket{}, fmt.Errorf("数据包块过短")
+			}
+			ifaceID := p.order.Uint32(body[0:4])
+			if int(ifaceID) >= len(p.interfaces) {
+				return pcapPacket{}, fmt.Errorf("数据包引用了未定义的接口 %d", ifaceID)
+			}
+			ts := uint64(p.order.Uint32(body[4:8]))<<32 | uint64(p.order.Uint32(body[8:12]))
+			capLen := p.order.Uint32(body[12:16])
+			origLen := p.order.Uint32(body[16:20])
+			if uint64(capLen) > uint64(len(body)-20) {
+				return pcapPacket{}, fmt.Errorf("数据包捕获长度 %d 超出块长度", capLen)
+			}
+			return pcapPacket{
+				Timestamp: pcapngTime(ts, p.interfaces[ifaceID].tsPerSec),
+				Data:      body[20 : 20+capLen],
+				Length:    int(max(origLen, capLen)),
+			}, nil
+
+		case pcapngSimplePacket:
+			// 没有时间戳，只能按接口 0 的 snaplen 截断；时间戳取零值，由回放按上一个数据包处理
+			if len(body) < 4 || len(p.interfaces) == 0 {
+				return pcapPacket{}, fmt.Errorf("无效的简单数据包块")
+			}
+			origLen := p.order.Uint32(body[0:4])
+			capLen := min(origLen, uint32(len(body)-4))
+			if snap := p.interfaces[0].snapLen; snap != 0 {
+				capLen = min(capLen, snap)
+			}
+			return pcapPacket{Data: body[4 : 4+capLen], Length: int(origLen)}, nil
+		}
+		// 其他块（统计、名称解析、注释等）忽略
+	}
+}
+
+// 解析接口描述块选项中的 if_tsresol（代码 9），返回每秒的刻度数，默认微秒
+func (p *pcapngReader) tsResolution(opts []byte) uint64 {
+	for len(opts) >= 4 {
+		code := p.order.Uint16(opts[0:2])
+		length := int(p.order.Uint16(opts[2:4]))
+		if code == 0 || 4+length > len(opts) {
+			break
+		}
+		if code == 9 && length >= 1 {
+			// 最高位为 1 时表示 2 的负幂，否则为 10 的负幂
+			v := opts[4]
+			if v&0x80 != 0 {
+				if v&0x7f < 64 {
+					return 1 << (v & 0x7f)
+				}
+			} else if v <= 19 {
+				perSec := uint64(1)
+				for i := uint8(0); i < v; i++ {
+					perSec *= 10
+				}
+				return perSec
+			}
+			break
+		}
+		opts = opts[4+(length+3)&^3:]
+	}
+	return 1000000
+}
+
+// 按时间戳分辨率转换为时间
+func pcapngTime(ts, perSec uint64) time.Time {
+	sec, frac := ts/perSec, ts%perSec
+	var nsec uint64
+	if perSec <= 1e9 {
+		nsec = frac * 1e9 / perSec // frac < perSec，不会溢出
+	} else {
+		nsec = uint64(float64(frac) * 1e9 / float64(perSec))
+	}
+	return time.Unix(int64(sec), int64(nsec))
+}
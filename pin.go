@@ -0,0 +1,143 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// 默认的 bpffs 固定目录（docker-compose 已挂载 /sys/fs/bpf）
+const defaultPinPath = "/sys/fs/bpf/xtrace-catch"
+
+// 固定文件名
+const (
+	pinnedFlowsName = "flows" // flows map（PinByName 使用 map 名称）
+	pinnedLinkName  = "link"  // XDP link
+)
+
+// BPF map / link 固定配置（--pin、--pin-path）
+var (
+	pinEnabled bool
+	pinPath    = defaultPinPath
+)
+
+// 接口对应的固定目录：<pin-path>/<iface>
+func interfacePinDir(iface string) string {
+	if !pinEnabled {
+		return ""
+	}
+	return filepath.Join(pinPath, iface)
+}
+
+// 加载 eBPF 对象；启用固定时沿用已固定的 flows map（不兼容时删除后重新创建）
+// 返回 flows map 是否来自上一次运行
+func loadMonitorObjects(spec *ebpf.CollectionSpec, iface string, objs interface{}) (bool, error) {
+	dir := interfacePinDir(iface)
+	if dir == "" {
+		return false, spec.LoadAndAssign(objs, nil)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return false, fmt.Errorf("创建固定目录 %s 失败: %w", dir, err)
+	}
+	flowsSpec, ok := spec.Maps["flows"]
+	if !ok {
+		return false, fmt.Errorf("eBPF 规范中没有 flows map")
+	}
+	flowsSpec.Pinning = ebpf.PinByName
+
+	flowsPin := filepath.Join(dir, pinnedFlowsName)
+	_, statErr := os.Stat(flowsPin)
+	adopted := statErr == nil
+
+	opts := &ebpf.CollectionOptions{Maps: ebpf.MapOptions{PinPath: dir}}
+	err := spec.LoadAndAssign(objs, opts)
+	if adopted && errors.Is(err, ebpf.ErrMapIncompatible) {
+		// 升级后 map 结构变化，旧的计数无法沿用
+		log.Printf("[%s] 已固定的 flows map 与当前程序不兼容，删除后重新创建", iface)
+		if err := os.Remove(flowsPin); err != nil {
+			return false, fmt.Errorf("删除不兼容的 flows map 失败: %w", err)
+		}
+		adopted = false
+		err = spec.LoadAndAssign(objs, opts)
+	}
+	if err != nil {
+		return false, err
+	}
+	return adopted, nil
+}
+
+// 沿用已固定的 XDP link，并原子地替换为当前程序（升级无中断）
+// link 不存在、不是本接口或无法更新时返回 nil
+func adoptPinnedLink(iface string, ifindex int, prog *ebpf.Program) link.Link {
+	dir := interfacePinDir(iface)
+	if dir == "" {
+		return nil
+	}
+	pin := filepath.Join(dir, pinnedLinkName)
+	l, err := link.LoadPinnedLink(pin, nil)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[%s] 加载已固定的 XDP link 失败: %v，重新挂载", iface, err)
+			os.Remove(pin)
+		}
+		return nil
+	}
+
+	// 确认 link 仍挂载在本接口上（接口被重建后旧 link 已失效）
+	info, err := l.Info()
+	if err != nil || info.XDP() == nil || int(info.XDP().Ifindex) != ifindex {
+		log.Printf("[%s] 已固定的 XDP link 已失效，重新挂载", iface)
+		l.Unpin()
+		l.Close()
+		return nil
+	}
+	if err := l.Update(prog); err != nil {
+		log.Printf("[%s] 替换已固定 XDP link 的程序失败: %v，重新挂载", iface, err)
+		l.Unpin()
+		l.Close()
+		return nil
+	}
+	log.Printf("[%s] 沿用已固定的 XDP link: %s", iface, pin)
+	return l
+}
+
+// 固定新挂载的 XDP link（不支持 bpf_link 的内核上无法固定，仅打印警告）
+func pinLink(iface string, l link.Link) {
+	dir := interfacePinDir(iface)
+	if dir == "" {
+		return
+	}
+	if err := l.Pin(filepath.Join(dir, pinnedLinkName)); err != nil {
+		log.Printf("[%s] 警告: 固定 XDP link 失败: %v，重启后需要重新挂载", iface, err)
+	}
+}
+
+// 取消固定当前 link（link 失效或接口不再监控时）
+func unpinLink(iface string, l link.Link) {
+	if interfacePinDir(iface) == "" || l == nil {
+		return
+	}
+	if err := l.Unpin(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[%s] 取消固定 XDP link 失败: %v", iface, err)
+	}
+}
+
+// 删除接口的全部固定对象（接口被删除或改名后不再监控）
+func removeInterfacePins(iface string) {
+	dir := interfacePinDir(iface)
+	if dir == "" {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("[%s] 删除固定目录 %s 失败: %v", iface, dir, err)
+	}
+}
@@ -0,0 +1,301 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// 采集流水线：
+//
+//	调度器（对齐的采集时刻） -> 各接口监控 goroutine（读取 map，生成接口快照）
+//	  -> collectEpoch（按周期合并快照） -> 导出 goroutine（输出、metrics、推送）
+//
+// 快照在发送后不再修改，Prometheus Gauge 的 Set 和 Reset 只在导出 goroutine 中执行。
+
+// 一个接口在一个采集周期的快照（发送给协调器后不再修改）
+type ifaceSnapshot struct {
+	Interface string
+	Epoch     time.Time
+	Flows     []FlowSample // 通过过滤条件的流
+	NICs      NICRates     // 按 IP 对聚合的速率
+	Resets    int          // 检测到的流计数器重置次数
+	Burst     *burstSample // 微突发统计（未启用 --burst-slot 时为 nil）
+
+	// 采集自身的统计（xtrace_agent_*）
+	MapEntries      int
+	MapCapacity     int
+	Iteration       time.Duration
+	UnparsedPackets uint64
+	UnparsedBytes   uint64
+}
+
+// 一个采集周期所有接口合并后的快照
+type epochSnapshot struct {
+	Epoch      time.Time
+	Interfaces []ifaceSnapshot // 按接口名排序
+}
+
+// 本周期所有接口的流样本
+func (e *epochSnapshot) flowSamples() []FlowSample {
+	var flows []FlowSample
+	for _, s := range e.Interfaces {
+		flows = append(flows, s.Flows...)
+	}
+	return flows
+}
+
+// 本周期所有接口的 NIC 样本
+func (e *epochSnapshot) nicSamples() []NICSample {
+	var nics []NICSample
+	for _, s := range e.Interfaces {
+		for key, rate := range s.NICs {
+			nics = append(nics, NICSample{
+				Interface: s.Interface,
+				Key:       key,
+				Rate:      rate,
+				Timestamp: s.Epoch,
+			})
+		}
+	}
+	return nics
+}
+
+// 采集请求：接口的监控 goroutine 读取本周期数据后把快照发送到 reply
+type collectTick struct {
+	epoch time.Time
+	reply chan ifaceSnapshot // 容量为 1，回复不会阻塞；超时后的回复随请求一起丢弃
+}
+
+// sentSnapshot 接口监控 goroutine 发给协调器的快照，以及生成快照之前的采集状态
+// 协调器超时后不再读取回复，快照留在回复 channel 中；监控 goroutine 在下一次采集时收回快照并回退状态，
+// 下一周期的增量因此覆盖两个周期，超时周期的流量不会丢失
+type sentSnapshot struct {
+	reply       chan ifaceSnapshot
+	lastStats   map[FlowKey]FlowStats // 生成快照之前的上一周期累计值（collectFlows 不修改传入的 map）
+	collectTime time.Time             // 生成快照之前的上一次采集时间
+	windowStart uint64                // 生成快照之前的上一次采集时钟
+}
+
+// 收回没有被协调器取走的快照（只能在收到下一个采集请求后调用，此时协调器已不再等待该回复）
+func (s *sentSnapshot) reclaim() (ifaceSnapshot, bool) {
+	if s.reply == nil {
+		return ifaceSnapshot{}, false
+	}
+	select {
+	case snap := <-s.reply:
+		return snap, true
+	default:
+		return ifaceSnapshot{}, false
+	}
+}
+
+// 向各接口发送本周期的采集请求，合并按时返回的快照（最长等待 timeout）
+// 每个请求使用独立的回复 channel，超时后迟到的快照不会混入之后的周期
+func collectEpoch(sources []*ifaceMonitor, epoch time.Time, timeout time.Duration) epochSnapshot {
+	type pending struct {
+		mon   *ifaceMonitor
+		reply chan ifaceSnapshot
+	}
+	var waiting []pending
+	for _, mon := range sources {
+		reply := make(chan ifaceSnapshot, 1)
+		select {
+		case mon.ticks <- collectTick{epoch: epoch, reply: reply}:
+			waiting = append(waiting, pending{mon, reply})
+		default:
+			// 上一个采集请求还没有被处理
+			log.Printf("[%s] 警告: 上一周期的采集尚未完成，跳过本周期", mon.name)
+			observeCollectSignalDropped(mon.name)
+		}
+	}
+
+	snap := epochSnapshot{Epoch: epoch}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+wait:
+	for i, p := range waiting {
+		select {
+		case s := <-p.reply:
+			snap.Interfaces = append(snap.Interfaces, s)
+		case <-p.mon.done: // 监控已停止
+		case <-timer.C:
+			log.Printf("警告: %d 个接口未在 %v 内完成采集，本周期只导出已完成的接口（其流量计入下一周期）", len(waiting)-i, timeout)
+			break wait
+		}
+	}
+
+	sort.Slice(snap.Interfaces, func(i, j int) bool {
+		return snap.Interfaces[i].Interface < snap.Interfaces[j].Interface
+	})
+	return snap
+}
+
+// 导出 goroutine：按顺序处理合并后的周期快照，直到 stop 关闭
+func runExporters(epochs <-chan epochSnapshot, stop <-chan struct{}, hostIP string) {
+	for {
+		select {
+		case snap := <-epochs:
+			exportEpoch(snap, hostIP)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 导出一个周期时使用的可热加载设置
+type exportSettings struct {
+	Output      string
+	TopFlows    int
+	FlowMetrics bool
+}
+
+// 复制当前的导出设置（导出和推送期间不持有 settingsMu，慢推送不会阻塞 SIGHUP、调度器和各接口的采集）
+func currentExportSettings() exportSettings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return exportSettings{
+		Output:      outputFormat,
+		TopFlows:    topFlows,
+		FlowMetrics: flowMetricsEnabled,
+	}
+}
+
+// 输出一个周期的快照：标准输出 / 终端界面、程序自身指标，以及所有已启用的导出器
+func exportEpoch(snap epochSnapshot, hostIP string) {
+	settings := currentExportSettings()
+
+	for _, s := range snap.Interfaces {
+		observeCollect(s.Interface, s.MapEntries, s.MapCapacity, len(s.Flows), s.Iteration, s.UnparsedPackets, s.UnparsedBytes)
+		if s.Resets > 0 && flowCounterResets != nil {
+			collectAggMu.RLock()
+			flowCounterResets.WithLabelValues(s.Interface, hostIP, collectAgg).Add(float64(s.Resets))
+			collectAggMu.RUnlock()
+		}
+
+		// 刷新终端界面，或逐条输出有实际流量的记录（跳过增量为0的）
+		if tuiEnabled {
+			tuiState.update(s.Interface, s.Flows)
+			continue
+		}
+		if conversationMode != "" {
+			// 合并两个方向后按会话输出
+			for _, c := range mergeConversations(conversationMode, s.Flows) {
+				if c.PacketsAToB+c.PacketsBToA > 0 {
+					printConversation(c, hostIP, settings.Output)
+				}
+			}
+			continue
+		}
+		for _, sample := range s.Flows {
+			if sample.DeltaPackets > 0 {
+				printFlow(sample, hostIP, settings.Output)
+			}
+		}
+	}
+
+	// 新判定的大象流写入日志
+	logElephants(snap)
+
+	// 流生命周期事件（--flow-events）
+	if flowEventsEnabled {
+		emitFlowEvents(snap, hostIP)
+	}
+
+	if metricsEnabled {
+		for _, s := range snap.Interfaces {
+			// 流级别 metrics（启用 --top-flows 时只导出 Top-N + 剩余汇总）
+			if settings.FlowMetrics {
+				for _, sample := range topFlowSamples(s.Flows, settings.TopFlows) {
+					sample.UpdateMetrics(hostIP)
+				}
+			}
+
+			// 大象流（不受 --top-flows / --flow-metrics 限制）
+			for i := range s.Flows {
+				if s.Flows[i].Elephant {
+					s.Flows[i].UpdateElephantMetric(hostIP)
+				}
+			}
+
+			// 自定义聚合层级（基于同一批增量）
+			for _, agg := range aggregateFlows(aggLevels, s.Flows) {
+				agg.UpdateMetrics(hostIP)
+			}
+
+			// 双向会话 metrics（--conversations）
+			for _, c := range mergeConversations(conversationMode, s.Flows) {
+				c.UpdateMetrics(hostIP)
+			}
+
+			// NIC 速率 metrics（累加后的结果）
+			s.NICs.UpdateMetrics(s.Interface, hostIP)
+
+			// 微突发 metrics（--burst-slot）
+			if s.Burst != nil && interfacePeakRate != nil {
+				s.Burst.UpdateMetrics(s.Interface, hostIP)
+			}
+		}
+
+		var ts time.Time
+		if vmSampleTimestamps {
+			ts = snap.Epoch
+		}
+		err := observePush(exporterVictoriaMetrics, func() error {
+			return pushMetricsToVictoriaMetrics(ts)
+		})
+		if err != nil {
+			log.Printf("推送 VictoriaMetrics metrics 失败: %v", err)
+		}
+
+		// 推送后重置 Gauge，避免旧值残留
+		networkFlowBytesRate.Reset()
+		networkFlowBitsRate.Reset()
+		networkNICBytesRate.Reset()
+		networkNICBitsRate.Reset()
+		resetAggregationMetrics()
+		resetConversationMetrics()
+		resetElephantMetrics()
+		resetBurstMetrics()
+	}
+
+	if !otlpEnabled && !influxEnabled && !ipfixEnabled {
+		return
+	}
+	flows, nics := snap.flowSamples(), snap.nicSamples()
+
+	// 时间序列类导出器受 --top-flows / --flow-metrics 限制，流记录类导出器（IPFIX）使用全部流
+	var seriesFlows []FlowSample
+	if settings.FlowMetrics {
+		seriesFlows = topFlowSamples(flows, settings.TopFlows)
+	}
+	aggs := aggregateFlows(aggLevels, flows)
+
+	if otlpEnabled {
+		err := observePush(exporterOTLP, func() error {
+			return pushMetricsToOTLP(seriesFlows, nics, aggs, hostIP)
+		})
+		if err != nil {
+			log.Printf("推送 OTLP metrics 失败: %v", err)
+		}
+	}
+	if influxEnabled {
+		err := observePush(exporterInfluxDB, func() error {
+			return pushMetricsToInflux(seriesFlows, nics, aggs, hostIP)
+		})
+		if err != nil {
+			log.Printf("推送 InfluxDB line protocol 失败: %v", err)
+		}
+	}
+	if ipfixEnabled {
+		err := observePush(exporterIPFIX, func() error {
+			return pushFlowsToIPFIX(flows, snap.Epoch)
+		})
+		if err != nil {
+			log.Printf("推送 IPFIX/NetFlow 流记录失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 内存中的 flows map，由模拟内核的 goroutine 并发更新
+type fakeFlowMap struct {
+	mu    sync.Mutex
+	flows map[FlowKey]FlowStats
+}
+
+func newFakeFlowMap() *fakeFlowMap {
+	return &fakeFlowMap{flows: make(map[FlowKey]FlowStats)}
+}
+
+// 模拟 XDP 程序记录一个数据包
+func (m *fakeFlowMap) record(k FlowKey, bytes uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.flows[k]
+	if !ok {
+		v.FirstSeen = 1
+	}
+	v.Packets++
+	v.Bytes += bytes
+	v.LastUpdate = 2
+	m.flows[k] = v
+}
+
+func (m *fakeFlowMap) read() map[FlowKey]FlowStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[FlowKey]FlowStats, len(m.flows))
+	for k, v := range m.flows {
+		out[k] = v
+	}
+	return out
+}
+
+func (m *fakeFlowMap) totalBytes() uint64 {
+	var total uint64
+	for _, v := range m.read() {
+		total += v.Bytes
+	}
+	return total
+}
+
+// 模拟一个接口的监控 goroutine：收到采集请求后读取 fake map，按增量生成快照
+// 与 monitorInterface 相同，上一周期的快照未被取走时回退 lastStats；delay 模拟读取 map 的耗时
+func startFakeSource(name string, m *fakeFlowMap, delay time.Duration) *ifaceMonitor {
+	mon := &ifaceMonitor{
+		name:  name,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		ticks: make(chan collectTick, 1),
+	}
+	go func() {
+		defer close(mon.done)
+		lastStats := make(map[FlowKey]FlowStats)
+		var sent sentSnapshot
+		for {
+			select {
+			case tick := <-mon.ticks:
+				if _, ok := sent.reclaim(); ok {
+					lastStats = sent.lastStats
+				}
+				sent = sentSnapshot{reply: tick.reply, lastStats: lastStats}
+				time.Sleep(delay)
+				var snap ifaceSnapshot
+				snap, lastStats = collectFlows(name, m.read(), lastStats, collectOptions{
+					Interval: 1,
+					Epoch:    tick.epoch,
+					NICRates: true,
+				})
+				tick.reply <- snap
+			case <-mon.stop:
+				return
+			}
+		}
+	}()
+	return mon
+}
+
+// 模拟内核持续向 map 写入，直到 stop 关闭
+func runFakeKernel(m *fakeFlowMap, flows int, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		k := FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: uint16(i % flows), DstPort: 0xb712, Proto: 17}
+		m.record(k, 100)
+		if i%64 == 0 {
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+}
+
+func TestCollectEpochMergesAllSources(t *testing.T) {
+	names := []string{"ib2", "ib0", "ib1"}
+	maps := make(map[string]*fakeFlowMap)
+	var sources []*ifaceMonitor
+	for _, name := range names {
+		maps[name] = newFakeFlowMap()
+		sources = append(sources, startFakeSource(name, maps[name], 0))
+	}
+	defer func() {
+		for _, mon := range sources {
+			close(mon.stop)
+			<-mon.done
+		}
+	}()
+
+	kernelStop := make(chan struct{})
+	var kernel sync.WaitGroup
+	for _, name := range names {
+		kernel.Add(1)
+		go runFakeKernel(maps[name], 8, kernelStop, &kernel)
+	}
+
+	reported := make(map[string]uint64)
+	epoch := time.Unix(1700000000, 0)
+	collect := func() {
+		snap := collectEpoch(sources, epoch, time.Second)
+		if len(snap.Interfaces) != len(names) {
+			t.Fatalf("epoch %v: %d interfaces, want %d", epoch, len(snap.Interfaces), len(names))
+		}
+		for i, s := range snap.Interfaces {
+			if i > 0 && snap.Interfaces[i-1].Interface >= s.Interface {
+				t.Errorf("interfaces not sorted: %s before %s", snap.Interfaces[i-1].Interface, s.Interface)
+			}
+			if !s.Epoch.Equal(epoch) {
+				t.Errorf("%s: snapshot epoch %v merged into %v", s.Interface, s.Epoch, epoch)
+			}
+			for _, f := range s.Flows {
+				reported[s.Interface] += f.DeltaBytes
+			}
+		}
+		epoch = epoch.Add(5 * time.Second)
+	}
+
+	for i := 0; i < 20; i++ {
+		collect()
+		time.Sleep(time.Millisecond)
+	}
+	close(kernelStop)
+	kernel.Wait()
+	collect()
+
+	// 所有周期的增量之和等于内核中的累计值，说明没有快照被重复合并或丢失
+	for _, name := range names {
+		if got, want := reported[name], maps[name].totalBytes(); got != want {
+			t.Errorf("%s: sum of deltas = %d, want %d", name, got, want)
+		}
+	}
+}
+
+// 超时的快照不会混入之后的周期，其流量由监控 goroutine 计入下一个按时返回的快照
+func TestCollectEpochCarriesLateSnapshots(t *testing.T) {
+	maps := map[string]*fakeFlowMap{"ib0": newFakeFlowMap(), "ib1": newFakeFlowMap()}
+	fast := startFakeSource("ib0", maps["ib0"], 0)
+	slow := startFakeSource("ib1", maps["ib1"], 150*time.Millisecond)
+	sources := []*ifaceMonitor{fast, slow}
+	defer func() {
+		for _, mon := range sources {
+			close(mon.stop)
+			<-mon.done
+		}
+	}()
+
+	stop := make(chan struct{})
+	var kernel sync.WaitGroup
+	for _, m := range maps {
+		kernel.Add(1)
+		go runFakeKernel(m, 4, stop, &kernel)
+	}
+
+	reported := make(map[string]uint64)
+	merge := func(snap epochSnapshot, epoch time.Time) map[string]bool {
+		seen := make(map[string]bool)
+		for _, s := range snap.Interfaces {
+			if !s.Epoch.Equal(epoch) {
+				t.Fatalf("%s: late snapshot of %v merged into %v", s.Interface, s.Epoch, epoch)
+			}
+			seen[s.Interface] = true
+			for _, f := range s.Flows {
+				reported[s.Interface] += f.DeltaBytes
+			}
+		}
+		return seen
+	}
+
+	epoch := time.Unix(1700000000, 0)
+	for i := 0; i < 6; i++ {
+		// 慢接口在一半的周期中超时
+		timeout := 40 * time.Millisecond
+		if i%2 == 1 {
+			timeout = time.Second
+		}
+		if seen := merge(collectEpoch(sources, epoch, timeout), epoch); !seen["ib0"] {
+			t.Errorf("epoch %v: fast source missing", epoch)
+		}
+		epoch = epoch.Add(5 * time.Second)
+	}
+
+	// 停止写入后再采集一次，所有流量都应已导出
+	close(stop)
+	kernel.Wait()
+	merge(collectEpoch(sources, epoch, time.Second), epoch)
+	for name, m := range maps {
+		if got, want := reported[name], m.totalBytes(); got != want {
+			t.Errorf("%s: sum of deltas = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestCollectEpochStoppedSource(t *testing.T) {
+	running := startFakeSource("ib0", newFakeFlowMap(), 0)
+	defer func() {
+		close(running.stop)
+		<-running.done
+	}()
+
+	// 已停止的监控不会处理采集请求，协调器不应等到超时
+	stopped := &ifaceMonitor{
+		name:  "ib1",
+		done:  make(chan struct{}),
+		ticks: make(chan collectTick, 1),
+	}
+	close(stopped.done)
+
+	start := time.Now()
+	snap := collectEpoch([]*ifaceMonitor{running, stopped}, time.Unix(1700000000, 0), 5*time.Second)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("collectEpoch waited %v for a stopped source", elapsed)
+	}
+	if len(snap.Interfaces) != 1 || snap.Interfaces[0].Interface != "ib0" {
+		t.Errorf("interfaces = %+v, want only ib0", snap.Interfaces)
+	}
+}
+
+var initVMOnce sync.Once
+
+// 调度器、协调器和导出器一起运行，模拟 SIGHUP 并发修改运行时设置：
+// 每次推送都必须包含所有接口，且 Gauge 的 Set / Reset 不与采集并发
+func TestPipelinePushesCoherentEpochs(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	initVMOnce.Do(func() { initVictoriaMetrics(srv.URL + "/api/v1/import/prometheus") })
+	vmRemoteWriteURL = srv.URL + "/api/v1/import/prometheus"
+
+	settingsMu.Lock()
+	oldMetrics, oldTUI, oldInterval := metricsEnabled, tuiEnabled, collectIntervalMs
+	metricsEnabled = true
+	tuiEnabled = true // 不在测试输出中打印流记录
+	collectIntervalMs = 20
+	settingsMu.Unlock()
+	defer func() {
+		settingsMu.Lock()
+		metricsEnabled, tuiEnabled, collectIntervalMs = oldMetrics, oldTUI, oldInterval
+		settingsMu.Unlock()
+	}()
+
+	names := []string{"ib0", "ib1", "ib2"}
+	stop := make(chan struct{})
+	var kernel sync.WaitGroup
+	var sources []*ifaceMonitor
+	for _, name := range names {
+		m := newFakeFlowMap()
+		sources = append(sources, startFakeSource(name, m, time.Duration(len(sources))*time.Millisecond))
+		kernel.Add(1)
+		go runFakeKernel(m, 4, stop, &kernel)
+	}
+
+	epochs := make(chan epochSnapshot, 1)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		runScheduler(func() []*ifaceMonitor { return sources }, stop, epochs)
+	}()
+	go func() {
+		defer wg.Done()
+		runExporters(epochs, stop, "192.0.2.10")
+	}()
+	go func() {
+		// 模拟 SIGHUP 热加载
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(7 * time.Millisecond):
+			}
+			settingsMu.Lock()
+			topFlows = i % 3
+			flowMetricsEnabled = i%4 != 0
+			settingsMu.Unlock()
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(bodies)
+		mu.Unlock()
+		if n >= 10 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+	kernel.Wait()
+	for _, mon := range sources {
+		close(mon.stop)
+		<-mon.done
+	}
+	settingsMu.Lock()
+	topFlows, flowMetricsEnabled = 0, true
+	settingsMu.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) < 10 {
+		t.Fatalf("got %d pushes, want at least 10", len(bodies))
+	}
+	for i, body := range bodies {
+		for _, name := range names {
+			if !strings.Contains(body, fmt.Sprintf(`xtrace_network_nic_bytes_rate{collect_agg=%q`, collectAgg)) ||
+				!strings.Contains(body, fmt.Sprintf(`interface=%q`, name)) {
+				t.Errorf("push %d is missing interface %s", i, name)
+			}
+		}
+	}
+}
+
+// 推送阻塞期间热加载仍能获取 settingsMu 写锁（采集和调度器不会被慢推送拖住）
+func TestSlowPushDoesNotBlockReload(t *testing.T) {
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	initVMOnce.Do(func() { initVictoriaMetrics(srv.URL + "/api/v1/import/prometheus") })
+	vmRemoteWriteURL = srv.URL + "/api/v1/import/prometheus"
+
+	settingsMu.Lock()
+	oldMetrics, oldTUI := metricsEnabled, tuiEnabled
+	metricsEnabled, tuiEnabled = true, true
+	settingsMu.Unlock()
+	defer func() {
+		settingsMu.Lock()
+		metricsEnabled, tuiEnabled = oldMetrics, oldTUI
+		settingsMu.Unlock()
+	}()
+
+	exported := make(chan struct{})
+	go func() {
+		defer close(exported)
+		exportEpoch(epochSnapshot{Epoch: time.Unix(1700000000, 0), Interfaces: []ifaceSnapshot{{Interface: "ib0"}}}, "192.0.2.10")
+	}()
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push not received")
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		settingsMu.Lock()
+		topFlows = 0
+		settingsMu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("settingsMu writer blocked behind a slow push")
+	}
+	release <- struct{}{}
+	<-exported
+}
@@ -0,0 +1,247 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 回放模式的默认采集间隔（抓包文件通常只有几十秒）
+const defaultReplayIntervalMs = 1000
+
+// replay 子命令：按 xdp_monitor.c 的解析规则离线回放 pcap / pcapng 文件，
+// 以数据包时间切分采集周期，输出与在线监控相同的标准输出、JSON 和各导出器数据
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var pcapPath string
+	var ifaceLabel string
+	var hostIP string
+	var filterTraffic string
+	var excludeDNS bool
+	var intervalMs int
+	var output string
+	var topFlowsN int
+	var aggregates stringListFlag
+	var flowMetrics bool
+	var conversations string
+	var flowEventsOut string
+	var flowIdleTimeoutMs int
+	var elephantRateMbps int
+	var elephantShare float64
+	var elephantTicks int
+	var linkSpeedMbps int
+	var burstSlotUs int
+
+	fs.StringVar(&pcapPath, "pcap", "", "要回放的抓包文件（pcap 或 pcapng）")
+	fs.StringVar(&configPath, "c", "", "配置文件路径（.yaml/.yml/.toml），用于导出器和标签设置")
+	fs.StringVar(&configPath, "config", "", "配置文件路径（.yaml/.yml/.toml），用于导出器和标签设置")
+	fs.StringVar(&ifaceLabel, "i", "", "输出和指标中使用的接口名（默认: 文件名）")
+	fs.StringVar(&ifaceLabel, "interface", "", "输出和指标中使用的接口名（默认: 文件名）")
+	fs.StringVar(&hostIP, "host-ip", "", "输出和指标中使用的 host_ip（默认: 本机 IP）")
+	fs.StringVar(&filterTraffic, "f", "", "过滤流量类型: roce, roce_v1, roce_v2, tcp, udp, ib, all")
+	fs.StringVar(&filterTraffic, "filter", "", "过滤流量类型: roce, roce_v1, roce_v2, tcp, udp, ib, all")
+	fs.BoolVar(&excludeDNS, "exclude-dns", false, "排除DNS流量（过滤常见DNS服务器）")
+	fs.IntVar(&intervalMs, "t", defaultReplayIntervalMs, "采集周期（毫秒，按数据包时间）")
+	fs.IntVar(&intervalMs, "interval", defaultReplayIntervalMs, "采集周期（毫秒，按数据包时间）")
+	fs.StringVar(&output, "o", outputText, "标准输出格式: text, json, csv")
+	fs.StringVar(&output, "output", outputText, "标准输出格式: text, json, csv")
+	fs.IntVar(&topFlowsN, "top-flows", 0, "每个周期只导出字节数最多的 N 个流，其余按流量类型汇总为 other（0 表示不限制）")
+	fs.Var(&aggregates, "aggregate", "额外的聚合层级，可重复指定 (例如: src_ip,dst_ip 或 rack=src_subnet/24,dst_subnet/24)")
+	fs.BoolVar(&flowMetrics, "flow-metrics", true, "导出五元组级别的流指标（false 时只导出 NIC 和聚合层级指标）")
+	fs.StringVar(&flowEventsOut, "flow-events", "", "输出流开始 / 结束事件: stdout、文件路径或 http(s):// webhook")
+	fs.IntVar(&flowIdleTimeoutMs, "flow-idle-timeout", defaultFlowIdleTimeoutMs, "流超过该时间（毫秒，按数据包时间）没有新数据包时视为结束")
+	fs.IntVar(&elephantRateMbps, "elephant-rate", 0, "大象流速率阈值（Mbit/s），0 表示不按速率判定")
+	fs.Float64Var(&elephantShare, "elephant-share", 0, "大象流占接口带宽的百分比阈值（0-100），0 表示不按占比判定")
+	fs.IntVar(&elephantTicks, "elephant-ticks", defaultElephantTicks, "连续超过阈值多少个采集周期后判定为大象流")
+	fs.IntVar(&linkSpeedMbps, "link-speed", 0, "大象流占比使用的接口带宽（Mbit/s），回放时不设置则不按占比判定")
+	fs.IntVar(&burstSlotUs, "burst-slot", 0, "微突发统计的时间片长度（微秒，按数据包时间），0 表示关闭")
+	fs.StringVar(&conversations, "conversations", "", "合并两个方向的流为会话输出，并导出 xtrace_conversation_* 指标: ip（按 IP 对）, port（按五元组）")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "XTrace-Catch: 离线回放抓包文件\n\n")
+		fmt.Fprintf(os.Stderr, "用法: %s replay --pcap FILE [选项]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "选项:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\n数据包按 xdp_monitor.c 的规则解析（含 L2 头的完整包长），速率按数据包时间计算。\n")
+		fmt.Fprintf(os.Stderr, "采集周期按数据包时间对齐到间隔的整数倍，没有数据包的周期被跳过。\n")
+		fmt.Fprintf(os.Stderr, "导出器通过配置文件或环境变量启用，推送到 VictoriaMetrics 的样本使用周期时刻作为时间戳。\n")
+		fmt.Fprintf(os.Stderr, "\n示例:\n")
+		fmt.Fprintf(os.Stderr, "  %s replay --pcap job.pcapng                      # 逐周期打印流量\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s replay --pcap job.pcap -f roce_v2 -o json      # 只看 RoCE v2，输出 JSON\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  VICTORIAMETRICS_ENABLED=true %s replay --pcap job.pcap -i ib0  # 写入 VictoriaMetrics\n", os.Args[0])
+	}
+	fs.Parse(args)
+
+	if pcapPath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if ifaceLabel == "" {
+		base := filepath.Base(pcapPath)
+		ifaceLabel = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	// 复用在线监控的配置组装和校验：命令行参数 > 环境变量 > 配置文件 > 默认值
+	setFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	applyFlagOverrides = func(cfg *Config) {
+		// 回放不挂载接口，也不提供健康检查和终端界面
+		cfg.Interfaces = []string{ifaceLabel}
+		cfg.OnAttachError = attachErrorSkip
+		cfg.TUI = false
+		cfg.Pin = false
+		cfg.Health.Listen = ""
+		cfg.Health.Pprof = false
+		cfg.IntervalMs = intervalMs // 配置文件中的采集间隔针对在线监控，不用于回放
+		if setFlags["f"] || setFlags["filter"] {
+			cfg.Filter = filterTraffic
+		}
+		if setFlags["exclude-dns"] {
+			cfg.ExcludeDNS = excludeDNS
+		}
+		if setFlags["o"] || setFlags["output"] {
+			cfg.Output = output
+		}
+		if setFlags["top-flows"] {
+			cfg.TopFlows = topFlowsN
+		}
+		if setFlags["flow-metrics"] {
+			cfg.FlowMetrics = flowMetrics
+		}
+		if setFlags["aggregate"] {
+			cfg.Aggregate = aggregates
+		}
+		if setFlags["conversations"] {
+			cfg.Conversations = conversations
+		}
+		if setFlags["flow-events"] {
+			cfg.FlowEvents.Target = flowEventsOut
+		}
+		if setFlags["flow-idle-timeout"] {
+			cfg.FlowEvents.IdleTimeoutMs = flowIdleTimeoutMs
+		}
+		if setFlags["elephant-rate"] {
+			cfg.Elephant.RateMbps = elephantRateMbps
+		}
+		if setFlags["elephant-share"] {
+			cfg.Elephant.LinkSharePercent = elephantShare
+		}
+		if setFlags["elephant-ticks"] {
+			cfg.Elephant.Ticks = elephantTicks
+		}
+		if setFlags["link-speed"] {
+			cfg.Elephant.LinkSpeedMbps = linkSpeedMbps
+		}
+		if setFlags["burst-slot"] {
+			cfg.BurstSlotUs = burstSlotUs
+		}
+	}
+	cfg, err := buildConfig()
+	if err != nil {
+		log.Fatalf("配置无效: %v", err)
+	}
+
+	f, err := os.Open(pcapPath)
+	if err != nil {
+		log.Fatalf("打开抓包文件失败: %v", err)
+	}
+	defer f.Close()
+	src, err := newPcapSource(f)
+	if err != nil {
+		log.Fatalf("读取抓包文件失败: %v", err)
+	}
+
+	applyStartupConfig(cfg)
+	vmSampleTimestamps = true
+	if burstSlot > 0 {
+		src.bursts = newBurstCounter(burstSlot)
+	}
+	if hostIP == "" {
+		hostIP = getHostIP()
+	}
+	agentHostIP = hostIP
+	setAgentBuildInfo()
+
+	interval := time.Duration(cfg.IntervalMs) * time.Millisecond
+	log.Printf("回放 %s，接口: %s，采集周期: %v", pcapPath, ifaceLabel, interval)
+
+	start := time.Now()
+	epochs, first, last, err := replayPcap(src, ifaceLabel, interval, hostIP)
+	closeOTLPExporter()
+	closeIPFIXExporter()
+	// 仍在活动的流在最后一个采集周期结束
+	closeFlowEvents(nextAlignedTick(last.Add(-time.Nanosecond), interval), flowEndEndOfCapture, hostIP)
+	if err != nil {
+		log.Fatalf("回放中断（已回放 %d 个数据包）: %v", src.packets, err)
+	}
+	if epochs == 0 {
+		log.Printf("抓包文件中没有数据包")
+		return
+	}
+	log.Printf("回放完成: %d 个数据包，%d 个采集周期，数据包时间 %s - %s，耗时 %v",
+		src.packets, epochs, first.Format(time.RFC3339Nano), last.Format(time.RFC3339Nano),
+		time.Since(start).Round(time.Millisecond))
+}
+
+// 按数据包时间把抓包文件切分为对齐的采集周期 (epoch-interval, epoch]，逐个周期生成快照并导出
+// 返回导出的周期数，以及第一个和最后一个数据包的时间
+func replayPcap(src *pcapSource, iface string, interval time.Duration, hostIP string) (epochs int, first, last time.Time, err error) {
+	next, ok, err := src.nextTimestamp()
+	if err != nil || !ok {
+		return 0, first, last, err
+	}
+	first = next
+	// NetFlow v9 的 sysUptime 从第一个采集周期开始计算
+	setIPFIXUptimeBase(nextAlignedTick(first.Add(-time.Nanosecond), interval).Add(-interval))
+
+	lastStats := make(map[FlowKey]FlowStats)
+	elephants := newElephantTracker()
+	for ok {
+		// 包含恰好落在对齐时刻上的数据包
+		epoch := nextAlignedTick(next.Add(-time.Nanosecond), interval)
+		if err := src.advance(epoch); err != nil {
+			return epochs, first, last, err
+		}
+		last = src.lastPacket
+
+		flows, _ := src.Snapshot()
+		settingsMu.RLock()
+		opts := collectOptions{
+			Filter:      trafficFilter,
+			ExcludeDNS:  excludeDNSTraffic,
+			WindowStart: uint64(epoch.Add(-interval).UnixNano()),
+			Interval:    interval.Seconds(),
+			Epoch:       epoch,
+			NICRates:    pushEnabled(),
+			Elephant:    elephantSettings,
+			Elephants:   elephants,
+		}
+		settingsMu.RUnlock()
+		// 回放时没有对应的接口，只使用配置的接口带宽
+		if opts.Elephant.LinkSpeedMbps > 0 {
+			opts.LinkBytesPerSec = linkBytesPerSec(iface, opts.Elephant.LinkSpeedMbps)
+		}
+
+		var snap ifaceSnapshot
+		snap, lastStats = collectFlows(iface, flows, lastStats, opts)
+		if src.bursts != nil {
+			b, _ := src.bursts.ReadBurst()
+			snap.Burst = &b
+		}
+		exportEpoch(epochSnapshot{Epoch: epoch, Interfaces: []ifaceSnapshot{snap}}, hostIP)
+		epochs++
+
+		// 下一个数据包所在的周期（跳过没有数据包的周期）
+		if next, ok, err = src.nextTimestamp(); err != nil {
+			return epochs, first, last, err
+		}
+	}
+	return epochs, first, last, nil
+}
@@ -0,0 +1,129 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// FlowSample 单个流在一个采集周期内的测量结果（供各导出器和输出模式使用）
+type FlowSample struct {
+	Interface     string
+	Key           FlowKey
+	Stats         FlowStats // 本次读取到的累计值
+	SrcPort       uint16    // 主机字节序
+	DstPort       uint16    // 主机字节序
+	TrafficType   string
+	DeltaPackets  uint64
+	DeltaBytes    uint64
+	BytesPerSec   float64
+	BitsPerSec    float64
+	LinkShare     float64   // 速率占接口带宽的比例（带宽未知时为 0）
+	ElephantTicks int       // 连续超过大象流阈值的周期数
+	Elephant      bool      // 已连续 Ticks 个周期超过阈值
+	NewElephant   bool      // 本周期刚判定为大象流
+	FirstSeen     time.Time // 内核条目的创建时间（挂钟时间，未知时为零值）
+	LastSeen      time.Time // 最后一个数据包的时间（LastUpdate）
+	Interval      float64   // 本次采集的实际间隔（秒）
+	Timestamp     time.Time // 采集时间
+	Remainder     bool      // Top-N 之外的剩余流量汇总（地址和端口无意义）
+}
+
+// NICSample 单个 NIC 聚合项在一个采集周期内的速率
+type NICSample struct {
+	Interface string
+	Key       NICKey
+	Rate      NICRate
+	Timestamp time.Time
+}
+
+// Top-N 之外的剩余流量在地址、端口标签上使用的值
+const otherFlowLabel = "other"
+
+// 每个接口导出的流数量上限（--top-flows，0 表示不限制）
+var topFlows int
+
+// EndpointLabels 返回流级别标签中的地址和端口（剩余流量汇总为 "other"）
+func (s *FlowSample) EndpointLabels() (srcIP, dstIP, srcPort, dstPort string) {
+	if s.Remainder {
+		return otherFlowLabel, otherFlowLabel, otherFlowLabel, otherFlowLabel
+	}
+	return ipToStr(s.Key.SrcIP), ipToStr(s.Key.DstIP),
+		strconv.Itoa(int(s.SrcPort)), strconv.Itoa(int(s.DstPort))
+}
+
+// 剩余流量按协议和流量类型汇总
+type remainderKey struct {
+	iface       string
+	proto       uint8
+	trafficType string
+}
+
+// topFlowSamples 每个接口只保留本周期字节数最多的 n 个流，
+// 其余流量按流量类型汇总为一条 Remainder 样本，保证流级别之和与 NIC 总量一致。
+// 字节数相同时按包数、再按 FlowKey 排序（样本来自 map 遍历，否则入选的流每个周期都可能变化）。
+// n <= 0 时不做限制。
+func topFlowSamples(samples []FlowSample, n int) []FlowSample {
+	if n <= 0 {
+		return samples
+	}
+
+	byIface := make(map[string][]FlowSample)
+	var ifaces []string
+	for _, s := range samples {
+		if _, ok := byIface[s.Interface]; !ok {
+			ifaces = append(ifaces, s.Interface)
+		}
+		byIface[s.Interface] = append(byIface[s.Interface], s)
+	}
+
+	result := make([]FlowSample, 0, len(ifaces)*(n+1))
+	for _, iface := range ifaces {
+		flows := byIface[iface]
+		if len(flows) <= n {
+			result = append(result, flows...)
+			continue
+		}
+
+		slices.SortFunc(flows, func(a, b FlowSample) int {
+			return cmp.Or(
+				cmp.Compare(b.DeltaBytes, a.DeltaBytes),
+				cmp.Compare(b.DeltaPackets, a.DeltaPackets),
+				compareFlowKey(a.Key, b.Key),
+			)
+		})
+		result = append(result, flows[:n]...)
+
+		// 剩余流量汇总（保持首次出现的顺序，输出稳定）
+		others := make(map[remainderKey]*FlowSample)
+		var order []remainderKey
+		for _, s := range flows[n:] {
+			key := remainderKey{iface: iface, proto: s.Key.Proto, trafficType: s.TrafficType}
+			o, ok := others[key]
+			if !ok {
+				o = &FlowSample{
+					Interface:   iface,
+					Key:         FlowKey{Proto: s.Key.Proto},
+					TrafficType: s.TrafficType,
+					Interval:    s.Interval,
+					Timestamp:   s.Timestamp,
+					Remainder:   true,
+				}
+				others[key] = o
+				order = append(order, key)
+			}
+			o.DeltaPackets += s.DeltaPackets
+			o.DeltaBytes += s.DeltaBytes
+			o.BytesPerSec += s.BytesPerSec
+			o.BitsPerSec += s.BitsPerSec
+		}
+		for _, key := range order {
+			result = append(result, *others[key])
+		}
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func topTestFlow(iface string, srcPort uint16, proto uint8, trafficType string, packets, bytes uint64) FlowSample {
+	return FlowSample{
+		Interface:    iface,
+		Key:          FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: srcPort, Proto: proto},
+		SrcPort:      srcPort,
+		TrafficType:  trafficType,
+		DeltaPackets: packets,
+		DeltaBytes:   bytes,
+		BytesPerSec:  float64(bytes) / 2,
+		BitsPerSec:   float64(bytes) * 4,
+		Interval:     2,
+	}
+}
+
+// 结果表示为 interface:srcPort，剩余流量为 interface:other/trafficType
+func topFlowOrder(samples []FlowSample) []string {
+	var out []string
+	for _, s := range samples {
+		if s.Remainder {
+			out = append(out, s.Interface+":other/"+s.TrafficType)
+			continue
+		}
+		out = append(out, s.Interface+":"+strconv.Itoa(int(s.SrcPort)))
+	}
+	return out
+}
+
+func TestTopFlowSamplesRemainder(t *testing.T) {
+	flows := []FlowSample{
+		topTestFlow("ib0", 1, 0xFE, "RoCE_v2", 10, 1000),
+		topTestFlow("ib0", 2, 6, "TCP", 3, 300),
+		topTestFlow("ib0", 3, 0xFE, "RoCE_v2", 50, 5000),
+		topTestFlow("ib0", 4, 6, "TCP", 2, 200),
+		topTestFlow("ib0", 5, 0xFE, "RoCE_v2", 1, 100),
+		topTestFlow("ib1", 6, 6, "TCP", 7, 700),
+	}
+	got := topFlowSamples(slices.Clone(flows), 2)
+
+	want := []string{"ib0:3", "ib0:1", "ib0:other/TCP", "ib0:other/RoCE_v2", "ib1:6"}
+	if order := topFlowOrder(got); !slices.Equal(order, want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+
+	// 剩余流量等于未入选的流之和
+	sums := map[string][2]uint64{"TCP": {5, 500}, "RoCE_v2": {1, 100}}
+	for _, s := range got {
+		if !s.Remainder {
+			continue
+		}
+		w := sums[s.TrafficType]
+		if s.DeltaPackets != w[0] || s.DeltaBytes != w[1] || s.BytesPerSec != float64(w[1])/2 || s.BitsPerSec != float64(w[1])*4 {
+			t.Errorf("%s remainder = %d packets %d bytes %v B/s %v b/s, want %d / %d",
+				s.TrafficType, s.DeltaPackets, s.DeltaBytes, s.BytesPerSec, s.BitsPerSec, w[0], w[1])
+		}
+		if s.Interval != 2 || s.Key != (FlowKey{Proto: s.Key.Proto}) {
+			t.Errorf("%s remainder interval = %v key = %+v", s.TrafficType, s.Interval, s.Key)
+		}
+	}
+
+	// 每个接口的总量不变
+	total := func(samples []FlowSample, iface string) (packets, bytes uint64) {
+		for _, s := range samples {
+			if s.Interface == iface {
+				packets += s.DeltaPackets
+				bytes += s.DeltaBytes
+			}
+		}
+		return packets, bytes
+	}
+	for _, iface := range []string{"ib0", "ib1"} {
+		wp, wb := total(flows, iface)
+		if gp, gb := total(got, iface); gp != wp || gb != wb {
+			t.Errorf("%s totals = %d packets %d bytes, want %d / %d", iface, gp, gb, wp, wb)
+		}
+	}
+}
+
+func TestTopFlowSamplesTies(t *testing.T) {
+	flows := []FlowSample{
+		topTestFlow("ib0", 1, 6, "TCP", 1, 1000),
+		topTestFlow("ib0", 2, 6, "TCP", 2, 1000),
+		topTestFlow("ib0", 3, 6, "TCP", 2, 1000),
+		topTestFlow("ib0", 4, 6, "TCP", 1, 1000),
+		topTestFlow("ib0", 5, 6, "TCP", 9, 500),
+	}
+	// 字节数相同按包数、再按 FlowKey 排序，与输入顺序无关
+	want := []string{"ib0:2", "ib0:3", "ib0:1", "ib0:other/TCP"}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		in := slices.Clone(flows)
+		r.Shuffle(len(in), func(i, j int) { in[i], in[j] = in[j], in[i] })
+		if got := topFlowOrder(topFlowSamples(in, 3)); !slices.Equal(got, want) {
+			t.Fatalf("input %v: got %v, want %v", topFlowOrder(in), got, want)
+		}
+	}
+}
+
+func TestTopFlowSamplesNoLimit(t *testing.T) {
+	flows := []FlowSample{
+		topTestFlow("ib0", 1, 6, "TCP", 1, 100),
+		topTestFlow("ib0", 2, 6, "TCP", 2, 200),
+		topTestFlow("ib1", 3, 6, "TCP", 3, 300),
+	}
+	want := topFlowOrder(flows)
+	// n <= 0 不限制；n 不小于接口的流数量时原样保留，不产生剩余流量
+	for _, n := range []int{0, -1, 2, 3, 10} {
+		if got := topFlowOrder(topFlowSamples(slices.Clone(flows), n)); !slices.Equal(got, want) {
+			t.Errorf("n=%d: got %v, want %v", n, got, want)
+		}
+	}
+	if got := topFlowSamples(nil, 5); len(got) != 0 {
+		t.Errorf("nil input: got %v", got)
+	}
+}
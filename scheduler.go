@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// 下一个按挂钟对齐的采集时刻：Unix 时间上 interval 的整数倍（例如 5s 间隔对齐到 :00、:05……）
+// 集群内各主机按相同间隔采集时，描述的是同一个时间窗口
+func nextAlignedTick(now time.Time, interval time.Duration) time.Time {
+	iv := int64(interval)
+	return time.Unix(0, (now.UnixNano()/iv+1)*iv)
+}
+
+// 共享调度器：在对齐的时刻同时触发 sources 返回的所有接口采集，
+// 合并后的周期快照交给导出 goroutine，直到 stop 关闭
+func runScheduler(sources func() []*ifaceMonitor, stop <-chan struct{}, epochs chan<- epochSnapshot) {
+	var last time.Time
+	var lastInterval time.Duration
+	for {
+		// 采集间隔可能被 SIGHUP 热加载修改，每个周期重新读取
+		settingsMu.RLock()
+		interval := time.Duration(collectIntervalMs) * time.Millisecond
+		settingsMu.RUnlock()
+		if lastInterval != 0 && interval != lastInterval {
+			log.Printf("采集间隔调整为 %v", interval)
+		}
+
+		epoch := nextAlignedTick(time.Now(), interval)
+		if interval == lastInterval && !last.IsZero() && epoch.Sub(last) > interval {
+			log.Printf("警告: 上一周期的采集和推送耗时超过采集间隔，跳过了 %d 个周期", int(epoch.Sub(last)/interval)-1)
+		}
+		last, lastInterval = epoch, interval
+
+		timer := time.NewTimer(time.Until(epoch))
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+
+		// 所有接口读取完本周期数据后，样本和 metrics 描述的是同一个时间窗口
+		snap := collectEpoch(sources(), epoch, interval)
+		select {
+		case epochs <- snap:
+		default:
+			// 导出器仍在处理之前的周期（例如推送超时），丢弃本周期而不阻塞采集
+			log.Printf("警告: 导出器处理缓慢，丢弃 %s 的采集周期", epoch.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextAlignedTick(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) // Unix 时间上是整分钟
+	at := func(d time.Duration) time.Time { return base.Add(d) }
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		want     time.Time
+	}{
+		// 恰好在边界上时取下一个边界，避免同一时刻触发两次
+		{"5s on boundary", at(0), 5 * time.Second, at(5 * time.Second)},
+		{"5s just after boundary", at(time.Nanosecond), 5 * time.Second, at(5 * time.Second)},
+		{"5s just before boundary", at(5*time.Second - time.Nanosecond), 5 * time.Second, at(5 * time.Second)},
+		{"5s mid window", at(57*time.Second + 300*time.Millisecond), 5 * time.Second, at(time.Minute)},
+		{"1m on boundary", at(time.Minute), time.Minute, at(2 * time.Minute)},
+
+		// 亚秒间隔
+		{"100ms on boundary", at(200 * time.Millisecond), 100 * time.Millisecond, at(300 * time.Millisecond)},
+		{"100ms mid window", at(250 * time.Millisecond), 100 * time.Millisecond, at(300 * time.Millisecond)},
+		{"250ms before second", at(999 * time.Millisecond), 250 * time.Millisecond, at(time.Second)},
+
+		// 不能整除一分钟的间隔按 Unix 时间对齐，不按分钟对齐
+		// base = 1714564800s：7s 间隔的边界在 base 之后 3s、10s……，13s 间隔的边界恰好是 base
+		{"7s", at(0), 7 * time.Second, at(3 * time.Second)},
+		{"7s on boundary", at(3 * time.Second), 7 * time.Second, at(10 * time.Second)},
+		{"13s", at(time.Second), 13 * time.Second, at(13 * time.Second)},
+		{"13s across minute", at(58 * time.Second), 13 * time.Second, at(65 * time.Second)},
+		{"1500ms", at(time.Second), 1500 * time.Millisecond, at(1500 * time.Millisecond)},
+		{"1500ms on boundary", at(1500 * time.Millisecond), 1500 * time.Millisecond, at(3 * time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextAlignedTick(tt.now, tt.interval)
+			if !got.Equal(tt.want) {
+				t.Errorf("nextAlignedTick(%v, %v) = %v, want %v", tt.now.Format(time.RFC3339Nano), tt.interval,
+					got.UTC().Format(time.RFC3339Nano), tt.want.Format(time.RFC3339Nano))
+			}
+			if got.UnixNano()%int64(tt.interval) != 0 {
+				t.Errorf("%v is not a multiple of %v", got, tt.interval)
+			}
+			if !got.After(tt.now) || got.Sub(tt.now) > tt.interval {
+				t.Errorf("%v is not within (now, now+interval]", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// 自检使用的 veth 接口（创建在独立的网络命名空间中，不影响宿主机网络）
+const (
+	selftestIface = "xtc-self0" // 挂载 XDP 程序的一端
+	selftestPeer  = "xtc-self1" // 发送数据包的一端
+)
+
+// 自检的默认参数
+const (
+	defaultSelftestPackets   = 1000
+	defaultSelftestTolerance = 0.01
+	selftestSendBatch        = 64              // 每批发送的数据包数，批次之间短暂停顿，避免 veth 接收队列溢出
+	selftestSettleTimeout    = 2 * time.Second // 等待 XDP 程序处理完所有数据包的最长时间
+	selftestPollInterval     = 20 * time.Millisecond
+)
+
+// 自检流量使用 RFC 2544 基准测试地址段
+var (
+	selftestSrcIP = net.IPv4(198, 18, 0, 1).To4()
+	selftestDstIP = net.IPv4(198, 18, 0, 2).To4()
+)
+
+// --xdp-mode 可选的挂载模式
+var selftestXDPModes = map[string]link.XDPAttachFlags{
+	"native":  link.XDPDriverMode,
+	"generic": link.XDPGenericMode,
+}
+
+// 自检发送的一类流量
+type selftestTraffic struct {
+	Type    string // 期望识别出的流量类型
+	Proto   uint8  // IP 协议号
+	SrcPort uint16 // 主机字节序
+	DstPort uint16
+	Payload int // L4 头之后的负载长度
+}
+
+var selftestTraffics = []selftestTraffic{
+	{Type: "TCP", Proto: 6, SrcPort: 40000, DstPort: 5201, Payload: 1400},
+	{Type: "UDP", Proto: 17, SrcPort: 40001, DstPort: 5202, Payload: 512},
+	{Type: "RoCE_v2", Proto: 17, SrcPort: 40002, DstPort: 4791, Payload: 1024},
+}
+
+// 一种挂载模式下一类流量的自检结果
+type selftestResult struct {
+	Mode        string
+	Traffic     selftestTraffic
+	SentPackets uint64
+	SentBytes   uint64
+	GotPackets  uint64
+	GotBytes    uint64
+	GotType     string // 实际识别出的流量类型（未统计到时为空）
+}
+
+// 计数与发送量的相对误差都在容差内，且流量类型识别正确
+func (r selftestResult) ok(tolerance float64) bool {
+	within := func(got, want uint64) bool {
+		if want == 0 {
+			return got == 0
+		}
+		diff := float64(got) - float64(want)
+		if diff < 0 {
+			diff = -diff
+		}
+		return diff/float64(want) <= tolerance
+	}
+	return r.GotType == r.Traffic.Type &&
+		within(r.GotPackets, r.SentPackets) && within(r.GotBytes, r.SentBytes)
+}
+
+// selftest 子命令：在独立网络命名空间的 veth 对上挂载 XDP 程序，
+// 从另一端发送已知数量的 TCP、UDP 和 RoCE v2 数据包，校验统计到的包数和字节数
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	var packets int
+	var tolerance float64
+	var xdpMode string
+
+	fs.IntVar(&packets, "packets", defaultSelftestPackets, "每类流量发送的数据包数")
+	fs.Float64Var(&tolerance, "tolerance", defaultSelftestTolerance, "包数和字节数允许的相对误差（0.01 = 1%）")
+	fs.StringVar(&xdpMode, "xdp-mode", "all", "XDP 挂载模式: native, generic, all（依次测试两种模式）")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "XTrace-Catch: 自检\n\n")
+		fmt.Fprintf(os.Stderr, "用法: %s selftest [选项]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "选项:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\n在新建的网络命名空间中创建 veth 对 (%s / %s)，把 xdp_monitor.o 挂载到 %s，\n", selftestIface, selftestPeer, selftestIface)
+		fmt.Fprintf(os.Stderr, "从 %s 发送 TCP、UDP 和 RoCE v2 (UDP 4791) 数据包，校验 flows map 中的包数和字节数。\n", selftestPeer)
+		fmt.Fprintf(os.Stderr, "需要 root 权限，不影响宿主机网络；全部通过时退出码为 0，否则为 1。\n")
+		fmt.Fprintf(os.Stderr, "\n示例:\n")
+		fmt.Fprintf(os.Stderr, "  %s selftest                       # native 和 generic 模式各测试一次\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s selftest --xdp-mode generic    # 只测试 generic 模式\n", os.Args[0])
+	}
+	fs.Parse(args)
+
+	if packets <= 0 {
+		log.Fatalf("--packets 必须大于 0")
+	}
+	if tolerance < 0 {
+		log.Fatalf("--tolerance 不能为负数")
+	}
+	var modes []string
+	switch xdpMode {
+	case "all":
+		modes = []string{"native", "generic"}
+	case "native", "generic":
+		modes = []string{xdpMode}
+	default:
+		log.Fatalf("无效的 XDP 挂载模式: %s（可选: native, generic, all）", xdpMode)
+	}
+
+	results, err := selftest(modes, packets)
+	if err != nil {
+		log.Fatalf("自检失败: %v", err)
+	}
+
+	fmt.Printf("%-8s %-8s %10s %10s %12s %12s %-8s %s\n",
+		"MODE", "TRAFFIC", "SENT_PKTS", "GOT_PKTS", "SENT_BYTES", "GOT_BYTES", "TYPE", "RESULT")
+	passed := true
+	for _, r := range results {
+		status := "PASS"
+		if !r.ok(tolerance) {
+			status = "FAIL"
+			passed = false
+		}
+		gotType := r.GotType
+		if gotType == "" {
+			gotType = "-"
+		}
+		fmt.Printf("%-8s %-8s %10d %10d %12d %12d %-8s %s\n",
+			r.Mode, r.Traffic.Type, r.SentPackets, r.GotPackets, r.SentBytes, r.GotBytes, gotType, status)
+	}
+	if !passed {
+		log.Printf("自检未通过（容差 %.2f%%）", tolerance*100)
+		os.Exit(1)
+	}
+	log.Printf("自检通过: %s", strings.Join(modes, ", "))
+}
+
+// 在新的网络命名空间中创建 veth 对，依次按各挂载模式发包并统计
+// 返回时恢复原网络命名空间，命名空间和 veth 对随之销毁
+func selftest(modes []string, packets int) ([]selftestResult, error) {
+	// 网络命名空间按线程生效：创建、挂载和发包都必须在同一个线程上
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		return nil, fmt.Errorf("获取当前网络命名空间失败: %w", err)
+	}
+	defer origin.Close()
+
+	ns, err := netns.New()
+	if err != nil {
+		return nil, fmt.Errorf("创建网络命名空间失败（需要 root 权限）: %w", err)
+	}
+	defer ns.Close()
+	defer func() {
+		if err := netns.Set(origin); err != nil {
+			log.Printf("恢复网络命名空间失败: %v", err)
+		}
+	}()
+
+	host, peer, err := setupSelftestVeth(ns)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("已在独立网络命名空间中创建 veth 对 %s (索引: %d) / %s (索引: %d)",
+		selftestIface, host.Attrs().Index, selftestPeer, peer.Attrs().Index)
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		return nil, fmt.Errorf("创建 AF_PACKET 套接字失败: %w", err)
+	}
+	defer unix.Close(fd)
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Ifindex: peer.Attrs().Index}); err != nil {
+		return nil, fmt.Errorf("绑定 %s 失败: %w", selftestPeer, err)
+	}
+
+	frames := make([][]byte, len(selftestTraffics))
+	for i, t := range selftestTraffics {
+		frames[i] = buildSelftestFrame(host.Attrs().HardwareAddr, peer.Attrs().HardwareAddr, t)
+	}
+
+	var results []selftestResult
+	for _, mode := range modes {
+		modeResults, err := selftestMode(mode, host.Attrs().Index, fd, frames, packets)
+		if err != nil {
+			return nil, fmt.Errorf("%s 模式: %w", mode, err)
+		}
+		results = append(results, modeResults...)
+	}
+
+	// veth 接收队列溢出时丢弃的数据包不会经过 XDP 程序，单独提示
+	if l, err := netlink.LinkByName(selftestIface); err == nil && l.Attrs().Statistics != nil {
+		if dropped := l.Attrs().Statistics.RxDropped; dropped > 0 {
+			log.Printf("%s 接收丢包 %d 个，可减小 --packets 或放宽 --tolerance", selftestIface, dropped)
+		}
+	}
+	return results, nil
+}
+
+// 创建 veth 对并启用两端
+func setupSelftestVeth(ns netns.NsHandle) (host, peer netlink.Link, err error) {
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建 netlink 句柄失败: %w", err)
+	}
+	defer h.Close()
+
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: selftestIface},
+		PeerName:  selftestPeer,
+	}
+	if err := h.LinkAdd(veth); err != nil {
+		return nil, nil, fmt.Errorf("创建 veth 对失败: %w", err)
+	}
+	for _, name := range []string{selftestIface, selftestPeer} {
+		l, err := h.LinkByName(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("查找 %s 失败: %w", name, err)
+		}
+		if err := h.LinkSetUp(l); err != nil {
+			return nil, nil, fmt.Errorf("启用 %s 失败: %w", name, err)
+		}
+	}
+
+	// 重新读取以获得启用后的属性（MAC 地址等）
+	if host, err = h.LinkByName(selftestIface); err != nil {
+		return nil, nil, fmt.Errorf("查找 %s 失败: %w", selftestIface, err)
+	}
+	if peer, err = h.LinkByName(selftestPeer); err != nil {
+		return nil, nil, fmt.Errorf("查找 %s 失败: %w", selftestPeer, err)
+	}
+	return host, peer, nil
+}
+
+// 加载全新的 eBPF 对象，按指定模式挂载后发包，读取 flows map 统计各类流量
+func selftestMode(mode string, ifindex, fd int, frames [][]byte, packets int) ([]selftestResult, error) {
+	spec, err := ebpf.LoadCollectionSpec("xdp_monitor.o")
+	if err != nil {
+		return nil, fmt.Errorf("加载 eBPF 规范失败: %w", err)
+	}
+	objs := &monitorObjects{}
+	if err := spec.LoadAndAssign(objs, nil); err != nil {
+		return nil, fmt.Errorf("加载 eBPF 对象失败: %w", err)
+	}
+	defer objs.Close()
+
+	l, err := link.AttachXDP(link.XDPOptions{
+		Program:   objs.XdpMonitor,
+		Interface: ifindex,
+		Flags:     selftestXDPModes[mode],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("挂载 XDP 程序失败: %w", err)
+	}
+	defer l.Close()
+	log.Printf("[%s] XDP 程序已以 %s 模式挂载，每类流量发送 %d 个数据包", selftestIface, mode, packets)
+
+	windowStart := monotonicNow()
+	start := time.Now()
+
+	// 各类流量交替发送，丢包时均匀分布到每类流量上
+	for i := 0; i < packets; i++ {
+		for _, frame := range frames {
+			if _, err := unix.Write(fd, frame); err != nil {
+				return nil, fmt.Errorf("发送数据包失败: %w", err)
+			}
+		}
+		if (i+1)%selftestSendBatch == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 每类流量的 key 与 XDP 程序的解析规则一致
+	keys := make([]FlowKey, len(frames))
+	for i, frame := range frames {
+		keys[i] = parsePacket(frame, len(frame))
+	}
+
+	// 等待 XDP 程序处理完队列中的数据包
+	source := newXDPMapSource(objs.Flows)
+	var flows map[FlowKey]FlowStats
+	deadline := time.Now().Add(selftestSettleTimeout)
+	for {
+		if flows, err = source.Snapshot(); err != nil {
+			return nil, fmt.Errorf("读取 flows map 失败: %w", err)
+		}
+		complete := true
+		for _, k := range keys {
+			if flows[k].Packets < uint64(packets) {
+				complete = false
+			}
+		}
+		if complete || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(selftestPollInterval)
+	}
+
+	// 按在线监控相同的方式计算增量和流量类型
+	snap, _ := collectFlows(selftestIface, flows, nil, collectOptions{
+		WindowStart: windowStart,
+		Interval:    time.Since(start).Seconds(),
+		Epoch:       time.Now(),
+	})
+
+	results := make([]selftestResult, len(frames))
+	for i, t := range selftestTraffics {
+		results[i] = selftestResult{
+			Mode:        mode,
+			Traffic:     t,
+			SentPackets: uint64(packets),
+			SentBytes:   uint64(packets * len(frames[i])),
+		}
+		for _, f := range snap.Flows {
+			if f.Key == keys[i] {
+				results[i].GotPackets += f.DeltaPackets
+				results[i].GotBytes += f.DeltaBytes
+				results[i].GotType = f.TrafficType
+			}
+		}
+	}
+	return results, nil
+}
+
+// 构造一个以太网 + IPv4 + TCP/UDP 数据包
+// XDP 程序在协议栈之前计数，L4 校验和不影响统计，保持为 0
+func buildSelftestFrame(dstMAC, srcMAC net.HardwareAddr, t selftestTraffic) []byte {
+	l4Len := 8
+	if t.Proto == 6 {
+		l4Len = 20
+	}
+	frame := make([]byte, 14+20+l4Len+t.Payload)
+
+	copy(frame[0:6], dstMAC)
+	copy(frame[6:12], srcMAC)
+	binary.BigEndian.PutUint16(frame[12:14], unix.ETH_P_IP)
+
+	ip := frame[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+l4Len+t.Payload))
+	ip[8] = 64 // TTL
+	ip[9] = t.Proto
+	copy(ip[12:16], selftestSrcIP)
+	copy(ip[16:20], selftestDstIP)
+	binary.BigEndian.PutUint16(ip[10:12], ipv4Checksum(ip[:20]))
+
+	l4 := ip[20:]
+	binary.BigEndian.PutUint16(l4[0:2], t.SrcPort)
+	binary.BigEndian.PutUint16(l4[2:4], t.DstPort)
+	if t.Proto == 6 {
+		l4[12] = 5 << 4 // 数据偏移: 20 字节
+		l4[13] = 0x18   // PSH | ACK
+		binary.BigEndian.PutUint16(l4[14:16], 65535)
+	} else {
+		binary.BigEndian.PutUint16(l4[4:6], uint16(l4Len+t.Payload))
+	}
+	for i := range l4[l4Len:] {
+		l4[l4Len+i] = byte(i)
+	}
+	return frame
+}
+
+// IPv4 头校验和
+func ipv4Checksum(hdr []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(hdr); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(hdr[i : i+2]))
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
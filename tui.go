@@ -0,0 +1,459 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	tuiHistoryLen = 30                     // sparkline 保留的采集周期数
+	tuiRefresh    = 250 * time.Millisecond // 界面刷新间隔
+)
+
+// 可选的排序字段和协议过滤（过滤值与 -f 参数一致）
+var (
+	tuiSortKeys = []string{"rate", "packets", "bytes", "interface", "type"}
+	tuiFilters  = []string{"all", "roce", "roce_v1", "roce_v2", "tcp", "udp", "ib"}
+)
+
+// sparkline 字符（从低到高）
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// TUI 模式（全局变量）
+var (
+	tuiEnabled bool
+	tuiState   = newTUIModel()
+)
+
+// 流在界面中的唯一标识（同一个五元组可能出现在多个接口上）
+type tuiFlowID struct {
+	iface string
+	key   FlowKey
+}
+
+type tuiFlow struct {
+	id      tuiFlowID
+	sample  FlowSample // 最近一个采集周期的样本
+	history []float64  // 最近若干周期的 bits/s
+}
+
+type tuiIface struct {
+	bitsPerSec    float64
+	packetsPerSec float64
+	history       []float64
+}
+
+// 界面状态：采集 goroutine 写入，界面 goroutine 读取
+type tuiModel struct {
+	mu     sync.Mutex
+	flows  map[tuiFlowID]*tuiFlow
+	ifaces map[string]*tuiIface
+
+	sortKey        int
+	reverse        bool // 默认数值字段降序、文本字段升序，reverse 反转
+	filter         int
+	showTotals     bool
+	showSparklines bool
+	offset         int // 表格滚动偏移
+	logLine        string
+}
+
+func newTUIModel() *tuiModel {
+	return &tuiModel{
+		flows:          make(map[tuiFlowID]*tuiFlow),
+		ifaces:         make(map[string]*tuiIface),
+		showTotals:     true,
+		showSparklines: true,
+	}
+}
+
+// 追加一个历史点，保留最近 tuiHistoryLen 个
+func pushHistory(history []float64, v float64) []float64 {
+	history = append(history, v)
+	if len(history) > tuiHistoryLen {
+		history = history[len(history)-tuiHistoryLen:]
+	}
+	return history
+}
+
+// update 用一个接口本周期的样本刷新界面状态
+func (m *tuiModel) update(iface string, samples []FlowSample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[tuiFlowID]bool, len(samples))
+	var bits, pps float64
+	for _, s := range samples {
+		id := tuiFlowID{iface: iface, key: s.Key}
+		f, ok := m.flows[id]
+		if !ok {
+			// 只为有流量的流创建条目，BPF map 中长期空闲的流不显示
+			if s.DeltaPackets == 0 {
+				continue
+			}
+			f = &tuiFlow{id: id}
+			m.flows[id] = f
+		}
+		f.sample = s
+		f.history = pushHistory(f.history, s.BitsPerSec)
+		seen[id] = true
+
+		bits += s.BitsPerSec
+		if s.Interval > 0 {
+			pps += float64(s.DeltaPackets) / s.Interval
+		}
+	}
+
+	// 本周期未出现的流速率归零，整个历史窗口都为 0 时移除
+	for id, f := range m.flows {
+		if id.iface != iface || seen[id] {
+			continue
+		}
+		f.sample.DeltaPackets, f.sample.DeltaBytes = 0, 0
+		f.sample.BytesPerSec, f.sample.BitsPerSec = 0, 0
+		f.history = pushHistory(f.history, 0)
+		if historyIdle(f.history) {
+			delete(m.flows, id)
+		}
+	}
+
+	t, ok := m.ifaces[iface]
+	if !ok {
+		t = &tuiIface{}
+		m.ifaces[iface] = t
+	}
+	t.bitsPerSec = bits
+	t.packetsPerSec = pps
+	t.history = pushHistory(t.history, bits)
+}
+
+// forget 移除已停止监控的接口及其流
+func (m *tuiModel) forget(iface string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.ifaces, iface)
+	for id := range m.flows {
+		if id.iface == iface {
+			delete(m.flows, id)
+		}
+	}
+}
+
+func historyIdle(history []float64) bool {
+	if len(history) < tuiHistoryLen {
+		return false
+	}
+	for _, v := range history {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *tuiModel) setLog(line string) {
+	m.mu.Lock()
+	m.logLine = line
+	m.mu.Unlock()
+}
+
+// handleKey 处理按键，返回 true 表示退出
+func (m *tuiModel) handleKey(ev *tcell.EventKey) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch ev.Key() {
+	case tcell.KeyCtrlC, tcell.KeyEscape:
+		return true
+	case tcell.KeyUp:
+		m.offset--
+	case tcell.KeyDown:
+		m.offset++
+	case tcell.KeyPgUp:
+		m.offset -= 20
+	case tcell.KeyPgDn:
+		m.offset += 20
+	case tcell.KeyHome:
+		m.offset = 0
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q', 'Q':
+			return true
+		case 's':
+			m.sortKey = (m.sortKey + 1) % len(tuiSortKeys)
+		case 'S':
+			m.sortKey = (m.sortKey + len(tuiSortKeys) - 1) % len(tuiSortKeys)
+		case 'r':
+			m.reverse = !m.reverse
+		case 'f':
+			m.filter = (m.filter + 1) % len(tuiFilters)
+			m.offset = 0
+		case 'F':
+			m.filter = (m.filter + len(tuiFilters) - 1) % len(tuiFilters)
+			m.offset = 0
+		case 't':
+			m.showTotals = !m.showTotals
+		case 'g':
+			m.showSparklines = !m.showSparklines
+		case 'k':
+			m.offset--
+		case 'j':
+			m.offset++
+		}
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+	return false
+}
+
+// 按当前过滤和排序条件取出要显示的流
+func (m *tuiModel) visibleFlows() []*tuiFlow {
+	filter := tuiFilters[m.filter]
+	var rows []*tuiFlow
+	for _, f := range m.flows {
+		k := f.sample.Key
+		if shouldDisplayTraffic(k.Proto, k.SrcPort, k.DstPort, filter) {
+			rows = append(rows, f)
+		}
+	}
+
+	// 排序字段相同时按速率、再按流标识排序：rows 来自 map 遍历，顺序必须完全确定，否则每次刷新都会跳动
+	order := func(a, b *tuiFlow) int {
+		x, y := a.sample, b.sample
+		c := 0
+		switch tuiSortKeys[m.sortKey] {
+		case "packets":
+			c = cmp.Compare(y.DeltaPackets, x.DeltaPackets)
+		case "bytes":
+			c = cmp.Compare(y.DeltaBytes, x.DeltaBytes)
+		case "interface":
+			c = strings.Compare(x.Interface, y.Interface)
+		case "type":
+			c = strings.Compare(x.TrafficType, y.TrafficType)
+		}
+		if c == 0 {
+			c = cmp.Compare(y.BitsPerSec, x.BitsPerSec)
+		}
+		if c == 0 {
+			c = compareTUIFlowID(a.id, b.id)
+		}
+		return c
+	}
+	slices.SortFunc(rows, func(a, b *tuiFlow) int {
+		if m.reverse {
+			return order(b, a)
+		}
+		return order(a, b)
+	})
+	return rows
+}
+
+// 按接口名和 FlowKey 比较流标识
+func compareTUIFlowID(a, b tuiFlowID) int {
+	return cmp.Or(strings.Compare(a.iface, b.iface), compareFlowKey(a.key, b.key))
+}
+
+// 格式化比特率（自动选择单位）
+func formatBitRate(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbps", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.2f Mbps", bps/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.2f Kbps", bps/1e3)
+	default:
+		return fmt.Sprintf("%.0f bps", bps)
+	}
+}
+
+// 将历史数据渲染为 sparkline（按窗口内最大值归一化）
+func sparkline(history []float64) string {
+	maxV := 0.0
+	for _, v := range history {
+		if v > maxV {
+			maxV = v
+		}
+	}
+	var b strings.Builder
+	for i := len(history); i < tuiHistoryLen; i++ {
+		b.WriteRune(' ')
+	}
+	for _, v := range history {
+		idx := 0
+		if maxV > 0 {
+			idx = int(v / maxV * float64(len(sparkRunes)-1))
+		}
+		b.WriteRune(sparkRunes[idx])
+	}
+	return b.String()
+}
+
+// 在屏幕上绘制一行文本，返回结束位置
+func tuiDrawText(s tcell.Screen, x, y, maxX int, style tcell.Style, text string) int {
+	for _, r := range text {
+		w := runewidth.RuneWidth(r)
+		if x+w > maxX {
+			break
+		}
+		s.SetContent(x, y, r, nil, style)
+		x += w
+	}
+	return x
+}
+
+// 绘制整个界面
+func (m *tuiModel) draw(s tcell.Screen, hostIP string, intervalMs int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.Clear()
+	width, height := s.Size()
+	headerStyle := tcell.StyleDefault.Reverse(true)
+	boldStyle := tcell.StyleDefault.Bold(true)
+	dimStyle := tcell.StyleDefault.Dim(true)
+
+	order := "↓"
+	if m.reverse {
+		order = "↑"
+	}
+	rows := m.visibleFlows()
+
+	y := 0
+	title := fmt.Sprintf(" xtrace-catch  host_ip=%s  interval=%dms  sort=%s%s  filter=%s  flows=%d",
+		hostIP, intervalMs, tuiSortKeys[m.sortKey], order, tuiFilters[m.filter], len(rows))
+	tuiDrawText(s, 0, y, width, headerStyle, title+strings.Repeat(" ", width))
+	y++
+
+	// 各接口汇总
+	if m.showTotals {
+		ifaces := make([]string, 0, len(m.ifaces))
+		for name := range m.ifaces {
+			ifaces = append(ifaces, name)
+		}
+		sort.Strings(ifaces)
+		for _, name := range ifaces {
+			t := m.ifaces[name]
+			line := fmt.Sprintf(" %-12s %14s %12.0f pkt/s", name, formatBitRate(t.bitsPerSec), t.packetsPerSec)
+			x := tuiDrawText(s, 0, y, width, boldStyle, line)
+			if m.showSparklines {
+				tuiDrawText(s, x+2, y, width, tcell.StyleDefault, sparkline(t.history))
+			}
+			y++
+		}
+		y++
+	}
+
+	// 流表
+	header := fmt.Sprintf(" %-10s %-21s %-21s %-14s %14s %10s %12s", "INTERFACE", "SOURCE", "DESTINATION", "TYPE", "RATE", "PACKETS", "BYTES")
+	if m.showSparklines {
+		header += "  HISTORY"
+	}
+	tuiDrawText(s, 0, y, width, headerStyle, header+strings.Repeat(" ", width))
+	y++
+
+	avail := height - y - 2 // 预留帮助行和日志行
+	if avail < 0 {
+		avail = 0
+	}
+	if m.offset > len(rows)-avail {
+		m.offset = len(rows) - avail
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+	for i := m.offset; i < len(rows) && i < m.offset+avail; i++ {
+		f := rows[i].sample
+		style := tcell.StyleDefault
+		if f.DeltaPackets == 0 {
+			style = dimStyle
+		}
+		line := fmt.Sprintf(" %-10s %-21s %-21s %-14s %14s %10d %12d",
+			f.Interface,
+			fmt.Sprintf("%s:%d", ipToStr(f.Key.SrcIP), f.SrcPort),
+			fmt.Sprintf("%s:%d", ipToStr(f.Key.DstIP), f.DstPort),
+			strings.TrimSpace(formatTrafficType(f.TrafficType)),
+			formatBitRate(f.BitsPerSec), f.DeltaPackets, f.DeltaBytes)
+		x := tuiDrawText(s, 0, y, width, style, line)
+		if m.showSparklines {
+			tuiDrawText(s, x+2, y, width, style, sparkline(rows[i].history))
+		}
+		y++
+	}
+
+	help := " [s/S]排序 [r]反转 [f/F]协议过滤 [t]接口汇总 [g]趋势图 [↑↓/PgUp/PgDn]滚动 [q]退出"
+	tuiDrawText(s, 0, height-2, width, headerStyle, help+strings.Repeat(" ", width))
+	tuiDrawText(s, 0, height-1, width, dimStyle, " "+m.logLine)
+
+	s.Show()
+}
+
+// TUI 模式下日志写入状态栏，避免破坏界面
+type tuiLogWriter struct{}
+
+func (tuiLogWriter) Write(p []byte) (int, error) {
+	tuiState.setLog(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// 初始化终端屏幕（需要在启动采集 goroutine 之前调用，以便接管日志输出）
+func newTUIScreen() (tcell.Screen, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+	if err := screen.Init(); err != nil {
+		return nil, err
+	}
+	log.SetOutput(tuiLogWriter{})
+	return screen, nil
+}
+
+// 运行 TUI 事件循环，直到收到停止信号或用户退出
+func runTUI(screen tcell.Screen, stop <-chan struct{}, shutdown func(), hostIP string, intervalMs int) {
+	defer func() {
+		screen.Fini()
+		log.SetOutput(os.Stderr)
+	}()
+
+	events := make(chan tcell.Event, 16)
+	quit := make(chan struct{})
+	defer close(quit)
+	go screen.ChannelEvents(events, quit)
+
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	for {
+		tuiState.draw(screen, hostIP, intervalMs)
+		select {
+		case <-stop:
+			return
+		case ev := <-events:
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				screen.Sync()
+			case *tcell.EventKey:
+				if tuiState.handleKey(ev) {
+					shutdown()
+					return
+				}
+			}
+		case <-ticker.C:
+		}
+	}
+}
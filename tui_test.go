@@ -0,0 +1,186 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func tuiSample(iface string, srcPort uint16, proto uint8, packets uint64, bitsPerSec float64) FlowSample {
+	return FlowSample{
+		Interface:    iface,
+		Key:          FlowKey{SrcIP: testSrcIP, DstIP: testDstIP, SrcPort: srcPort, DstPort: 4791, Proto: proto},
+		SrcPort:      srcPort,
+		DstPort:      4791,
+		DeltaPackets: packets,
+		DeltaBytes:   packets * 100,
+		BitsPerSec:   bitsPerSec,
+		Interval:     1,
+	}
+}
+
+func TestTUIModelUpdate(t *testing.T) {
+	m := newTUIModel()
+
+	// 从未有过流量的流不创建条目
+	m.update("ib0", []FlowSample{tuiSample("ib0", 1, 6, 10, 800), tuiSample("ib0", 2, 6, 0, 0)})
+	if len(m.flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(m.flows))
+	}
+	m.update("ib1", []FlowSample{tuiSample("ib1", 1, 6, 5, 400)})
+	if tot := m.ifaces["ib0"]; tot.bitsPerSec != 800 || tot.packetsPerSec != 10 || len(tot.history) != 1 {
+		t.Errorf("ib0 totals = %+v", tot)
+	}
+
+	// 本周期未出现的流速率归零，其他接口的流不受影响
+	m.update("ib0", nil)
+	f := m.flows[tuiFlowID{iface: "ib0", key: tuiSample("ib0", 1, 6, 0, 0).Key}]
+	if f == nil {
+		t.Fatalf("flow removed after one idle interval")
+	}
+	if f.sample.BitsPerSec != 0 || f.sample.DeltaPackets != 0 || len(f.history) != 2 || f.history[1] != 0 {
+		t.Errorf("idle flow = %+v history %v", f.sample, f.history)
+	}
+	if len(m.flows) != 2 {
+		t.Errorf("got %d flows, want 2", len(m.flows))
+	}
+
+	// 整个历史窗口都为 0 后移除
+	for i := 0; i < tuiHistoryLen; i++ {
+		m.update("ib0", nil)
+	}
+	if len(m.flows) != 1 {
+		t.Errorf("got %d flows after the idle window, want 1", len(m.flows))
+	}
+	if tot := m.ifaces["ib0"]; len(tot.history) != tuiHistoryLen || tot.bitsPerSec != 0 {
+		t.Errorf("ib0 totals = %v history %d points", tot.bitsPerSec, len(tot.history))
+	}
+}
+
+func TestTUIModelForget(t *testing.T) {
+	m := newTUIModel()
+	m.update("ib0", []FlowSample{tuiSample("ib0", 1, 6, 10, 800)})
+	m.update("ib1", []FlowSample{tuiSample("ib1", 1, 6, 10, 800)})
+	m.forget("ib0")
+	if _, ok := m.ifaces["ib0"]; ok {
+		t.Errorf("ib0 totals still present")
+	}
+	if len(m.flows) != 1 || len(m.ifaces) != 1 {
+		t.Errorf("flows = %d ifaces = %d, want 1 / 1", len(m.flows), len(m.ifaces))
+	}
+}
+
+func TestTUIPushHistory(t *testing.T) {
+	var h []float64
+	for i := 0; i < tuiHistoryLen+5; i++ {
+		h = pushHistory(h, float64(i))
+	}
+	if len(h) != tuiHistoryLen || h[0] != 5 || h[len(h)-1] != tuiHistoryLen+4 {
+		t.Errorf("history = %v", h)
+	}
+	if historyIdle(make([]float64, tuiHistoryLen-1)) {
+		t.Errorf("short history reported idle")
+	}
+	if !historyIdle(make([]float64, tuiHistoryLen)) {
+		t.Errorf("all-zero history not reported idle")
+	}
+}
+
+// 行顺序表示为 interface:srcPort
+func tuiRowOrder(rows []*tuiFlow) []string {
+	var out []string
+	for _, f := range rows {
+		out = append(out, f.id.iface+":"+strconv.Itoa(int(f.sample.SrcPort)))
+	}
+	return out
+}
+
+func TestTUIVisibleFlowsOrder(t *testing.T) {
+	m := newTUIModel()
+	// 速率相同的流在每次刷新时必须保持同一顺序
+	m.update("ib1", []FlowSample{tuiSample("ib1", 3, 6, 10, 800), tuiSample("ib1", 1, 6, 30, 800), tuiSample("ib1", 2, 17, 20, 1600)})
+	m.update("ib0", []FlowSample{tuiSample("ib0", 4, 6, 10, 800), tuiSample("ib0", 5, 0xFE, 10, 800)})
+
+	tests := []struct {
+		sortKey string
+		reverse bool
+		filter  string
+		want    string
+	}{
+		{sortKey: "rate", want: "ib1:2 ib0:4 ib0:5 ib1:1 ib1:3"},
+		{sortKey: "rate", reverse: true, want: "ib1:3 ib1:1 ib0:5 ib0:4 ib1:2"},
+		{sortKey: "packets", want: "ib1:1 ib1:2 ib0:4 ib0:5 ib1:3"},
+		{sortKey: "interface", want: "ib0:4 ib0:5 ib1:2 ib1:1 ib1:3"},
+		{sortKey: "rate", filter: "tcp", want: "ib0:4 ib1:1 ib1:3"},
+		{sortKey: "rate", filter: "roce_v2", want: "ib0:5"},
+	}
+	for _, tt := range tests {
+		m.sortKey = indexOf(tuiSortKeys, tt.sortKey)
+		m.filter = indexOf(tuiFilters, "all")
+		if tt.filter != "" {
+			m.filter = indexOf(tuiFilters, tt.filter)
+		}
+		m.reverse = tt.reverse
+		for i := 0; i < 20; i++ {
+			if got := strings.Join(tuiRowOrder(m.visibleFlows()), " "); got != tt.want {
+				t.Errorf("sort=%s reverse=%v filter=%s: got %s, want %s", tt.sortKey, tt.reverse, tt.filter, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func indexOf(list []string, v string) int {
+	for i, s := range list {
+		if s == v {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestSparkline(t *testing.T) {
+	s := sparkline([]float64{0, 50, 100})
+	if utf8.RuneCountInString(s) != tuiHistoryLen {
+		t.Fatalf("sparkline %q has %d runes, want %d", s, utf8.RuneCountInString(s), tuiHistoryLen)
+	}
+	if !strings.HasSuffix(s, "▁▄█") || strings.TrimLeft(s, " ") != "▁▄█" {
+		t.Errorf("sparkline = %q", s)
+	}
+	if got := sparkline([]float64{0, 0}); strings.TrimLeft(got, " ") != "▁▁" {
+		t.Errorf("all-zero sparkline = %q", got)
+	}
+}
+
+func TestTUIHandleKey(t *testing.T) {
+	m := newTUIModel()
+	key := func(r rune) bool { return m.handleKey(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone)) }
+
+	key('s')
+	if tuiSortKeys[m.sortKey] != "packets" {
+		t.Errorf("sort key = %s after s", tuiSortKeys[m.sortKey])
+	}
+	key('S')
+	key('S')
+	if m.sortKey != len(tuiSortKeys)-1 {
+		t.Errorf("sort key = %d after S S", m.sortKey)
+	}
+	key('j')
+	key('f')
+	if m.offset != 0 || tuiFilters[m.filter] != "roce" {
+		t.Errorf("offset = %d filter = %s after f", m.offset, tuiFilters[m.filter])
+	}
+	key('k')
+	if m.offset != 0 {
+		t.Errorf("offset = %d, want 0", m.offset)
+	}
+	if !key('q') || !m.handleKey(tcell.NewEventKey(tcell.KeyCtrlC, 0, tcell.ModNone)) {
+		t.Errorf("q / Ctrl-C did not quit")
+	}
+}
@@ -1,5 +1,6 @@
 //go:build ignore
 // +build ignore
+
 #include <linux/bpf.h>
 #include <bpf/bpf_helpers.h>
 #include <linux/if_ether.h>
@@ -32,6 +33,7 @@ struct flow_stats {
     __u64 packets;
     __u64 bytes;
     __u64 last_update; // 最后更新时间（纳秒），用于检测陈旧条目
+    __u64 first_seen;  // 条目创建时间（纳秒），用于区分内核中的新流与用户态首次看到的流
 };
 
 struct {
@@ -41,12 +43,92 @@ struct {
     __type(value, struct flow_stats);
 } flows SEC(".maps");
 
+// 微突发直方图的桶数：第 i 个桶统计字节数 <= BURST_MIN_BYTES << i 的时间片，最后一个桶不设上限
+#define BURST_BUCKETS 16
+#define BURST_MIN_BYTES 1024
+
+// 微突发统计配置（用户态写入）
+struct burst_config {
+    __u64 slot_ns; // 时间片长度（纳秒），0 表示关闭
+    __u64 gen;     // 采集周期编号，用户态每次读取前加 1
+};
+
+// 接口级别的微突发统计：按固定时间片累计字节数，时间片结束后计入直方图
+struct burst_state {
+    __u64 slot;                   // 当前时间片编号
+    __u64 slot_bytes;             // 当前时间片已累计的字节数
+    __u64 peak_gen[2];            // 峰值所属的采集周期（双缓冲，下标为 gen & 1）
+    __u64 peak_bytes[2];          // 该采集周期内单个时间片的最大字节数
+    __u64 buckets[BURST_BUCKETS]; // 已结束的时间片按字节数分桶的个数（累计）
+    __u64 sum_bytes;              // 已结束的时间片的字节数之和（累计）
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct burst_config);
+} burst_config SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct burst_state);
+} burst SEC(".maps");
+
+// 把一个已结束的时间片计入直方图和本采集周期的峰值
+static __always_inline void record_burst_slot(struct burst_state *st, __u64 bytes, __u64 gen) {
+    __u32 bucket = 0;
+    #pragma unroll
+    for (int i = 0; i < BURST_BUCKETS - 1; i++) {
+        if (bytes > ((__u64)BURST_MIN_BYTES << i))
+            bucket = i + 1;
+    }
+    __sync_fetch_and_add(&st->buckets[bucket & (BURST_BUCKETS - 1)], 1);
+    __sync_fetch_and_add(&st->sum_bytes, bytes);
+
+    __u32 idx = gen & 1;
+    if (st->peak_gen[idx] != gen) {
+        st->peak_gen[idx] = gen;
+        st->peak_bytes[idx] = 0;
+    }
+    if (bytes > st->peak_bytes[idx])
+        st->peak_bytes[idx] = bytes;
+}
+
+// 按时间片累计接口的字节数（所有数据包，包括无法解析的）
+// 时间片由第一个看到新时间片的数据包结算。为兼容不支持 BPF 原子交换的内核只使用 fetch_and_add：
+// 多个 CPU 同时跨过时间片边界时，可能重复结算或少计几个数据包，峰值不受重复结算影响
+static __always_inline void account_burst(__u64 bytes) {
+    __u32 zero = 0;
+    struct burst_config *cfg = bpf_map_lookup_elem(&burst_config, &zero);
+    if (!cfg || cfg->slot_ns == 0)
+        return;
+    struct burst_state *st = bpf_map_lookup_elem(&burst, &zero);
+    if (!st)
+        return;
+
+    __u64 slot = bpf_ktime_get_ns() / cfg->slot_ns;
+    if (st->slot != slot) {
+        __u64 prev = st->slot_bytes;
+        st->slot = slot;
+        st->slot_bytes = 0;
+        if (prev > 0)
+            record_burst_slot(st, prev, cfg->gen);
+    }
+    __sync_fetch_and_add(&st->slot_bytes, bytes);
+}
+
 SEC("xdp")
 int xdp_monitor(struct xdp_md *ctx) {
     void *data_end = (void *)(long)ctx->data_end;
     void *data = (void *)(long)ctx->data;
     struct iphdr *ip = 0;
 
+    // 微突发统计（--burst-slot）
+    account_burst(data_end - data);
+
     // 扫描前64字节寻找 IPv4 头（0x45 开头）
     // IPoIB 的头部大小不固定，需要动态查找
     #pragma unroll
@@ -116,7 +198,7 @@ parse_ip:
         struct flow_stats *val = bpf_map_lookup_elem(&flows, &key);
         if (!val) {
             // 新流，直接创建
-            struct flow_stats init = {1, bytes_to_count, current_time};
+            struct flow_stats init = {1, bytes_to_count, current_time, current_time};
             bpf_map_update_elem(&flows, &key, &init, BPF_ANY);
         } else {
             // 累积统计
@@ -149,7 +231,7 @@ handle_other:
         
         struct flow_stats *val = bpf_map_lookup_elem(&flows, &key);
         if (!val) {
-            struct flow_stats init = {1, data_end - data, current_time};
+            struct flow_stats init = {1, data_end - data, current_time, current_time};
             bpf_map_update_elem(&flows, &key, &init, BPF_ANY);
         } else {
             __sync_fetch_and_add(&val->packets, 1);
@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"sync"
@@ -14,11 +15,11 @@ import (
 	"time"
 
 	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/link"
 )
 
 // 多接口监控模式
-func startMultiInterfaceMonitor(interfaces []string, filter string, excludeDNS bool, intervalMs int) {
+func startMultiInterfaceMonitor(interfaces []string) {
+	filter, intervalMs := trafficFilter, collectIntervalMs
 	filterMsg := ""
 	if filter != "" && filter != "all" {
 		filterMsg = fmt.Sprintf("，过滤: %s", filter)
@@ -26,235 +27,297 @@ func startMultiInterfaceMonitor(interfaces []string, filter string, excludeDNS b
 
 	// 获取主机IP地址
 	hostIP := getHostIP()
-	log.Printf("启动多接口 XDP 监控模式，接口数量: %d，主机IP: %s，采集间隔: %dms%s", len(interfaces), hostIP, intervalMs, filterMsg)
-	log.Printf("监控接口列表: %v", interfaces)
+	agentHostIP = hostIP
+	setAgentBuildInfo()
+	log.Printf("启动多接口 XDP 监控模式，主机IP: %s，采集间隔: %dms%s", hostIP, intervalMs, filterMsg)
+	log.Printf("监控接口匹配: %v", interfaces)
 
 	// 捕获 Ctrl+C 退出
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	// 信号只会被一个接收者读到，通过关闭 stop 广播给所有 goroutine
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	shutdown := func() {
+		stopOnce.Do(func() { close(stop) })
+	}
+	go func() {
+		select {
+		case <-sigCh:
+			shutdown()
+		case <-stop:
+		}
+	}()
+
+	// SIGHUP 重新加载配置文件（不卸载 XDP 程序）
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hupCh:
+				reloadConfig()
+			case <-stop:
+				return
+			}
+		}
+	}()
 
 	// 用于等待所有 goroutine 完成
 	var wg sync.WaitGroup
 
-	// 用于同步采集完成，通知推送 goroutine
-	// buffer 设置为 len(interfaces)*2，避免短暂阻塞
-	var collectDone chan struct{}
-	if metricsEnabled {
-		collectDone = make(chan struct{}, len(interfaces)*2)
-	}
-
-	// 为每个接口启动独立的监控 goroutine
-	for _, iface := range interfaces {
-		wg.Add(1)
-		go func(interfaceName string) {
-			defer wg.Done()
-			monitorInterface(interfaceName, filter, excludeDNS, intervalMs, stop, collectDone)
-		}(iface)
-	}
-
-	// 如果启用了 metrics，启动统一的推送 goroutine
-	if metricsEnabled {
+	// TUI 模式：先接管终端和日志输出，再启动采集
+	if tuiEnabled {
+		screen, err := newTUIScreen()
+		if err != nil {
+			log.Fatalf("初始化终端界面失败: %v", err)
+		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			// 持续等待所有采集 goroutine 完成采集并推送
-			// 注意：各接口的采集 ticker 独立，存在微小时序差异（通常<100ms）
-			// 这对 Counter 类型无影响，对 Gauge 类型影响可忽略
-			collectedCount := 0
-			for {
-				select {
-				case <-collectDone:
-					collectedCount++
-					// 收到所有接口的采集完成信号后推送
-					if collectedCount >= len(interfaces) {
-						// 所有接口采集完成，统一推送所有接口的 metrics
-						if err := pushMetricsToVictoriaMetrics(); err != nil {
-							log.Printf("推送 VictoriaMetrics metrics 失败: %v", err)
-						}
-
-						// 推送后重置 Gauge，避免旧值残留
-						networkFlowBytesRate.Reset()
-						networkFlowBitsRate.Reset()
-						networkNICBytesRate.Reset()
-						networkNICBitsRate.Reset()
-
-						// 重置计数器，等待下一轮采集
-						collectedCount = 0
-					}
-				case <-stop:
-					return
-				}
-			}
+			runTUI(screen, stop, shutdown, hostIP, intervalMs)
 		}()
 	}
 
+	// 接口管理器：按名称 / 通配符匹配接口，接口出现时挂载 XDP，删除或改名时卸载
+	manager := newIfaceManager(interfaces, &wg)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		manager.run(stop)
+	}()
+
+	// --on-attach-error=fail：任一接口加载或挂载失败时停止所有监控并退出
+	var attachErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case attachErr = <-manager.failed:
+			shutdown()
+		case <-stop:
+		}
+	}()
+
+	// 采集流水线：调度器按挂钟对齐的时刻统一采集所有接口，合并后的周期快照交给导出 goroutine
+	epochs := make(chan epochSnapshot, 1)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		runScheduler(manager.collectingMonitors, stop, epochs)
+	}()
+	go func() {
+		defer wg.Done()
+		runExporters(epochs, stop, hostIP)
+	}()
+
 	// 等待所有 goroutine 完成
 	wg.Wait()
+	closeOTLPExporter()
+	closeIPFIXExporter()
+	closeFlowEvents(time.Now(), flowEndShutdown, hostIP)
 	log.Printf("所有接口监控已停止")
+	if attachErr != nil {
+		log.Fatalf("接口挂载失败，退出 (--on-attach-error=fail): %v", attachErr)
+	}
 }
 
-// 核心监控函数
-func monitorInterface(iface string, filter string, excludeDNS bool, intervalMs int, stopChan chan os.Signal, collectDone chan struct{}) {
-	filterMsg := ""
-	if filter != "" && filter != "all" {
-		filterMsg = fmt.Sprintf("，过滤: %s", filter)
-	}
+// 是否有需要周期性推送的导出器
+func pushEnabled() bool {
+	return metricsEnabled || otlpEnabled || influxEnabled || ipfixEnabled
+}
 
-	// 获取主机IP地址
-	hostIP := getHostIP()
-	log.Printf("[%s] 启动 XDP 监控，主机IP: %s，采集间隔: %dms%s", iface, hostIP, intervalMs, filterMsg)
+// 一个接口加载的 eBPF 程序和 map
+type monitorObjects struct {
+	XdpMonitor  *ebpf.Program `ebpf:"xdp_monitor"`
+	Flows       *ebpf.Map     `ebpf:"flows"`
+	Burst       *ebpf.Map     `ebpf:"burst"`
+	BurstConfig *ebpf.Map     `ebpf:"burst_config"`
+}
 
-	// 用于保存上次统计数据的map
-	lastStats := make(map[FlowKey]FlowStats)
+func (o *monitorObjects) Close() {
+	o.XdpMonitor.Close()
+	o.Flows.Close()
+	o.Burst.Close()
+	o.BurstConfig.Close()
+}
 
+// 加载 eBPF 对象并挂载 XDP 程序
+// 返回的 lastStats 为沿用的 flows map 中已有的累计值（未沿用时为空）
+func openMonitor(iface string, ifindex int, hostIP string) (*monitorObjects, *xdpAttachment, map[FlowKey]FlowStats, error) {
 	spec, err := ebpf.LoadCollectionSpec("xdp_monitor.o")
 	if err != nil {
-		log.Printf("[%s] 加载 eBPF 规范失败: %v，跳过该接口", iface, err)
-		return
+		return nil, nil, nil, fmt.Errorf("加载 eBPF 规范失败: %w", err)
 	}
 
-	objs := struct {
-		XdpMonitor *ebpf.Program `ebpf:"xdp_monitor"`
-		Flows      *ebpf.Map     `ebpf:"flows"`
-	}{}
-	if err := spec.LoadAndAssign(&objs, nil); err != nil {
-		log.Printf("[%s] 加载 eBPF 对象失败: %v，跳过该接口", iface, err)
-		return
+	objs := &monitorObjects{}
+	adopted, err := loadMonitorObjects(spec, iface, objs)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("加载 eBPF 对象失败: %w", err)
 	}
-	defer objs.XdpMonitor.Close()
-	defer objs.Flows.Close()
 
-	linkRef, err := link.AttachXDP(link.XDPOptions{
-		Program:   objs.XdpMonitor,
-		Interface: ifaceIndex(iface),
-	})
+	// 沿用上一次运行固定的 flows map：以当前累计值作为基线，避免首个周期把累计值当作增量
+	lastStats := make(map[FlowKey]FlowStats)
+	if adopted {
+		if lastStats, err = newXDPMapSource(objs.Flows).Snapshot(); err != nil {
+			log.Printf("[%s] 读取已固定的 flows map 失败: %v", iface, err)
+		}
+		log.Printf("[%s] 沿用已固定的 flows map (%s)，已有 %d 个流", iface, interfacePinDir(iface), len(lastStats))
+	}
+
+	attachment, err := attachXDP(iface, ifindex, objs.XdpMonitor, hostIP)
 	if err != nil {
-		log.Printf("[%s] 附加 XDP 程序失败: %v，跳过该接口", iface, err)
-		return
+		objs.Close()
+		return nil, nil, nil, fmt.Errorf("附加 XDP 程序失败: %w", err)
 	}
-	defer linkRef.Close()
+	return objs, attachment, lastStats, nil
+}
+
+// 核心监控函数：开始采集后调用 started，之后按调度器的采集请求读取 map，直到 stopChan 关闭
+// 加载或挂载失败且 --on-attach-error 不为 retry 时返回错误，由接口管理器处理
+func monitorInterface(iface string, ifindex int, stopChan <-chan struct{}, ticks <-chan collectTick, started func()) error {
+	settingsMu.RLock()
+	filter, intervalMs := trafficFilter, collectIntervalMs
+	settingsMu.RUnlock()
+
+	filterMsg := ""
+	if filter != "" && filter != "all" {
+		filterMsg = fmt.Sprintf("，过滤: %s", filter)
+	}
+
+	// 获取主机IP地址
+	hostIP := getHostIP()
+	log.Printf("[%s] 启动 XDP 监控，主机IP: %s，采集间隔: %dms%s", iface, hostIP, intervalMs, filterMsg)
+
+	// 加载 eBPF 对象并挂载 XDP，失败时按 --on-attach-error 处理
+	objs, attachment, lastStats, err := openMonitor(iface, ifindex, hostIP)
+	backoff := reattachMinBackoff
+	for err != nil {
+		setInterfaceFailed(iface, err)
+		if attachErrorAction(onAttachError) != attachActionRetry {
+			return err
+		}
+		log.Printf("[%s] %v，%v 后重试", iface, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-stopChan:
+			forgetInterfaceHealth(iface)
+			return nil
+		}
+		backoff = nextAttachBackoff(backoff)
+
+		// 接口可能已被重建，按名称重新解析 ifindex
+		if ifi, lookupErr := net.InterfaceByName(iface); lookupErr == nil {
+			ifindex = ifi.Index
+		}
+		objs, attachment, lastStats, err = openMonitor(iface, ifindex, hostIP)
+	}
+	defer objs.Close()
+	defer attachment.Close()
 
 	log.Printf("[%s] XDP program loaded", iface)
+	started()
 
-	// 将毫秒转换为 Duration
-	duration := time.Duration(intervalMs) * time.Millisecond
-	ticker := time.NewTicker(duration)
-	defer ticker.Stop()
+	// 流数据来源：XDP 程序的 flows map
+	source := newXDPMapSource(objs.Flows)
+
+	// 微突发统计（--burst-slot），写入配置失败时只关闭该功能
+	var bursts BurstSource
+	if burstSlot > 0 {
+		if bursts, err = newXDPBurstSource(objs.Burst, objs.BurstConfig, burstSlot); err != nil {
+			log.Printf("[%s] %v，不统计微突发", iface, err)
+			bursts = nil
+		}
+	}
 
 	// 记录上次采集时间，用于计算速率
 	lastCollectTime := time.Now()
+	// 上次采集的单调时钟，用于判断流是否在本周期内创建
+	windowStart := monotonicNow()
+	// 各流连续超过大象流阈值的周期数
+	elephants := newElephantTracker()
+	// 上一周期发出的快照；未被协调器取走时收回，其微突发峰值计入本周期
+	var sent sentSnapshot
+	var latePeak uint64
 
 loop:
 	for {
 		select {
-		case <-ticker.C:
+		case tick := <-ticks:
+			// 上一周期的快照没有按时合并：回退到生成它之前的状态，本周期的增量包含上一周期
+			if late, ok := sent.reclaim(); ok {
+				log.Printf("[%s] 上一周期 (%s) 的快照未能按时合并，计入本周期", iface, late.Epoch.Format(time.RFC3339Nano))
+				lastStats, lastCollectTime, windowStart = sent.lastStats, sent.collectTime, sent.windowStart
+				elephants.rollback()
+				if late.Burst != nil {
+					latePeak = max(latePeak, late.Burst.PeakBytes)
+				}
+			}
+			sent = sentSnapshot{reply: tick.reply, lastStats: lastStats, collectTime: lastCollectTime, windowStart: windowStart}
+
 			// 计算时间间隔（实际经过的时间，用于精确计算速率）
 			now := time.Now()
 			intervalSeconds := now.Sub(lastCollectTime).Seconds()
 			lastCollectTime = now
+			tickStart := monotonicNow()
 
-			// 记录本次采集中活跃的流
-			activeFlows := make(map[FlowKey]bool)
-
-			// 用于累加 NIC 的速率（按接口聚合所有流量）
-			nicRates := newNICRates()
-
-			iter := objs.Flows.Iterate()
-			var k FlowKey
-			var v FlowStats
-			for iter.Next(&k, &v) {
-				// 标记为活跃流
-				activeFlows[k] = true
-				// 过滤无效流量：跳过 src_ip 和 dst_ip 都为 0 的数据
-				if k.SrcIP == 0 && k.DstIP == 0 {
-					continue
-				}
-
-				// 检查是否应该显示该流量
-				if !shouldDisplayTraffic(k.Proto, k.SrcPort, k.DstPort, filter) {
-					continue
-				}
-
-				// 排除DNS流量（如果启用）
-				if excludeDNS && isDNSTraffic(k.DstIP) {
-					continue
-				}
-
-				// 计算增量流量
-				last, exists := lastStats[k]
-				deltaPackets, deltaBytes := v.CalculateDelta(last, exists)
-				lastStats[k] = v
-
-				// 端口号转换和速率计算
-				srcPort, dstPort := k.ConvertPorts()
-				bytesPerSec, bitsPerSec := CalculateRates(deltaBytes, intervalSeconds)
-				trafficTypeStr := k.GetTrafficType()
+			// 检测 XDP 是否仍挂载在接口上，丢失后按退避重新挂载（map 保持不变，lastStats 延续）
+			attachment.check(now)
 
-				// 更新 VictoriaMetrics metrics（如果启用）
-				if metricsEnabled {
-					k.UpdateMetrics(srcPort, dstPort, trafficTypeStr, bytesPerSec, bitsPerSec, iface, hostIP)
-
-					// 添加 NIC 速率（按 IP 对聚合，不包含端口）
-					nicRates.Add(k.SrcIP, k.DstIP, k.Proto, bytesPerSec, bitsPerSec, trafficTypeStr)
-				}
-
-				// 转换为显示格式
-				trafficType := formatTrafficType(trafficTypeStr)
-
-				// 只显示有实际流量的记录（跳过增量为0的）
-				if deltaPackets > 0 {
-					mbps := bitsPerSec / 1000000 // Mbps
-
-					// 打印流量信息（增量值 + 速率），包含接口名称
-					fmt.Printf("[%s] %s:%d -> %s:%d proto=%d%s packets=%d bytes=%d (%.2f MB/s, %.2f Mbps) host_ip=%s\n",
-						iface, ipToStr(k.SrcIP), srcPort,
-						ipToStr(k.DstIP), dstPort,
-						k.Proto, trafficType, deltaPackets, deltaBytes,
-						bytesPerSec/1024/1024, mbps, hostIP)
-				}
-			}
-			if err := iter.Err(); err != nil {
+			iterStart := time.Now()
+			flows, err := source.Snapshot()
+			if err != nil {
 				log.Printf("[%s] iter error: %v", iface, err)
 			}
-
-			// 清理不活跃的流（不在当前 BPF map 中的流）
-			for key := range lastStats {
-				if !activeFlows[key] {
-					delete(lastStats, key)
-				}
+			iteration := time.Since(iterStart)
+
+			// 本周期内使用同一份运行时设置（SIGHUP 热加载时等待本周期结束）
+			settingsMu.RLock()
+			opts := collectOptions{
+				Filter:      trafficFilter,
+				ExcludeDNS:  excludeDNSTraffic,
+				WindowStart: windowStart,
+				Interval:    intervalSeconds,
+				Epoch:       tick.epoch,
+				ClockOffset: now.UnixNano() - int64(tickStart),
+				NICRates:    pushEnabled(),
+				Elephant:    elephantSettings,
+				Elephants:   elephants,
 			}
-
-			// 更新 NIC 速率 metrics（累加后的结果）
-			if metricsEnabled {
-				nicRates.UpdateMetrics(iface, hostIP)
+			settingsMu.RUnlock()
+			if opts.Elephant.LinkShare > 0 {
+				opts.LinkBytesPerSec = linkBytesPerSec(iface, opts.Elephant.LinkSpeedMbps)
 			}
 
-			// 通知采集完成（如果启用了 metrics）
-			if metricsEnabled && collectDone != nil {
-				// 使用非阻塞发送，但增加重试机制
-				select {
-				case collectDone <- struct{}{}:
-					// 成功发送采集完成信号
-				default:
-					// channel 已满，异步发送避免阻塞采集
-					go func() {
-						select {
-						case collectDone <- struct{}{}:
-							// 异步发送成功
-						case <-time.After(time.Second):
-							// 超时，说明推送 goroutine 可能已停止
-							log.Printf("[%s] 警告: 采集完成信号发送超时", iface)
-						}
-					}()
+			// 本周期的接口快照（流样本、按接口聚合的 NIC 速率和采集统计）
+			var snap ifaceSnapshot
+			snap, lastStats = collectFlows(iface, flows, lastStats, opts)
+			snap.MapCapacity = source.Capacity()
+			snap.Iteration = iteration
+			windowStart = tickStart
+			if bursts != nil {
+				if b, err := bursts.ReadBurst(); err != nil {
+					log.Printf("[%s] %v", iface, err)
+				} else {
+					b.PeakBytes = max(b.PeakBytes, latePeak)
+					latePeak = 0
+					snap.Burst = &b
 				}
 			}
+
+			// 快照交给协调器按周期合并，之后不再修改
+			tick.reply <- snap
 		case <-stopChan:
 			log.Printf("[%s] 接收到停止信号，正在关闭监控...", iface)
 			break loop
 		}
 	}
 
+	forgetInterfaceAgentMetrics(iface)
+	tuiState.forget(iface)
 	log.Printf("[%s] XDP 监控已停止", iface)
+	return nil
 }
 
 // 检查是否应该显示该流量（根据过滤条件）